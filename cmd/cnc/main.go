@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/k-omotani/aeron-sample/internal/cnc"
+)
+
+const usage = `Usage: cnc [flags] [command]
+
+Reads the media driver's cnc.dat without connecting to the driver.
+
+Commands:
+  summary     driver status and main system counters (default)
+  counters    every allocated counter
+  positions   publication and image position counters
+  errors      the distinct error log
+  health      exit 1 if the driver heartbeat is older than --timeout
+
+Flags:
+`
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	aeronDir := flag.String("aeron-dir", "/dev/shm/aeron", "Aeron media driver directory")
+	jsonOutput := flag.Bool("json", false, "Write JSON instead of a table")
+	timeout := flag.Duration("timeout", 10*time.Second, "Heartbeat age past which health fails")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	command := "summary"
+	if flag.NArg() > 0 {
+		command = flag.Arg(0)
+	}
+
+	file, err := cnc.Open(*aeronDir)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	out := os.Stdout
+	switch command {
+	case "summary":
+		status := struct {
+			PID            int64       `json:"pid"`
+			StartedAt      time.Time   `json:"started_at"`
+			HeartbeatAt    time.Time   `json:"heartbeat_at"`
+			HeartbeatAgeMs int64       `json:"heartbeat_age_ms"`
+			DistinctErrors int         `json:"distinct_errors"`
+			Counters       cnc.Summary `json:"counters"`
+		}{
+			PID:            file.PID(),
+			StartedAt:      file.StartTime(),
+			HeartbeatAt:    file.Heartbeat(),
+			HeartbeatAgeMs: file.HeartbeatAge().Milliseconds(),
+			DistinctErrors: len(file.Errors()),
+			Counters:       file.Summary(),
+		}
+		if *jsonOutput {
+			return writeJSON(out, status)
+		}
+		fmt.Fprintf(out, "pid:             %d\n", status.PID)
+		fmt.Fprintf(out, "started:         %s\n", status.StartedAt.Format(time.RFC3339))
+		fmt.Fprintf(out, "heartbeat age:   %s\n", file.HeartbeatAge().Round(time.Millisecond))
+		fmt.Fprintf(out, "distinct errors: %d\n", status.DistinctErrors)
+		s := status.Counters
+		tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw)
+		for _, row := range []struct {
+			name  string
+			value int64
+		}{
+			{"bytes sent", s.BytesSent},
+			{"bytes received", s.BytesReceived},
+			{"naks sent", s.NaksSent},
+			{"naks received", s.NaksReceived},
+			{"retransmits sent", s.RetransmitsSent},
+			{"heartbeats sent", s.HeartbeatsSent},
+			{"heartbeats received", s.HeartbeatsReceived},
+			{"invalid packets", s.InvalidPackets},
+			{"errors", s.Errors},
+			{"short sends", s.ShortSends},
+			{"loss gap fills", s.LossGapFills},
+			{"client timeouts", s.ClientTimeouts},
+			{"back-pressure events", s.BackPressureEvents},
+		} {
+			fmt.Fprintf(tw, "%s\t%d\n", row.name, row.value)
+		}
+		return tw.Flush()
+
+	case "counters":
+		counters := file.Counters()
+		if *jsonOutput {
+			return writeJSON(out, counters)
+		}
+		tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tTYPE\tVALUE\tLABEL")
+		for _, c := range counters {
+			fmt.Fprintf(tw, "%d\t%d\t%d\t%s\n", c.ID, c.TypeID, c.Value, c.Label)
+		}
+		return tw.Flush()
+
+	case "positions":
+		positions := file.Positions()
+		if *jsonOutput {
+			return writeJSON(out, positions)
+		}
+		tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "TYPE\tSESSION\tSTREAM\tPOSITION\tCHANNEL")
+		for _, p := range positions {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\n", p.Type, p.SessionID, p.StreamID, p.Value, p.Channel)
+		}
+		return tw.Flush()
+
+	case "errors":
+		records := file.Errors()
+		if *jsonOutput {
+			return writeJSON(out, records)
+		}
+		for _, e := range records {
+			fmt.Fprintf(out, "%d observations from %s to %s\n%s\n\n",
+				e.Count, e.First.Format(time.RFC3339), e.Last.Format(time.RFC3339), strings.TrimSpace(e.Message))
+		}
+		fmt.Fprintf(out, "%d distinct errors\n", len(records))
+		return nil
+
+	case "health":
+		age := file.HeartbeatAge()
+		if age > *timeout {
+			return fmt.Errorf("driver heartbeat is %s old", age.Round(time.Millisecond))
+		}
+		fmt.Fprintf(out, "ok: driver heartbeat %s ago\n", age.Round(time.Millisecond))
+		return nil
+
+	default:
+		flag.Usage()
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+func writeJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	aeronlib "github.com/lirm/aeron-go/aeron"
+	"github.com/lirm/aeron-go/aeron/atomic"
+
+	"github.com/k-omotani/aeron-sample/internal/aeron"
+	"github.com/k-omotani/aeron-sample/internal/deadletter"
+	"github.com/k-omotani/aeron-sample/internal/message"
+)
+
+const usage = `Usage: deadletter [flags] command [id...]
+
+Lists, inspects and re-publishes the messages the subscriber stored in its
+dead-letter directory.
+
+Commands:
+  list             every dead letter, oldest first (default)
+  inspect id...    the stored frame of each letter, decoded where possible
+  reinject id...   publish the stored messages again, without their sequence
+                   numbers; "all" re-publishes every letter
+
+Flags:
+`
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	dir := flag.String("dir", "/data/dead-letters", "Dead-letter directory")
+	jsonOutput := flag.Bool("json", false, "Write JSON instead of a table")
+	aeronDir := flag.String("aeron-dir", "/dev/shm/aeron", "Aeron media driver directory, for reinject")
+	channel := flag.String("channel", "aeron:udp?endpoint=localhost:40123", "Channel to re-publish on")
+	streamID := flag.Int("stream-id", 1001, "Stream ID to re-publish on")
+	timeout := flag.Duration("timeout", 5*time.Second, "How long to try publishing each letter")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	command := "list"
+	if flag.NArg() > 0 {
+		command = flag.Arg(0)
+	}
+
+	out := os.Stdout
+	switch command {
+	case "list":
+		letters, err := deadletter.List(*dir)
+		if err != nil {
+			return err
+		}
+		if *jsonOutput {
+			return writeJSON(out, letters)
+		}
+		tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tTIME\tSESSION\tPOSITION\tSTAGE\tBYTES\tERROR")
+		for _, l := range letters {
+			fmt.Fprintf(tw, "%d\t%s\t%d\t%d\t%s\t%d\t%s\n",
+				l.ID, l.Time.Format(time.RFC3339), l.SessionID, l.Position, l.Stage, len(l.Frame), l.Error)
+		}
+		return tw.Flush()
+
+	case "inspect":
+		letters, err := selectLetters(*dir, flag.Args()[1:])
+		if err != nil {
+			return err
+		}
+		inspected := make([]inspection, 0, len(letters))
+		for _, l := range letters {
+			inspected = append(inspected, inspect(l))
+		}
+		if *jsonOutput {
+			return writeJSON(out, inspected)
+		}
+		for _, i := range inspected {
+			l := i.Letter
+			fmt.Fprintf(out, "id:       %d\n", l.ID)
+			fmt.Fprintf(out, "time:     %s\n", l.Time.Format(time.RFC3339Nano))
+			fmt.Fprintf(out, "session:  %d\n", l.SessionID)
+			fmt.Fprintf(out, "position: %d\n", l.Position)
+			fmt.Fprintf(out, "stage:    %s\n", l.Stage)
+			fmt.Fprintf(out, "error:    %s\n", l.Error)
+			if i.Message != nil {
+				decoded, err := json.MarshalIndent(i.Message, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(out, "message:  %s\n", decoded)
+			} else {
+				fmt.Fprintf(out, "message:  not decodable: %s\n", i.DecodeError)
+			}
+			fmt.Fprintf(out, "frame:\n%s\n", hex.Dump(l.Frame))
+		}
+		return nil
+
+	case "reinject":
+		letters, err := selectLetters(*dir, flag.Args()[1:])
+		if err != nil {
+			return err
+		}
+		return reinject(letters, *aeronDir, *channel, int32(*streamID), *timeout, out)
+
+	default:
+		flag.Usage()
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+// selectLetters returns the letters named by ids, or every letter for "all"
+func selectLetters(dir string, ids []string) ([]deadletter.Letter, error) {
+	if len(ids) == 0 {
+		return nil, errors.New("no dead-letter IDs given")
+	}
+	if len(ids) == 1 && ids[0] == "all" {
+		return deadletter.List(dir)
+	}
+	letters := make([]deadletter.Letter, 0, len(ids))
+	for _, arg := range ids {
+		id, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dead-letter ID %q", arg)
+		}
+		letter, err := deadletter.Get(dir, id)
+		if err != nil {
+			return nil, err
+		}
+		letters = append(letters, letter)
+	}
+	return letters, nil
+}
+
+// inspection is a letter with its frame decoded, as far as possible
+type inspection struct {
+	Letter      deadletter.Letter `json:"letter"`
+	Message     *messageView      `json:"message,omitempty"`
+	DecodeError string            `json:"decode_error,omitempty"`
+}
+
+// messageView is the JSON form of a decoded message
+type messageView struct {
+	Type          string          `json:"type"`
+	Timestamp     time.Time       `json:"timestamp"`
+	RequestID     string          `json:"request_id,omitempty"`
+	Sequence      uint64          `json:"sequence,omitempty"`
+	ReplyChannel  string          `json:"reply_channel,omitempty"`
+	ReplyStreamID int32           `json:"reply_stream_id,omitempty"`
+	Payload       message.Payload `json:"payload,omitempty"`
+}
+
+func inspect(letter deadletter.Letter) inspection {
+	i := inspection{Letter: letter}
+	if len(letter.Frame) == 0 {
+		i.DecodeError = "empty frame"
+		return i
+	}
+	msg, err := message.DefaultRegistry().Decode(atomic.MakeBuffer(letter.Frame), 0, int32(len(letter.Frame)))
+	if err != nil {
+		i.DecodeError = err.Error()
+		return i
+	}
+	i.Message = &messageView{
+		Type:          msg.Type.String(),
+		Timestamp:     time.Unix(0, msg.Timestamp),
+		RequestID:     msg.RequestID,
+		Sequence:      msg.Sequence,
+		ReplyChannel:  msg.ReplyChannel,
+		ReplyStreamID: msg.ReplyStreamID,
+		Payload:       msg.Payload,
+	}
+	return i
+}
+
+// reinject publishes the stored frames in order, stopping at the first one
+// that cannot be published. Sequence numbers are cleared first: the
+// publisher that assigned them has moved on, so gap detection would report
+// a reinjected message as reordered.
+func reinject(letters []deadletter.Letter, aeronDir, channel string, streamID int32, timeout time.Duration, out io.Writer) error {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
+
+	config := aeron.DefaultPublisherConfig()
+	config.AeronDir = aeronDir
+	config.Channel = channel
+	config.StreamID = streamID
+
+	aeronCtx := aeronlib.NewContext()
+	aeronCtx.AeronDir(config.AeronDir)
+	aeronCtx.MediaDriverTimeout(config.MediaDriverTimeout)
+	client, err := aeronlib.Connect(aeronCtx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to Aeron: %w", err)
+	}
+	defer client.Close()
+
+	// Frames carry their own codec ID, so the publisher's codec is unused
+	publisher, err := aeron.NewPublisher(client, config, message.NewBinaryCodec(), logger)
+	if err != nil {
+		return fmt.Errorf("failed to create publisher: %w", err)
+	}
+	defer publisher.Close()
+
+	registry := message.DefaultRegistry()
+	for _, l := range letters {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err := publisher.PublishFrame(ctx, unsequenced(registry, l.Frame))
+		cancel()
+		if err != nil {
+			return fmt.Errorf("failed to reinject dead letter %d: %w", l.ID, err)
+		}
+		fmt.Fprintf(out, "reinjected %d (%d bytes)\n", l.ID, len(l.Frame))
+	}
+	return nil
+}
+
+// unsequenced re-encodes frame with its sequence number cleared, since
+// unsequenced messages are not checked for gaps. Frames that do not decode
+// are returned unchanged; legacy JSON frames come back with a codec ID.
+func unsequenced(registry *message.Registry, frame []byte) []byte {
+	msg, err := registry.Decode(atomic.MakeBuffer(frame), 0, int32(len(frame)))
+	if err != nil || msg.Sequence == 0 {
+		return frame
+	}
+	id := message.CodecID(frame[0])
+	if frame[0] == '{' {
+		id = message.CodecIDJSON
+	}
+	codec, err := registry.ByID(id)
+	if err != nil {
+		return frame
+	}
+	msg.Sequence = 0
+	cleared, err := message.Marshal(codec, msg)
+	if err != nil {
+		return frame
+	}
+	return cleared
+}
+
+func writeJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
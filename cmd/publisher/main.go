@@ -13,8 +13,11 @@ import (
 	aeronlib "github.com/lirm/aeron-go/aeron"
 
 	"github.com/k-omotani/aeron-sample/internal/aeron"
+	"github.com/k-omotani/aeron-sample/internal/counter"
 	"github.com/k-omotani/aeron-sample/internal/handler"
 	"github.com/k-omotani/aeron-sample/internal/logging"
+	"github.com/k-omotani/aeron-sample/internal/message"
+	"github.com/k-omotani/aeron-sample/internal/metrics"
 )
 
 func main() {
@@ -30,7 +33,35 @@ func run() error {
 	logLevel := flag.String("log-level", "debug", "Log level (debug, info, warn, error)")
 	aeronDir := flag.String("aeron-dir", "/dev/shm/aeron", "Aeron media driver directory")
 	channel := flag.String("channel", "", "Aeron channel (e.g., aeron:udp?endpoint=subscriber-driver:40123)")
+	instanceID := flag.String("instance-id", "", "Publisher instance ID sent as the message source (env INSTANCE_ID, defaults to the hostname)")
+	adminToken := flag.String("admin-token", "", "Bearer token required by admin endpoints (env ADMIN_TOKEN); admin endpoints are disabled when empty")
 	streamID := flag.Int("stream-id", 1001, "Aeron stream ID")
+	maxCounters := flag.Int("max-counters", counter.DefaultMaxCounters, "Most distinct counter names published to (0 = no limit); match the subscriber's")
+	codecName := flag.String("codec", aeron.DefaultPublisherConfig().Codec, "Message codec (binary, json, msgpack, protobuf)")
+	asyncQueueSize := flag.Int("async-queue-size", aeron.DefaultPublisherConfig().Async.QueueSize, "Capacity of the async publish queue")
+	asyncMaxBatch := flag.Int("async-max-batch", aeron.DefaultPublisherConfig().Async.MaxBatch, "Most queued messages coalesced into one frame")
+	overflowPolicy := flag.String("overflow-policy", aeron.DefaultPublisherConfig().Async.Overflow.String(), "Async queue overflow policy (block, drop-newest, drop-oldest, fail-fast)")
+	retry := aeron.DefaultPublisherConfig().Retry
+	flag.IntVar(&retry.SpinAttempts, "retry-spin", retry.SpinAttempts, "Offer retries made immediately before yielding")
+	flag.IntVar(&retry.YieldAttempts, "retry-yield", retry.YieldAttempts, "Offer retries made after yielding before sleeping")
+	flag.DurationVar(&retry.InitialBackoff, "retry-initial-backoff", retry.InitialBackoff, "First sleep between offer retries")
+	flag.DurationVar(&retry.MaxBackoff, "retry-max-backoff", retry.MaxBackoff, "Maximum sleep between offer retries")
+	flag.Float64Var(&retry.Multiplier, "retry-multiplier", retry.Multiplier, "Backoff growth factor between offer retries")
+	flag.Float64Var(&retry.Jitter, "retry-jitter", retry.Jitter, "Random fraction applied to each backoff (0-1)")
+	flag.IntVar(&retry.MaxNotConnected, "retry-max-not-connected", retry.MaxNotConnected, "Retry budget for NotConnected (-1 = until timeout)")
+	flag.IntVar(&retry.MaxBackPressured, "retry-max-back-pressured", retry.MaxBackPressured, "Retry budget for BackPressured (-1 = until timeout)")
+	flag.IntVar(&retry.MaxAdminAction, "retry-max-admin-action", retry.MaxAdminAction, "Retry budget for AdminAction (-1 = until timeout)")
+	flag.IntVar(&retry.MaxClosed, "retry-max-closed", retry.MaxClosed, "Retry budget for PublicationClosed (-1 = until timeout)")
+	flag.IntVar(&retry.MaxMaxPositionExceeded, "retry-max-position-exceeded", retry.MaxMaxPositionExceeded, "Retry budget for MaxPositionExceeded (-1 = until timeout)")
+	breaker := aeron.DefaultPublisherConfig().Breaker
+	flag.IntVar(&breaker.FailureThreshold, "breaker-failures", breaker.FailureThreshold, "Consecutive failed publishes that open the circuit")
+	flag.DurationVar(&breaker.NotConnectedTimeout, "breaker-not-connected-timeout", breaker.NotConnectedTimeout, "Sustained NotConnected that opens the circuit")
+	flag.DurationVar(&breaker.OpenDuration, "breaker-open-duration", breaker.OpenDuration, "How long the circuit stays open before probing")
+	flag.IntVar(&breaker.HalfOpenProbes, "breaker-half-open-probes", breaker.HalfOpenProbes, "Publishes let through while the circuit is half-open")
+	reply := aeron.DefaultPublisherConfig().Reply
+	flag.StringVar(&reply.Channel, "reply-channel", reply.Channel, "Channel the subscriber sends replies to, as reachable from the subscriber (empty disables ?wait=applied)")
+	flag.StringVar(&reply.ListenChannel, "reply-listen-channel", reply.ListenChannel, "Local subscription channel for replies (defaults to --reply-channel)")
+	replyStreamID := flag.Int("reply-stream-id", int(reply.StreamID), "Aeron stream ID for replies")
 	flag.Parse()
 
 	// Setup logging
@@ -47,11 +78,30 @@ func run() error {
 		channelStr = aeron.DefaultPublisherConfig().Channel
 	}
 
+	instanceIDStr := *instanceID
+	if instanceIDStr == "" {
+		instanceIDStr = os.Getenv("INSTANCE_ID")
+	}
+	if instanceIDStr == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("failed to determine instance ID: %w", err)
+		}
+		instanceIDStr = hostname
+	}
+
+	adminTokenStr := *adminToken
+	if adminTokenStr == "" {
+		adminTokenStr = os.Getenv("ADMIN_TOKEN")
+	}
+
 	logger.Info("starting publisher application",
 		"addr", *httpAddr,
+		"instanceID", instanceIDStr,
 		"aeronDir", *aeronDir,
 		"channel", channelStr,
 		"streamID", *streamID,
+		"codec", *codecName,
 	)
 
 	// Create context for graceful shutdown
@@ -67,6 +117,26 @@ func run() error {
 	config.AeronDir = *aeronDir
 	config.Channel = channelStr
 	config.StreamID = int32(*streamID)
+	config.Codec = *codecName
+	config.Retry = retry
+	config.Breaker = breaker
+	config.Reply = reply
+	config.Reply.StreamID = int32(*replyStreamID)
+	config.Async.QueueSize = *asyncQueueSize
+	config.Async.MaxBatch = *asyncMaxBatch
+	overflow, err := aeron.ParseOverflowPolicy(*overflowPolicy)
+	if err != nil {
+		return err
+	}
+	config.Async.Overflow = overflow
+
+	codec, err := config.ResolveCodec(message.DefaultRegistry())
+	if err != nil {
+		return err
+	}
+	if codec == nil {
+		return fmt.Errorf("publisher codec must not be %q", aeron.CodecAuto)
+	}
 
 	// Initialize Aeron
 	aeronCtx := aeronlib.NewContext()
@@ -84,32 +154,72 @@ func run() error {
 
 	logger.Info("connected to Aeron media driver")
 
+	driverMonitor, err := aeron.NewDriverMonitor(aeronClient, config)
+	if err != nil {
+		return err
+	}
+	defer driverMonitor.Close()
+
+	metricRegistry := metrics.NewRegistry()
+	driverMonitor.RegisterMetrics(metricRegistry)
+
 	// Initialize publisher
 	publisher, err := aeron.NewPublisher(
 		aeronClient,
-		config.Channel,
-		config.StreamID,
+		config,
+		codec,
 		logger,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create publisher: %w", err)
 	}
 	defer publisher.Close()
+	publisher.RegisterMetrics(metricRegistry)
+
+	// Start async publisher for ?mode=async requests
+	asyncPublisher := aeron.NewAsyncPublisher(publisher, config.Async, logger)
+	asyncPublisher.RegisterMetrics(metricRegistry)
+	asyncPublisher.Start(ctx)
+
+	// Receive replies for ?wait=applied requests
+	var replyReceiver *aeron.ReplyReceiver
+	if config.Reply.Channel != "" {
+		replyReceiver, err = aeron.NewReplyReceiver(aeronClient, config, message.DefaultRegistry(), logger)
+		if err != nil {
+			return fmt.Errorf("failed to subscribe to replies: %w", err)
+		}
+		defer replyReceiver.Close()
+		replyReceiver.RegisterMetrics(metricRegistry)
+		replyReceiver.Start(ctx)
+	}
 
 	// Setup HTTP handlers
-	publishHandler := handler.NewPublishHandler(publisher, logger)
+	publishHandler := handler.NewPublishHandler(publisher, asyncPublisher, replyReceiver, instanceIDStr, logger)
+	publishHandler.SetMaxCounters(*maxCounters)
+	adminAuth := handler.NewAdminAuth(adminTokenStr, logger)
 	healthHandler := handler.NewHealthHandler()
+	healthHandler.AddLivenessCheck("aeron", handler.ClientCheck(driverMonitor))
+	healthHandler.AddReadinessCheck("driver", handler.DriverCheck(driverMonitor))
+	healthHandler.AddReadinessCheck("publication", handler.PublicationCheck(publisher))
+	healthHandler.AddReadinessCheck("circuit", handler.CircuitCheck(publisher))
 
 	// Setup HTTP routes
 	mux := http.NewServeMux()
 	mux.HandleFunc("POST /api/counter/increment", publishHandler.Increment)
+	mux.HandleFunc("POST /api/counters/{name}/increment", publishHandler.IncrementNamed)
+	mux.HandleFunc("POST /api/counters/{name}/decrement", publishHandler.Decrement)
+	mux.HandleFunc("POST /api/counters/{name}/set", publishHandler.Set)
+	mux.HandleFunc("POST /api/counters/{name}/compare-and-set", publishHandler.CompareAndSet)
+	mux.HandleFunc("POST /api/counters/{name}/bounded-increment", publishHandler.BoundedIncrement)
+	mux.HandleFunc("POST /api/counter/reset", adminAuth.Require(publishHandler.Reset))
+	mux.Handle("GET /metrics", metricRegistry.Handler())
 	mux.HandleFunc("GET /health", healthHandler.Health)
 	mux.HandleFunc("GET /ready", healthHandler.Ready)
 
 	// Create HTTP server
 	server := &http.Server{
 		Addr:         *httpAddr,
-		Handler:      mux,
+		Handler:      handler.NewHTTPMetrics(metricRegistry).Wrap(mux),
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
 	}
@@ -138,6 +248,10 @@ func run() error {
 		logger.Error("server shutdown error", "error", err)
 	}
 
+	if err := asyncPublisher.Close(shutdownCtx); err != nil {
+		logger.Error("async publisher drain error", "error", err)
+	}
+
 	logger.Info("publisher shutdown complete")
 	return nil
 }
@@ -4,15 +4,23 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
 	aeronlib "github.com/lirm/aeron-go/aeron"
 
 	"github.com/k-omotani/aeron-sample/internal/aeron"
 	"github.com/k-omotani/aeron-sample/internal/counter"
+	"github.com/k-omotani/aeron-sample/internal/deadletter"
+	"github.com/k-omotani/aeron-sample/internal/handler"
 	"github.com/k-omotani/aeron-sample/internal/logging"
+	"github.com/k-omotani/aeron-sample/internal/message"
+	"github.com/k-omotani/aeron-sample/internal/metrics"
+	"github.com/k-omotani/aeron-sample/internal/snapshot"
 )
 
 func main() {
@@ -24,10 +32,50 @@ func main() {
 
 func run() error {
 	// Parse flags
+	httpAddr := flag.String("addr", ":8080", "HTTP listen address")
 	logLevel := flag.String("log-level", "debug", "Log level (debug, info, warn, error)")
 	aeronDir := flag.String("aeron-dir", "/dev/shm/aeron", "Aeron media driver directory")
 	channel := flag.String("channel", "", "Aeron channel (e.g., aeron:udp?endpoint=0.0.0.0:40123)")
 	streamID := flag.Int("stream-id", 1001, "Aeron stream ID")
+	codecName := flag.String("codec", aeron.DefaultSubscriberConfig().Codec, "Required message codec, or auto to detect per message")
+	maxMessageSize := flag.Int("max-message-size", int(aeron.DefaultSubscriberConfig().MaxMessageSize), "Largest message in bytes reassembled from fragments")
+	pollConfig := aeron.DefaultSubscriberConfig().Poll
+	flag.IntVar(&pollConfig.FragmentLimit, "fragment-limit", pollConfig.FragmentLimit, "Most fragments handled per poll")
+	idleStrategy := flag.String("idle-strategy", pollConfig.Idle.String(), "Poll loop idle strategy (busy-spin, yielding, backoff, sleeping)")
+	flag.DurationVar(&pollConfig.SleepFor, "idle-sleep", pollConfig.SleepFor, "Sleep of the sleeping idle strategy, and longest park of backoff")
+	dispatchConfig := aeron.DefaultSubscriberConfig().Dispatch
+	flag.IntVar(&dispatchConfig.Workers, "workers", dispatchConfig.Workers, "Goroutines applying messages, partitioned by counter name (1 applies them on the poll goroutine)")
+	flag.IntVar(&dispatchConfig.QueueSize, "worker-queue-size", dispatchConfig.QueueSize, "Messages queued per worker before the poll loop is held back")
+	dedupConfig := counter.DefaultDedupConfig()
+	flag.DurationVar(&dedupConfig.Window, "dedup-window", dedupConfig.Window, "How long applied request IDs are remembered (0 disables deduplication)")
+	flag.IntVar(&dedupConfig.MaxEntries, "dedup-max-entries", dedupConfig.MaxEntries, "Most request IDs remembered for deduplication")
+	maxCounters := flag.Int("max-counters", counter.DefaultMaxCounters, "Most named counters created (0 = no limit)")
+	snapshotDir := flag.String("snapshot-dir", "", "Directory for counter snapshots (empty disables snapshots)")
+	snapshotInterval := flag.Duration("snapshot-interval", 10*time.Second, "Interval between counter snapshots")
+	deadLetterConfig := deadletter.DefaultFileConfig()
+	flag.StringVar(&deadLetterConfig.Dir, "dead-letter-dir", "", "Directory for messages that fail to decode or apply (empty disables the dead-letter store)")
+	flag.Int64Var(&deadLetterConfig.MaxFileSize, "dead-letter-max-file-size", deadLetterConfig.MaxFileSize, "Dead-letter file size in bytes past which a new file is started")
+	flag.IntVar(&deadLetterConfig.MaxFiles, "dead-letter-max-files", deadLetterConfig.MaxFiles, "Dead-letter files kept before the oldest is deleted")
+	archiveConfig := aeron.DefaultSubscriberConfig().Archive
+	flag.BoolVar(&archiveConfig.Enabled, "archive", archiveConfig.Enabled, "Record the stream in Aeron Archive and replay it at startup")
+	flag.StringVar(&archiveConfig.ControlChannel, "archive-control-channel", archiveConfig.ControlChannel, "Aeron Archive control request channel")
+	flag.StringVar(&archiveConfig.ResponseChannel, "archive-response-channel", archiveConfig.ResponseChannel, "Aeron Archive control response channel")
+	flag.StringVar(&archiveConfig.ReplayChannel, "replay-channel", archiveConfig.ReplayChannel, "Channel the archive replays recordings on")
+	replayStreamID := flag.Int("replay-stream-id", int(archiveConfig.ReplayStreamID), "Stream ID the archive replays recordings on")
+	flag.DurationVar(&archiveConfig.ImageTimeout, "replay-image-timeout", archiveConfig.ImageTimeout, "How long a started replay may take to appear before startup fails")
+	replyConfig := aeron.DefaultSubscriberConfig().Reply
+	flag.IntVar(&replyConfig.QueueSize, "reply-queue-size", replyConfig.QueueSize, "Replies waiting to be sent before new ones are dropped")
+	flag.DurationVar(&replyConfig.SendTimeout, "reply-send-timeout", replyConfig.SendTimeout, "How long to try sending one reply")
+	replyCodec := flag.String("reply-codec", "binary", "Codec replies are encoded with")
+	replyAllowedChannels := flag.String("reply-allowed-channels", "", "Comma-separated channel prefixes replies may be sent to (empty rejects every reply)")
+	flag.IntVar(&replyConfig.MaxPublications, "reply-max-publications", replyConfig.MaxPublications, "Reply publications kept open before the least recently used is closed")
+	flag.DurationVar(&replyConfig.PublicationIdleTimeout, "reply-idle-timeout", replyConfig.PublicationIdleTimeout, "How long an unused reply publication stays open")
+	windowConfig := counter.DefaultWindowConfig()
+	windowSizes := flag.String("window-sizes", formatDurations(windowConfig.Sizes), "Comma-separated tumbling window sizes")
+	flag.IntVar(&windowConfig.Retain, "window-retain", windowConfig.Retain, "Closed windows kept per size")
+	flag.DurationVar(&windowConfig.AllowedLateness, "window-lateness", windowConfig.AllowedLateness, "How far the watermark trails the slowest publisher")
+	flag.DurationVar(&windowConfig.MaxClockSkew, "window-max-skew", windowConfig.MaxClockSkew, "How far ahead of the local clock an event timestamp may be")
+	flag.DurationVar(&windowConfig.IdleTimeout, "window-idle-timeout", windowConfig.IdleTimeout, "How long a quiet publisher holds back the watermark")
 	flag.Parse()
 
 	// Setup logging
@@ -45,24 +93,59 @@ func run() error {
 	}
 
 	logger.Info("starting subscriber application",
+		"addr", *httpAddr,
 		"aeronDir", *aeronDir,
 		"channel", channelStr,
 		"streamID", *streamID,
+		"codec", *codecName,
 	)
 
-	// Create context for graceful shutdown
-	ctx, cancel := context.WithCancel(context.Background())
+	// Create context for graceful shutdown. A signal cancels it from the
+	// start, so it also stops a replay still running at startup.
+	signalCtx, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stopSignals()
+	ctx, cancel := context.WithCancel(signalCtx)
 	defer cancel()
 
-	// Setup signal handling
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-
 	// Load configuration
 	config := aeron.DefaultSubscriberConfig()
 	config.AeronDir = *aeronDir
 	config.Channel = channelStr
 	config.StreamID = int32(*streamID)
+	config.Codec = *codecName
+	config.MaxMessageSize = int32(*maxMessageSize)
+	if pollConfig.FragmentLimit <= 0 {
+		return fmt.Errorf("invalid --fragment-limit %d: must be positive", pollConfig.FragmentLimit)
+	}
+	idle, err := aeron.ParseIdleStrategy(*idleStrategy)
+	if err != nil {
+		return err
+	}
+	pollConfig.Idle = idle
+	config.Poll = pollConfig
+	if dispatchConfig.Workers <= 0 {
+		return fmt.Errorf("invalid --workers %d: must be positive", dispatchConfig.Workers)
+	}
+	if dispatchConfig.QueueSize <= 0 {
+		return fmt.Errorf("invalid --worker-queue-size %d: must be positive", dispatchConfig.QueueSize)
+	}
+	config.Dispatch = dispatchConfig
+	if *maxCounters < 0 {
+		return fmt.Errorf("invalid --max-counters %d: must not be negative", *maxCounters)
+	}
+	if archiveConfig.Enabled && archiveConfig.ImageTimeout <= 0 {
+		return fmt.Errorf("invalid --replay-image-timeout %s: must be positive", archiveConfig.ImageTimeout)
+	}
+	config.Archive = archiveConfig
+	config.Archive.ReplayStreamID = int32(*replayStreamID)
+	replyConfig.AllowedChannels = parseList(*replyAllowedChannels)
+	config.Reply = replyConfig
+
+	windowSizesList, err := parseDurations(*windowSizes)
+	if err != nil {
+		return fmt.Errorf("invalid --window-sizes: %w", err)
+	}
+	windowConfig.Sizes = windowSizesList
 
 	// Initialize Aeron
 	aeronCtx := aeronlib.NewContext()
@@ -80,37 +163,237 @@ func run() error {
 
 	logger.Info("connected to Aeron media driver")
 
+	driverMonitor, err := aeron.NewDriverMonitor(aeronClient, config)
+	if err != nil {
+		return err
+	}
+	defer driverMonitor.Close()
+
+	metricRegistry := metrics.NewRegistry()
+	driverMonitor.RegisterMetrics(metricRegistry)
+
 	// Initialize counter state
 	counterState := counter.NewState()
+	counterState.SetMaxCounters(*maxCounters)
 
 	// Create message processor
-	processor := counter.NewProcessor(counterState, logger)
+	var dedup *counter.Deduplicator
+	if dedupConfig.Window > 0 {
+		dedup = counter.NewDeduplicator(dedupConfig)
+	}
+	processor := counter.NewProcessor(counterState, dedup, logger)
+	processor.RegisterMetrics(metricRegistry)
+	stats := counter.NewStats()
+	stats.RegisterMetrics(metricRegistry)
+	processor.AddResultListener(stats.Record)
+
+	// Answer messages that carry a reply channel
+	replyEncoder, err := message.DefaultRegistry().Lookup(*replyCodec)
+	if err != nil {
+		return err
+	}
+	replySender := aeron.NewReplySender(aeronClient, config, replyEncoder, logger)
+	replySender.RegisterMetrics(metricRegistry)
+	replySender.Start(ctx)
+
+	// Apply messages for different counters on parallel workers
+	handle := aeron.ContinueOnError(processor.Handle)
+	quiesce := func(fn func()) { fn() }
+	var dispatcher *aeron.Dispatcher
+	if config.Dispatch.Workers > 1 {
+		dispatcher = aeron.NewDispatcher(config.Dispatch, counter.PartitionKey, handle, logger)
+		dispatcher.RegisterMetrics(metricRegistry)
+		handle = dispatcher.Handle
+		quiesce = dispatcher.Quiesce
+	}
+
+	// Restore the last snapshot before any message is applied
+	var snapshotter *counter.Snapshotter
+	if *snapshotDir != "" {
+		store, err := snapshot.NewStore(*snapshotDir, "counter.snapshot")
+		if err != nil {
+			return fmt.Errorf("failed to open snapshot store: %w", err)
+		}
+		snapshotter = counter.NewSnapshotter(processor, store, *snapshotInterval, logger)
+		if _, err := snapshotter.Restore(); err != nil {
+			return fmt.Errorf("failed to restore snapshot %s: %w", store.Path(), err)
+		}
+		snapshotter.SetBarrier(quiesce)
+		snapshotter.Start(ctx)
+	}
 
 	// Initialize subscriber
 	subscriber, err := aeron.NewSubscriber(
 		aeronClient,
-		config.Channel,
-		config.StreamID,
-		processor.Handle,
+		config,
+		message.DefaultRegistry(),
+		handle,
 		logger,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create subscriber: %w", err)
 	}
 	defer subscriber.Close()
+	subscriber.RegisterMetrics(metricRegistry)
+	// Sessions of publishers that went away would otherwise be listed forever
+	subscriber.AddSessionFlushHook(stats.Forget)
+	subscriber.SetFlushBarrier(quiesce)
+
+	if deadLetterConfig.Dir != "" {
+		deadLetters, err := deadletter.OpenFileStore(deadLetterConfig)
+		if err != nil {
+			return fmt.Errorf("failed to open dead-letter store: %w", err)
+		}
+		defer deadLetters.Close()
+		subscriber.SetDeadLetterSink(deadLetters)
+	}
+
+	if dispatcher != nil {
+		dispatcher.SetFailureHandler(subscriber.DeadLetterMessage)
+		dispatcher.Start()
+		defer dispatcher.Close()
+	}
+
+	// Rebuild everything after the snapshot from the archive before going live
+	if config.Archive.Enabled {
+		replayer, err := aeron.NewReplayer(config, logger)
+		if err != nil {
+			return err
+		}
+		defer replayer.Close()
+
+		if err := replayer.EnsureRecording(); err != nil {
+			return err
+		}
+		if _, err := replayer.Replay(ctx, subscriber, processor.Positions()); err != nil {
+			if signalCtx.Err() != nil {
+				logger.Info("shutdown signal received during replay")
+				return nil
+			}
+			return fmt.Errorf("failed to replay archive: %w", err)
+		}
+	}
+	// Replayed messages may still be queued on the workers
+	quiesce(func() { subscriber.SkipThrough(processor.Positions()) })
+
+	// Replayed messages were answered when they first arrived; windows
+	// cover events received live since startup
+	processor.AddResultListener(counter.ReplyListener(replySender.Send))
+	windows := counter.NewWindowAggregator(windowConfig)
+	windows.RegisterMetrics(metricRegistry)
+	processor.AddResultListener(windows.Record)
 
 	// Start subscriber polling loop
 	subscriber.Start(ctx)
 
 	logger.Info("subscriber started, waiting for messages...")
 
+	// Setup HTTP handlers
+	counterHandler := handler.NewCounterHandler(counterState, processor, logger)
+	statsHandler := handler.NewStatsHandler(stats, logger)
+	windowHandler := handler.NewWindowHandler(windows, logger)
+	publishersHandler := handler.NewPublishersHandler(subscriber, logger)
+	healthHandler := handler.NewHealthHandler()
+	healthHandler.AddLivenessCheck("aeron", handler.ClientCheck(driverMonitor))
+	healthHandler.AddReadinessCheck("driver", handler.DriverCheck(driverMonitor))
+	healthHandler.AddReadinessCheck("subscription", handler.SubscriptionCheck(subscriber))
+
+	// Setup HTTP routes
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/counter", counterHandler.Get)
+	mux.HandleFunc("GET /api/counters", counterHandler.List)
+	mux.HandleFunc("GET /api/counters/{name}", counterHandler.GetNamed)
+	mux.HandleFunc("GET /api/stats", statsHandler.Get)
+	mux.HandleFunc("GET /api/stats/sources/{source}", statsHandler.GetSource)
+	mux.HandleFunc("GET /api/publishers", publishersHandler.List)
+	mux.HandleFunc("GET /api/gaps", publishersHandler.Gaps)
+	mux.HandleFunc("GET /api/windows", windowHandler.List)
+	mux.HandleFunc("GET /api/windows/{size}", windowHandler.Get)
+	mux.HandleFunc("GET /api/windows/{size}/sliding", windowHandler.Sliding)
+	mux.Handle("GET /metrics", metricRegistry.Handler())
+	mux.HandleFunc("GET /health", healthHandler.Health)
+	mux.HandleFunc("GET /ready", healthHandler.Ready)
+
+	// Create HTTP server
+	server := &http.Server{
+		Addr:         *httpAddr,
+		Handler:      handler.NewHTTPMetrics(metricRegistry).Wrap(mux),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 30 * time.Second,
+	}
+
+	// Start HTTP server
+	go func() {
+		logger.Info("starting HTTP server", "addr", *httpAddr)
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			logger.Error("HTTP server error", "error", err)
+			cancel()
+		}
+	}()
+
 	// Wait for shutdown signal
-	select {
-	case <-sigChan:
+	<-ctx.Done()
+	if signalCtx.Err() != nil {
 		logger.Info("shutdown signal received")
-	case <-ctx.Done():
+	}
+
+	// Graceful shutdown
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer shutdownCancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Error("server shutdown error", "error", err)
+	}
+
+	// Stop polling and write a final snapshot
+	cancel()
+	replySender.Close()
+	if snapshotter != nil {
+		if err := snapshotter.Close(); err != nil {
+			logger.Error("final snapshot error", "error", err)
+		}
 	}
 
 	logger.Info("subscriber shutdown complete")
 	return nil
 }
+
+// formatDurations joins durations with commas, for flag defaults
+func formatDurations(durations []time.Duration) string {
+	parts := make([]string, len(durations))
+	for i, d := range durations {
+		parts[i] = d.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// parseList splits a comma-separated flag, skipping empty entries
+func parseList(s string) []string {
+	var list []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			list = append(list, part)
+		}
+	}
+	return list
+}
+
+// parseDurations parses a comma-separated list of positive durations
+func parseDurations(s string) ([]time.Duration, error) {
+	var durations []time.Duration
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		d, err := time.ParseDuration(part)
+		if err != nil {
+			return nil, err
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("duration %s must be positive", d)
+		}
+		durations = append(durations, d)
+	}
+	return durations, nil
+}
@@ -0,0 +1,385 @@
+package aeron
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/k-omotani/aeron-sample/internal/message"
+)
+
+var (
+	ErrQueueFull       = errors.New("publish queue full")
+	ErrDropped         = errors.New("message dropped from publish queue")
+	ErrPublisherClosed = errors.New("publisher closed")
+)
+
+// OverflowPolicy decides what PublishAsync does when the queue is full
+type OverflowPolicy uint8
+
+const (
+	// OverflowBlock waits for space until the caller's context is done
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest discards the message being enqueued
+	OverflowDropNewest
+	// OverflowDropOldest evicts the oldest queued message to make room
+	OverflowDropOldest
+	// OverflowFailFast returns ErrQueueFull to the caller
+	OverflowFailFast
+)
+
+// String returns the flag name of the policy
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowDropNewest:
+		return "drop-newest"
+	case OverflowDropOldest:
+		return "drop-oldest"
+	case OverflowFailFast:
+		return "fail-fast"
+	default:
+		return fmt.Sprintf("overflow(%d)", uint8(p))
+	}
+}
+
+// ParseOverflowPolicy parses a policy name as returned by String
+func ParseOverflowPolicy(name string) (OverflowPolicy, error) {
+	for _, p := range []OverflowPolicy{OverflowBlock, OverflowDropNewest, OverflowDropOldest, OverflowFailFast} {
+		if p.String() == name {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown overflow policy %q", name)
+}
+
+// AsyncConfig configures an AsyncPublisher
+type AsyncConfig struct {
+	// QueueSize is the capacity of the ring buffer
+	QueueSize int
+	// MaxBatch is the most messages coalesced into one frame
+	MaxBatch int
+	// Overflow is applied when the queue is full
+	Overflow OverflowPolicy
+	// PublishTimeout bounds how long the sender retries one frame
+	PublishTimeout time.Duration
+}
+
+// PublishFuture completes once the message has been published, given up on
+// or dropped from a full queue
+type PublishFuture struct {
+	done     chan struct{}
+	err      error
+	callback func(error)
+}
+
+func newPublishFuture(callback func(error)) *PublishFuture {
+	return &PublishFuture{
+		done:     make(chan struct{}),
+		callback: callback,
+	}
+}
+
+// Done is closed when the outcome is known
+func (f *PublishFuture) Done() <-chan struct{} {
+	return f.done
+}
+
+// Err returns the outcome; it is only meaningful after Done is closed
+func (f *PublishFuture) Err() error {
+	return f.err
+}
+
+// Wait blocks until the outcome is known or ctx is done
+func (f *PublishFuture) Wait(ctx context.Context) error {
+	select {
+	case <-f.done:
+		return f.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (f *PublishFuture) complete(err error) {
+	f.err = err
+	close(f.done)
+	if f.callback != nil {
+		f.callback(err)
+	}
+}
+
+type asyncItem struct {
+	msg    *message.Message
+	future *PublishFuture
+}
+
+// AsyncPublisher queues messages in a bounded ring buffer and publishes
+// them from a single sender goroutine, so callers never sit in the offer
+// retry loop. Consecutive queued messages are coalesced into one batch
+// frame when they fit in a single Aeron frame together.
+type AsyncPublisher struct {
+	publisher *Publisher
+	config    AsyncConfig
+	logger    *slog.Logger
+
+	mu     sync.Mutex
+	ring   []asyncItem
+	head   int
+	count  int
+	closed bool
+
+	notEmpty chan struct{}
+	notFull  chan struct{}
+	stopped  chan struct{}
+}
+
+// NewAsyncPublisher creates an AsyncPublisher in front of publisher
+func NewAsyncPublisher(publisher *Publisher, config AsyncConfig, logger *slog.Logger) *AsyncPublisher {
+	if config.QueueSize < 1 {
+		config.QueueSize = 1
+	}
+	if config.MaxBatch < 1 {
+		config.MaxBatch = 1
+	}
+	return &AsyncPublisher{
+		publisher: publisher,
+		config:    config,
+		logger:    logger.With("component", "async-publisher"),
+		ring:      make([]asyncItem, config.QueueSize),
+		notEmpty:  make(chan struct{}, 1),
+		notFull:   make(chan struct{}, 1),
+		stopped:   make(chan struct{}),
+	}
+}
+
+// Start launches the sender goroutine
+func (a *AsyncPublisher) Start(ctx context.Context) {
+	go a.sendLoop(ctx)
+}
+
+// PublishAsync enqueues msg and returns a future for its outcome.
+// callback, if non-nil, is invoked once on completion: from the sender
+// goroutine for messages it publishes or gives up on, but from a producer
+// for messages dropped on overflow. Under OverflowDropNewest that is this
+// call, before it returns; under OverflowDropOldest it is the PublishAsync
+// call that evicted the message. The returned error reports enqueue
+// failures only.
+func (a *AsyncPublisher) PublishAsync(ctx context.Context, msg *message.Message, callback func(error)) (*PublishFuture, error) {
+	future := newPublishFuture(callback)
+	item := asyncItem{msg: msg, future: future}
+
+	for {
+		a.mu.Lock()
+		if a.closed {
+			a.mu.Unlock()
+			return nil, ErrPublisherClosed
+		}
+
+		if a.count < len(a.ring) {
+			a.push(item)
+			hasSpace := a.count < len(a.ring)
+			a.mu.Unlock()
+			signal(a.notEmpty)
+			if hasSpace {
+				// Pass the wakeup on to the next blocked producer
+				signal(a.notFull)
+			}
+			return future, nil
+		}
+
+		switch a.config.Overflow {
+		case OverflowDropNewest:
+			a.mu.Unlock()
+			future.complete(ErrDropped)
+			return future, nil
+		case OverflowDropOldest:
+			evicted := a.pop()
+			a.push(item)
+			a.mu.Unlock()
+			evicted.future.complete(ErrDropped)
+			signal(a.notEmpty)
+			return future, nil
+		case OverflowFailFast:
+			a.mu.Unlock()
+			return nil, ErrQueueFull
+		}
+
+		a.mu.Unlock()
+		select {
+		case <-a.notFull:
+		case <-a.stopped:
+			return nil, ErrPublisherClosed
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Len returns the number of queued messages
+func (a *AsyncPublisher) Len() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.count
+}
+
+// Close stops accepting messages and waits until the queue has drained or
+// ctx is done
+func (a *AsyncPublisher) Close(ctx context.Context) error {
+	a.mu.Lock()
+	a.closed = true
+	a.mu.Unlock()
+	signal(a.notEmpty)
+
+	select {
+	case <-a.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// push and pop must be called with mu held
+func (a *AsyncPublisher) push(item asyncItem) {
+	a.ring[(a.head+a.count)%len(a.ring)] = item
+	a.count++
+}
+
+func (a *AsyncPublisher) pop() asyncItem {
+	item := a.ring[a.head]
+	a.ring[a.head] = asyncItem{}
+	a.head = (a.head + 1) % len(a.ring)
+	a.count--
+	return item
+}
+
+// take removes up to max items from the front of the queue
+func (a *AsyncPublisher) take(max int) ([]asyncItem, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	n := min(a.count, max)
+	items := make([]asyncItem, n)
+	for i := range items {
+		items[i] = a.pop()
+	}
+	return items, a.closed && a.count == 0
+}
+
+func (a *AsyncPublisher) sendLoop(ctx context.Context) {
+	defer close(a.stopped)
+	a.logger.Info("async publisher started",
+		"queueSize", a.config.QueueSize,
+		"maxBatch", a.config.MaxBatch,
+		"overflow", a.config.Overflow,
+	)
+
+	for {
+		items, drained := a.take(a.config.MaxBatch)
+		if len(items) > 0 {
+			signal(a.notFull)
+			a.send(ctx, items)
+			continue
+		}
+		if drained {
+			a.logger.Info("async publisher drained")
+			return
+		}
+
+		select {
+		case <-a.notEmpty:
+		case <-ctx.Done():
+			a.failPending(ctx.Err())
+			a.logger.Info("async publisher stopping")
+			return
+		}
+	}
+}
+
+// send encodes items and publishes them, coalescing as many consecutive
+// frames as fit within one Aeron frame. Messages are numbered on the
+// assumption that every frame gets through; the publisher renumbers them
+// if that turns out wrong, so batches leave room for wider sequences.
+func (a *AsyncPublisher) send(ctx context.Context, items []asyncItem) {
+	codec := a.publisher.Codec()
+	maxFrame := a.publisher.maxClaimLength
+	sequence := a.publisher.nextSequence()
+
+	frames := make([][]byte, 0, len(items))
+	msgs := make([]*message.Message, 0, len(items))
+	pending := make([]asyncItem, 0, len(items))
+	for _, item := range items {
+		item.msg.Sequence = sequence
+		frame, err := message.Marshal(codec, item.msg)
+		if err != nil {
+			item.future.complete(err)
+			continue
+		}
+		sequence++
+		frames = append(frames, frame)
+		msgs = append(msgs, item.msg)
+		pending = append(pending, item)
+	}
+
+	for start := 0; start < len(frames); {
+		end := batchEnd(frames, start, maxFrame)
+		frame := frames[start]
+		if end-start > 1 {
+			frame = message.AppendBatch(nil, frames[start:end]...)
+		}
+
+		sendCtx, cancel := context.WithTimeout(ctx, a.config.PublishTimeout)
+		err := a.publisher.publishFrame(sendCtx, frame, msgs[start:end])
+		cancel()
+		if err != nil {
+			a.logger.Error("async publish failed", "error", err, "messages", end-start)
+		}
+		for _, item := range pending[start:end] {
+			item.future.complete(err)
+		}
+		start = end
+	}
+}
+
+// batchEnd returns the end of the batch that starts at frames[start]: as
+// many frames as still fit within maxFrame when each is renumbered with the
+// widest sequence. A frame that does not fit with others is sent alone.
+func batchEnd(frames [][]byte, start int, maxFrame int32) int {
+	end := start + 1
+	length := message.BatchLength(len(frames[start])) + message.MaxSequenceGrowth
+	for end < len(frames) {
+		entry := message.BatchEntryLength(len(frames[end])) + message.MaxSequenceGrowth
+		if length+entry > maxFrame {
+			break
+		}
+		length += entry
+		end++
+	}
+	return end
+}
+
+// failPending completes every queued message with err
+func (a *AsyncPublisher) failPending(err error) {
+	a.mu.Lock()
+	a.closed = true
+	var items []asyncItem
+	for a.count > 0 {
+		items = append(items, a.pop())
+	}
+	a.mu.Unlock()
+
+	for _, item := range items {
+		item.future.complete(err)
+	}
+}
+
+// signal performs a non-blocking send on a wakeup channel
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
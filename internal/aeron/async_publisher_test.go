@@ -0,0 +1,93 @@
+package aeron
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/k-omotani/aeron-sample/internal/message"
+)
+
+func TestBatchEndLeavesRoomForRenumbering(t *testing.T) {
+	const maxFrame = 1024
+	for _, codec := range []message.Codec{message.NewJSONCodec(), message.NewBinaryCodec(), message.NewMsgPackCodec(), message.NewProtobufCodec()} {
+		t.Run(codec.Name(), func(t *testing.T) {
+			msgs := make([]*message.Message, 40)
+			frames := make([][]byte, len(msgs))
+			for i := range msgs {
+				msgs[i] = benchmarkMessage()
+				msgs[i].Sequence = uint64(i + 1)
+				frame, err := message.Marshal(codec, msgs[i])
+				if err != nil {
+					t.Fatal(err)
+				}
+				frames[i] = frame
+			}
+
+			for start := 0; start < len(frames); {
+				end := batchEnd(frames, start, maxFrame)
+				if end <= start {
+					t.Fatalf("batchEnd(%d) = %d", start, end)
+				}
+				if end-start == 1 {
+					start = end
+					continue
+				}
+				// The publisher renumbers a batch when other publishes took its sequences
+				renumbered := make([][]byte, 0, end-start)
+				for i, msg := range msgs[start:end] {
+					wide := *msg
+					wide.Sequence = math.MaxUint64 - uint64(end-start-i)
+					frame, err := message.Marshal(codec, &wide)
+					if err != nil {
+						t.Fatal(err)
+					}
+					renumbered = append(renumbered, frame)
+				}
+				if n := len(message.AppendBatch(nil, renumbered...)); n > maxFrame {
+					t.Errorf("batch %d:%d is %d bytes once renumbered, more than %d", start, end, n, maxFrame)
+				}
+				start = end
+			}
+		})
+	}
+}
+
+func TestOverflowCallbacksRunOnProducer(t *testing.T) {
+	tests := []struct {
+		policy  OverflowPolicy
+		dropped int // index of the message dropped by the second PublishAsync
+	}{
+		{OverflowDropNewest, 1},
+		{OverflowDropOldest, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			// No sender is started, so one message fills the queue
+			a := NewAsyncPublisher(nil, AsyncConfig{QueueSize: 1, Overflow: tt.policy}, discardLogger())
+			var called [2]error
+			var futures [2]*PublishFuture
+			for i := range futures {
+				future, err := a.PublishAsync(context.Background(), benchmarkMessage(), func(err error) { called[i] = err })
+				if err != nil {
+					t.Fatalf("PublishAsync %d: %v", i, err)
+				}
+				futures[i] = future
+			}
+
+			// The callback ran before the second PublishAsync returned
+			if !errors.Is(called[tt.dropped], ErrDropped) {
+				t.Errorf("callback of message %d got %v, want ErrDropped", tt.dropped, called[tt.dropped])
+			}
+			select {
+			case <-futures[tt.dropped].Done():
+			default:
+				t.Errorf("future of message %d not done", tt.dropped)
+			}
+			if kept := 1 - tt.dropped; called[kept] != nil || a.Len() != 1 {
+				t.Errorf("message %d completed with %v, queue holds %d", kept, called[kept], a.Len())
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package aeron
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// CircuitOpenError is returned while the breaker rejects publishes.
+// It matches ErrCircuitOpen with errors.Is.
+type CircuitOpenError struct {
+	// RetryAfter is how long until the breaker lets a probe through
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrCircuitOpen, e.RetryAfter.Round(time.Millisecond))
+}
+
+func (e *CircuitOpenError) Unwrap() error {
+	return ErrCircuitOpen
+}
+
+// CircuitState is the state of a CircuitBreaker
+type CircuitState uint8
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+// String returns the state name
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("state(%d)", uint8(s))
+	}
+}
+
+// BreakerConfig configures a CircuitBreaker
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive failed publishes that open the circuit
+	FailureThreshold int
+	// NotConnectedTimeout opens the circuit once the publication has reported
+	// NotConnected continuously for this long
+	NotConnectedTimeout time.Duration
+	// OpenDuration is how long the circuit stays open before probing
+	OpenDuration time.Duration
+	// HalfOpenProbes is the number of publishes let through while half-open
+	HalfOpenProbes int
+}
+
+// BreakerStatus is a point-in-time view of a CircuitBreaker
+type BreakerStatus struct {
+	State               CircuitState
+	ConsecutiveFailures int
+	OpenedAt            time.Time
+	RetryAfter          time.Duration
+}
+
+// CircuitBreaker stops publishes from waiting on a publication that is
+// known to be down. It opens after FailureThreshold consecutive failures or
+// a sustained NotConnected, rejects publishes for OpenDuration, then lets a
+// few probes through half-open: one success closes it, one failure reopens it.
+type CircuitBreaker struct {
+	config BreakerConfig
+	now    func() time.Time
+	logger *slog.Logger
+
+	mu                sync.Mutex
+	state             CircuitState
+	failures          int
+	openedAt          time.Time
+	probes            int
+	notConnectedSince time.Time
+}
+
+// NewCircuitBreaker creates a closed circuit breaker
+func NewCircuitBreaker(config BreakerConfig, logger *slog.Logger) *CircuitBreaker {
+	if config.HalfOpenProbes < 1 {
+		config.HalfOpenProbes = 1
+	}
+	return &CircuitBreaker{
+		config: config,
+		now:    time.Now,
+		logger: logger.With("component", "circuit-breaker"),
+	}
+}
+
+// Allow reserves a publish attempt, or returns a *CircuitOpenError.
+// Every nil return must be followed by exactly one call to Record.
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.advance()
+	switch b.state {
+	case CircuitOpen:
+		return b.openError()
+	case CircuitHalfOpen:
+		if b.probes >= b.config.HalfOpenProbes {
+			return &CircuitOpenError{RetryAfter: b.config.OpenDuration}
+		}
+		b.probes++
+	}
+	return nil
+}
+
+// Check reports whether a publish would currently be rejected, without
+// reserving a probe
+func (b *CircuitBreaker) Check() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.advance()
+	if b.state == CircuitOpen {
+		return b.openError()
+	}
+	return nil
+}
+
+// Record reports the outcome of an attempt reserved with Allow.
+// Offer failures count against the circuit; other errors, such as a
+// cancelled request, only release the reservation. Any outcome other than
+// NotConnected ends a disconnected spell.
+func (b *CircuitBreaker) Record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == CircuitHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+
+	var offerErr *OfferError
+	isOfferErr := errors.As(err, &offerErr)
+	if !isOfferErr || offerErr.Class() != FailureNotConnected {
+		b.notConnectedSince = time.Time{}
+	}
+
+	switch {
+	case err == nil:
+		b.failures = 0
+		if b.state != CircuitClosed {
+			b.transition(CircuitClosed)
+		}
+	case isOfferErr:
+		b.failures++
+		switch {
+		case b.state == CircuitHalfOpen:
+			b.open("probe failed")
+		case b.state == CircuitClosed && b.failures >= b.config.FailureThreshold:
+			b.open("consecutive failures")
+		}
+	}
+}
+
+// NotConnected records a NotConnected offer result and reports whether the
+// publication has now been disconnected for longer than NotConnectedTimeout,
+// in which case the circuit is opened.
+func (b *CircuitBreaker) NotConnected() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	if b.notConnectedSince.IsZero() {
+		b.notConnectedSince = now
+		return false
+	}
+	if now.Sub(b.notConnectedSince) < b.config.NotConnectedTimeout {
+		return false
+	}
+	if b.state != CircuitOpen {
+		b.open("not connected")
+	}
+	return true
+}
+
+// Connected records an offer result other than NotConnected, which shows
+// the publication is connected again
+func (b *CircuitBreaker) Connected() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.notConnectedSince = time.Time{}
+}
+
+// Status returns the current breaker state
+func (b *CircuitBreaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.advance()
+	status := BreakerStatus{
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		OpenedAt:            b.openedAt,
+	}
+	if b.state == CircuitOpen {
+		status.RetryAfter = b.retryAfter()
+	}
+	return status
+}
+
+// advance moves an open circuit to half-open once OpenDuration has passed.
+// Must be called with mu held.
+func (b *CircuitBreaker) advance() {
+	if b.state == CircuitOpen && b.retryAfter() <= 0 {
+		b.transition(CircuitHalfOpen)
+		b.probes = 0
+	}
+}
+
+func (b *CircuitBreaker) open(reason string) {
+	b.openedAt = b.now()
+	b.probes = 0
+	b.transition(CircuitOpen, "reason", reason, "failures", b.failures)
+}
+
+func (b *CircuitBreaker) transition(to CircuitState, attrs ...any) {
+	from := b.state
+	b.state = to
+	attrs = append([]any{"from", from, "to", to}, attrs...)
+	if to == CircuitOpen {
+		b.logger.Warn("circuit state changed", attrs...)
+		return
+	}
+	b.logger.Info("circuit state changed", attrs...)
+}
+
+func (b *CircuitBreaker) retryAfter() time.Duration {
+	return b.config.OpenDuration - b.now().Sub(b.openedAt)
+}
+
+func (b *CircuitBreaker) openError() error {
+	return &CircuitOpenError{RetryAfter: b.retryAfter()}
+}
@@ -0,0 +1,81 @@
+package aeron
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	aeronlib "github.com/lirm/aeron-go/aeron"
+)
+
+// fakeClock is a settable time source for a CircuitBreaker
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestBreaker() (*CircuitBreaker, *fakeClock) {
+	clock := &fakeClock{t: time.Unix(1_700_000_000, 0)}
+	b := NewCircuitBreaker(BreakerConfig{
+		FailureThreshold:    100,
+		NotConnectedTimeout: time.Second,
+		OpenDuration:        time.Minute,
+	}, discardLogger())
+	b.now = clock.now
+	return b, clock
+}
+
+func TestBreakerNotConnectedResets(t *testing.T) {
+	notConnected := &OfferError{Code: aeronlib.NotConnected, Attempts: 3}
+	tests := []struct {
+		name  string
+		reset func(b *CircuitBreaker)
+	}{
+		{"success", func(b *CircuitBreaker) { b.Record(nil) }},
+		{"back pressured", func(b *CircuitBreaker) { b.Record(&OfferError{Code: aeronlib.BackPressured, Attempts: 3}) }},
+		{"admin action", func(b *CircuitBreaker) { b.Record(&OfferError{Code: aeronlib.AdminAction, Attempts: 1}) }},
+		{"cancelled", func(b *CircuitBreaker) { b.Record(context.Canceled) }},
+		{"connected offer", func(b *CircuitBreaker) { b.Connected() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, clock := newTestBreaker()
+			if b.NotConnected() {
+				t.Fatal("first NotConnected opened the circuit")
+			}
+			b.Record(notConnected)
+			clock.advance(900 * time.Millisecond)
+
+			tt.reset(b)
+
+			// A new disconnected spell starts from here, not from the first one
+			clock.advance(200 * time.Millisecond)
+			if b.NotConnected() {
+				t.Fatal("NotConnected after a reset opened the circuit")
+			}
+			clock.advance(900 * time.Millisecond)
+			if b.NotConnected() {
+				t.Fatal("circuit opened before NotConnectedTimeout of the new spell")
+			}
+			clock.advance(200 * time.Millisecond)
+			if !b.NotConnected() {
+				t.Fatal("circuit still closed after NotConnectedTimeout")
+			}
+			if err := b.Check(); !errors.Is(err, ErrCircuitOpen) {
+				t.Errorf("Check = %v, want ErrCircuitOpen", err)
+			}
+		})
+	}
+}
+
+func TestBreakerNotConnectedSpansRecords(t *testing.T) {
+	b, clock := newTestBreaker()
+	b.NotConnected()
+	// A publish that gave up while still disconnected keeps the spell going
+	b.Record(&OfferError{Code: aeronlib.NotConnected, Attempts: 3})
+	clock.advance(1100 * time.Millisecond)
+	if !b.NotConnected() {
+		t.Error("circuit still closed after NotConnectedTimeout across publishes")
+	}
+}
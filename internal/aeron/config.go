@@ -2,8 +2,18 @@ package aeron
 
 import (
 	"time"
+
+	"github.com/lirm/aeron-go/aeron/logbuffer"
+
+	"github.com/k-omotani/aeron-sample/internal/message"
 )
 
+// DefaultMTULength matches aeron.mtu.length in scripts/aeron-entrypoint.sh
+const DefaultMTULength int32 = 1408
+
+// CodecAuto lets a subscriber accept frames from any registered codec
+const CodecAuto = "auto"
+
 // Config holds Aeron-related configuration
 type Config struct {
 	// AeronDir is the media driver directory
@@ -17,16 +27,79 @@ type Config struct {
 	// StreamID for the counter messages
 	StreamID int32
 
+	// Codec is the message codec name ("binary", "json", "msgpack", "protobuf").
+	// Publishers encode with it; subscribers only accept frames written with it,
+	// or any registered codec when set to CodecAuto.
+	Codec string
+
+	// MaxClaimLength is the largest frame, in bytes, the publisher encodes
+	// in place with TryClaim. It must not exceed the driver MTU minus the
+	// 32-byte data frame header; larger frames fall back to Offer.
+	MaxClaimLength int32
+
+	// Retry controls how the publisher retries failed offers
+	Retry RetryPolicy
+
+	// Breaker controls when the publisher stops trying and fails fast
+	Breaker BreakerConfig
+
+	// Async configures the queued publisher used for fire-and-forget publishes
+	Async AsyncConfig
+
+	// MaxMessageSize is the largest message, in bytes, the subscriber will
+	// reassemble from fragments. Larger messages are dropped and counted.
+	MaxMessageSize int32
+
+	// Poll configures the subscriber poll loop
+	Poll PollConfig
+
+	// Dispatch configures parallel handling of received messages
+	Dispatch DispatchConfig
+
+	// Archive configures recording and startup replay on the subscriber
+	Archive ArchiveConfig
+
+	// Reply configures the reply stream from the subscriber to publishers
+	Reply ReplyConfig
+
 	// Timeouts
 	MediaDriverTimeout time.Duration
 }
 
+// ResolveCodec looks up the configured codec in registry.
+// It returns nil for CodecAuto.
+func (c *Config) ResolveCodec(registry *message.Registry) (message.Codec, error) {
+	if c.Codec == CodecAuto {
+		return nil, nil
+	}
+	return registry.Lookup(c.Codec)
+}
+
 // DefaultPublisherConfig returns config for publisher (sends to subscriber)
 func DefaultPublisherConfig() *Config {
 	return &Config{
-		AeronDir:           "/dev/shm/aeron",
-		Channel:            "aeron:udp?endpoint=subscriber-driver:40123",
-		StreamID:           1001,
+		AeronDir:       "/dev/shm/aeron",
+		Channel:        "aeron:udp?endpoint=subscriber-driver:40123",
+		StreamID:       1001,
+		Codec:          "binary",
+		MaxClaimLength: DefaultMTULength - logbuffer.DataFrameHeader.Length,
+		Retry:          DefaultRetryPolicy(),
+		Breaker: BreakerConfig{
+			FailureThreshold:    5,
+			NotConnectedTimeout: time.Second,
+			OpenDuration:        5 * time.Second,
+			HalfOpenProbes:      1,
+		},
+		Async: AsyncConfig{
+			QueueSize:      1024,
+			MaxBatch:       32,
+			Overflow:       OverflowBlock,
+			PublishTimeout: 5 * time.Second,
+		},
+		MaxMessageSize: 1 << 20,
+		Reply: ReplyConfig{
+			StreamID: 1003,
+		},
 		MediaDriverTimeout: 10 * time.Second,
 	}
 }
@@ -34,9 +107,36 @@ func DefaultPublisherConfig() *Config {
 // DefaultSubscriberConfig returns config for subscriber (listens on UDP)
 func DefaultSubscriberConfig() *Config {
 	return &Config{
-		AeronDir:           "/dev/shm/aeron",
-		Channel:            "aeron:udp?endpoint=0.0.0.0:40123",
-		StreamID:           1001,
+		AeronDir:       "/dev/shm/aeron",
+		Channel:        "aeron:udp?endpoint=0.0.0.0:40123",
+		StreamID:       1001,
+		Codec:          CodecAuto,
+		MaxMessageSize: 1 << 20,
+		Poll: PollConfig{
+			FragmentLimit: 10,
+			Idle:          IdleSleeping,
+			SleepFor:      time.Millisecond,
+		},
+		Dispatch: DispatchConfig{
+			Workers:   1,
+			QueueSize: 256,
+		},
+		Archive: ArchiveConfig{
+			ControlChannel:   "aeron:udp?endpoint=localhost:8010",
+			ControlStreamID:  10,
+			ResponseChannel:  "aeron:udp?endpoint=localhost:0",
+			ResponseStreamID: 20,
+			ReplayChannel:    "aeron:ipc",
+			ReplayStreamID:   1002,
+			Timeout:          5 * time.Second,
+			ImageTimeout:     10 * time.Second,
+		},
+		Reply: ReplyConfig{
+			QueueSize:              1024,
+			SendTimeout:            time.Second,
+			MaxPublications:        64,
+			PublicationIdleTimeout: 5 * time.Minute,
+		},
 		MediaDriverTimeout: 10 * time.Second,
 	}
 }
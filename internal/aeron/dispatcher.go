@@ -0,0 +1,209 @@
+package aeron
+
+import (
+	"hash/fnv"
+	"log/slog"
+	"sync"
+
+	"github.com/k-omotani/aeron-sample/internal/message"
+)
+
+// KeyFunc returns the partition key of a message. Messages with the same
+// key are handled in order by one worker. An empty key orders the message
+// against every key: it is handled on the poll goroutine once all workers
+// are idle.
+type KeyFunc func(msg *message.Message) string
+
+// FailureHandler is told about messages a worker's handler failed
+type FailureHandler func(msg *message.Message, err error)
+
+// DispatchConfig configures parallel message handling on the subscriber
+type DispatchConfig struct {
+	// Workers is the number of handler goroutines; 1 or less handles
+	// messages on the poll goroutine
+	Workers int
+	// QueueSize is the most messages waiting per worker before the
+	// dispatcher aborts new ones, holding the poll loop back
+	QueueSize int
+}
+
+// Dispatcher fans messages out to worker goroutines partitioned by key,
+// keeping the order of each key while unrelated keys run in parallel.
+// Its Handle method is the subscriber's MessageHandler and must only be
+// called from the poll goroutine.
+type Dispatcher struct {
+	handler MessageHandler
+	key     KeyFunc
+	logger  *slog.Logger
+	queues  []chan *message.Message
+	failed  FailureHandler
+	metrics *dispatcherMetrics
+
+	mu      sync.Mutex
+	idle    *sync.Cond // signalled when pending drops to zero
+	pending int        // messages queued or being handled by workers
+	paused  int        // Quiesce calls holding new messages back
+	closed  bool
+
+	stop    chan struct{}
+	stopped sync.WaitGroup
+}
+
+// NewDispatcher creates a dispatcher running handler on config.Workers
+// goroutines, partitioned by key
+func NewDispatcher(config DispatchConfig, key KeyFunc, handler MessageHandler, logger *slog.Logger) *Dispatcher {
+	workers := max(config.Workers, 1)
+	queueSize := max(config.QueueSize, 1)
+	d := &Dispatcher{
+		handler: handler,
+		key:     key,
+		logger:  logger.With("component", "dispatcher"),
+		queues:  make([]chan *message.Message, workers),
+		stop:    make(chan struct{}),
+	}
+	d.idle = sync.NewCond(&d.mu)
+	for i := range d.queues {
+		d.queues[i] = make(chan *message.Message, queueSize)
+	}
+	return d
+}
+
+// SetFailureHandler sets where messages a worker failed are reported, in
+// addition to the log. It must be called before Start.
+func (d *Dispatcher) SetFailureHandler(failed FailureHandler) {
+	d.failed = failed
+}
+
+// Start runs the workers until Close
+func (d *Dispatcher) Start() {
+	d.logger.Info("dispatcher started", "workers", len(d.queues), "queueSize", cap(d.queues[0]))
+	for i := range d.queues {
+		d.stopped.Add(1)
+		go d.work(d.queues[i])
+	}
+}
+
+// Handle queues msg for the worker owning its key. When that worker's
+// queue is full, or a Quiesce is in progress, the message is aborted so the
+// poll loop delivers it again later. The action a worker's handler returns
+// is ignored, as the message was consumed when it was queued.
+func (d *Dispatcher) Handle(msg *message.Message) (Action, error) {
+	key := d.key(msg)
+
+	d.mu.Lock()
+	if d.paused > 0 || d.closed {
+		d.mu.Unlock()
+		d.metrics.aborted("paused")
+		return ActionAbort, nil
+	}
+	if key == "" {
+		if d.pending > 0 {
+			d.mu.Unlock()
+			d.metrics.aborted("draining")
+			return ActionAbort, nil
+		}
+		// Nothing runs on the workers, and nothing is queued until the
+		// handler returns, since only the poll goroutine queues messages
+		d.mu.Unlock()
+		return d.handler(msg)
+	}
+
+	select {
+	case d.queues[partition(key, len(d.queues))] <- msg:
+		d.pending++
+		d.mu.Unlock()
+		return ActionContinue, nil
+	default:
+		d.mu.Unlock()
+		d.metrics.aborted("full")
+		return ActionAbort, nil
+	}
+}
+
+// Quiesce runs fn once every queued message has been handled, aborting new
+// messages until fn returns. Callers use it to read state that must cover
+// a whole prefix of the stream, such as a snapshot checkpoint.
+func (d *Dispatcher) Quiesce(fn func()) {
+	d.mu.Lock()
+	d.paused++
+	for d.pending > 0 {
+		d.idle.Wait()
+	}
+	d.mu.Unlock()
+
+	defer func() {
+		d.mu.Lock()
+		d.paused--
+		d.mu.Unlock()
+	}()
+	fn()
+}
+
+// Len returns the number of messages queued or being handled
+func (d *Dispatcher) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.pending
+}
+
+// Close stops taking messages, waits for the queued ones to be handled and
+// stops the workers
+func (d *Dispatcher) Close() {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return
+	}
+	d.closed = true
+	for d.pending > 0 {
+		d.idle.Wait()
+	}
+	d.mu.Unlock()
+
+	close(d.stop)
+	d.stopped.Wait()
+}
+
+func (d *Dispatcher) work(queue chan *message.Message) {
+	defer d.stopped.Done()
+	for {
+		select {
+		case msg := <-queue:
+			d.run(msg)
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) run(msg *message.Message) {
+	defer func() {
+		d.mu.Lock()
+		d.pending--
+		if d.pending == 0 {
+			d.idle.Broadcast()
+		}
+		d.mu.Unlock()
+	}()
+
+	if _, err := d.handler(msg); err != nil {
+		d.metrics.handlerFailed()
+		d.logger.Error("handler failed",
+			"error", err,
+			"type", msg.Type,
+			"requestID", msg.RequestID,
+			"sessionID", msg.SessionID,
+			"position", msg.Position,
+		)
+		if d.failed != nil {
+			d.failed(msg, err)
+		}
+	}
+}
+
+// partition maps key onto one of n workers
+func partition(key string, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(n))
+}
@@ -0,0 +1,223 @@
+package aeron
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/k-omotani/aeron-sample/internal/counter"
+	"github.com/k-omotani/aeron-sample/internal/message"
+)
+
+// deliver hands msg to the dispatcher the way the poll loop does,
+// redelivering it until it is not aborted
+func deliver(t *testing.T, d *Dispatcher, msg *message.Message) {
+	t.Helper()
+	for {
+		action, err := d.Handle(msg)
+		if err != nil {
+			t.Fatalf("Handle: %v", err)
+		}
+		if action != ActionAbort {
+			return
+		}
+		runtime.Gosched()
+	}
+}
+
+func increment(name string, session int32, position int64) *message.Message {
+	return &message.Message{
+		Type:      message.MessageTypeIncrement,
+		SessionID: session,
+		Position:  position,
+		Payload:   &message.IncrementPayload{Amount: 1, Name: name},
+	}
+}
+
+func TestDispatcherKeepsKeyOrder(t *testing.T) {
+	const (
+		keys     = 8
+		messages = 2000
+	)
+	var (
+		mu      sync.Mutex
+		order   = make(map[string][]int64)
+		handled int
+	)
+	handler := func(msg *message.Message) (Action, error) {
+		runtime.Gosched() // let the other workers interleave
+		mu.Lock()
+		defer mu.Unlock()
+		if msg.Type == message.MessageTypeReset {
+			// Unkeyed messages are ordered against every key
+			if want := int(msg.Position) - 1; handled != want {
+				t.Errorf("reset at %d ran after %d messages, want %d", msg.Position, handled, want)
+			}
+		} else {
+			name := msg.Payload.(*message.IncrementPayload).Name
+			order[name] = append(order[name], msg.Position)
+		}
+		handled++
+		return ActionContinue, nil
+	}
+	d := NewDispatcher(DispatchConfig{Workers: 4, QueueSize: 8}, counter.PartitionKey, handler, discardLogger())
+	d.Start()
+
+	for position := int64(1); position <= messages; position++ {
+		msg := increment(fmt.Sprintf("c%d", position%keys), 1, position)
+		if position%250 == 0 {
+			msg = &message.Message{Type: message.MessageTypeReset, SessionID: 1, Position: position, Payload: &message.ResetPayload{}}
+		}
+		deliver(t, d, msg)
+	}
+	d.Close()
+
+	if handled != messages {
+		t.Fatalf("handled %d messages, want %d", handled, messages)
+	}
+	for name, positions := range order {
+		for i := 1; i < len(positions); i++ {
+			if positions[i] <= positions[i-1] {
+				t.Fatalf("%s handled position %d after %d", name, positions[i], positions[i-1])
+			}
+		}
+	}
+}
+
+func TestDispatcherAbortsWhenQueueFull(t *testing.T) {
+	// Two keys owned by different workers
+	const workers = 2
+	blocked := "blocked"
+	other := ""
+	for i := 0; other == ""; i++ {
+		if key := fmt.Sprintf("other-%d", i); partition(key, workers) != partition(blocked, workers) {
+			other = key
+		}
+	}
+
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	var handled atomic.Int64
+	handler := func(msg *message.Message) (Action, error) {
+		if msg.Payload.(*message.IncrementPayload).Name == blocked {
+			select {
+			case started <- struct{}{}:
+			default:
+			}
+			<-release
+		}
+		handled.Add(1)
+		return ActionContinue, nil
+	}
+	d := NewDispatcher(DispatchConfig{Workers: workers, QueueSize: 2}, counter.PartitionKey, handler, discardLogger())
+	d.Start()
+
+	handle := func(msg *message.Message) Action {
+		t.Helper()
+		action, err := d.Handle(msg)
+		if err != nil {
+			t.Fatalf("Handle: %v", err)
+		}
+		return action
+	}
+
+	// The first message occupies the worker, the next two fill its queue
+	if action := handle(increment(blocked, 1, 1)); action != ActionContinue {
+		t.Fatalf("first message action = %d, want continue", action)
+	}
+	<-started
+	for position := int64(2); position <= 3; position++ {
+		if action := handle(increment(blocked, 1, position)); action != ActionContinue {
+			t.Fatalf("message %d action = %d, want continue", position, action)
+		}
+	}
+	if action := handle(increment(blocked, 1, 4)); action != ActionAbort {
+		t.Fatalf("message for a full queue action = %d, want abort", action)
+	}
+	if action := handle(increment(other, 1, 4)); action != ActionContinue {
+		t.Errorf("message for another worker action = %d, want continue", action)
+	}
+	reset := &message.Message{Type: message.MessageTypeReset, Payload: &message.ResetPayload{}}
+	if action := handle(reset); action != ActionAbort {
+		t.Errorf("unkeyed message while workers are busy action = %d, want abort", action)
+	}
+	if n := d.Len(); n < 3 {
+		t.Errorf("Len = %d, want at least the 3 blocked messages", n)
+	}
+
+	close(release)
+	deliver(t, d, increment(blocked, 1, 4))
+	d.Close()
+	if got := handled.Load(); got != 5 {
+		t.Errorf("handled %d messages, want 5", got)
+	}
+	if action := handle(increment(other, 1, 5)); action != ActionAbort {
+		t.Errorf("message after Close action = %d, want abort", action)
+	}
+}
+
+func TestDispatcherQuiesceCoversPositions(t *testing.T) {
+	const (
+		sessions = 3
+		messages = 3000
+	)
+	processor := counter.NewProcessor(counter.NewState(), nil, discardLogger())
+	d := NewDispatcher(DispatchConfig{Workers: 4, QueueSize: 4}, counter.PartitionKey, ContinueOnError(processor.Handle), discardLogger())
+	d.Start()
+	defer d.Close()
+
+	// Each session's messages are increments of 1 at positions 1, 2, 3...,
+	// so the counters sum to the positions of every applied message
+	total := func(cp counter.Checkpoint) int64 {
+		var sum int64
+		for _, c := range cp.Counters {
+			sum += c.Value
+		}
+		return sum
+	}
+	var positions int64
+	check := func() {
+		cp, _ := processor.Checkpoint()
+		current := processor.Positions()
+		positions = 0
+		for session := int32(1); session <= sessions; session++ {
+			if current[session] != cp.Positions[session] {
+				t.Errorf("session %d: Positions = %d, checkpoint = %d", session, current[session], cp.Positions[session])
+			}
+			positions += cp.Positions[session]
+		}
+		if sum := total(cp); sum != positions {
+			t.Errorf("positions add up to %d but %d increments were applied", positions, sum)
+		}
+	}
+
+	done := make(chan struct{})
+	var barriers sync.WaitGroup
+	barriers.Add(1)
+	go func() {
+		defer barriers.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			d.Quiesce(check)
+			runtime.Gosched()
+		}
+	}()
+
+	for i := 0; i < messages; i++ {
+		session := int32(i%sessions) + 1
+		deliver(t, d, increment(fmt.Sprintf("c%d", i%7), session, int64(i/sessions)+1))
+	}
+	close(done)
+	barriers.Wait()
+
+	d.Quiesce(check)
+	if positions != messages {
+		t.Errorf("final positions add up to %d, want %d", positions, messages)
+	}
+}
@@ -0,0 +1,65 @@
+package aeron
+
+import (
+	"fmt"
+	"time"
+
+	aeronlib "github.com/lirm/aeron-go/aeron"
+
+	"github.com/k-omotani/aeron-sample/internal/cnc"
+)
+
+// DriverMonitor reports whether the media driver is alive and the client
+// is still attached to it. The driver heartbeat is read from its own
+// read-only mapping of cnc.dat, since the Aeron client does not expose it.
+type DriverMonitor struct {
+	client  *aeronlib.Aeron
+	cnc     *cnc.File
+	timeout time.Duration
+}
+
+// NewDriverMonitor maps cnc.dat in config.AeronDir. The driver counts as
+// dead once its heartbeat is older than config.MediaDriverTimeout.
+func NewDriverMonitor(client *aeronlib.Aeron, config *Config) (*DriverMonitor, error) {
+	file, err := cnc.Open(config.AeronDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map cnc file: %w", err)
+	}
+
+	return &DriverMonitor{
+		client:  client,
+		cnc:     file,
+		timeout: config.MediaDriverTimeout,
+	}, nil
+}
+
+// CnC returns the driver's mapped cnc.dat, for its counters and error log
+func (m *DriverMonitor) CnC() *cnc.File {
+	return m.cnc
+}
+
+// HeartbeatAge returns how long ago the driver last serviced its command buffer
+func (m *DriverMonitor) HeartbeatAge() time.Duration {
+	return m.cnc.HeartbeatAge()
+}
+
+// Timeout returns the heartbeat age past which the driver counts as dead
+func (m *DriverMonitor) Timeout() time.Duration {
+	return m.timeout
+}
+
+// ClientClosed reports whether the Aeron client has shut down, which
+// happens after it loses the driver and cannot recover
+func (m *DriverMonitor) ClientClosed() bool {
+	return m.client.IsClosed()
+}
+
+// Alive reports whether the driver heartbeat is recent and the client is open
+func (m *DriverMonitor) Alive() bool {
+	return !m.ClientClosed() && m.HeartbeatAge() <= m.timeout
+}
+
+// Close unmaps cnc.dat
+func (m *DriverMonitor) Close() error {
+	return m.cnc.Close()
+}
@@ -0,0 +1,236 @@
+package aeron
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/lirm/aeron-go/aeron/logbuffer"
+	"github.com/lirm/aeron-go/aeron/util"
+)
+
+// GapKind classifies a discontinuity in a publisher's stream
+type GapKind string
+
+const (
+	// GapLoss is a jump in stream position within an image: the driver
+	// gave up on retransmitting lost data and filled it with padding
+	GapLoss GapKind = "loss"
+	// GapRejoin is an image that joined past where the session was last
+	// seen, after a disconnect or a restart from a snapshot
+	GapRejoin GapKind = "rejoin"
+	// GapLateJoin is a session first seen partway through its stream
+	GapLateJoin GapKind = "late_join"
+	// GapSequence is a jump in envelope sequence numbers
+	GapSequence GapKind = "sequence"
+	// GapReordered is a sequence number at or below one already seen
+	GapReordered GapKind = "reordered"
+)
+
+// GapKinds lists every kind of gap
+var GapKinds = []GapKind{GapLoss, GapRejoin, GapLateJoin, GapSequence, GapReordered}
+
+// sessionRetention is how long the positions of a session whose image went
+// away are kept, so that a rejoin can be checked against them
+const sessionRetention = 10 * time.Minute
+
+// Gap is one detected discontinuity. Expected and Actual are stream
+// positions, or sequence numbers for sequence and reordered gaps.
+type Gap struct {
+	Kind       GapKind   `json:"kind"`
+	SessionID  int32     `json:"session_id"`
+	Expected   int64     `json:"expected"`
+	Actual     int64     `json:"actual"`
+	Missing    int64     `json:"missing"` // bytes, or messages for sequence gaps
+	DetectedAt time.Time `json:"detected_at"`
+}
+
+// GapStats counts the gaps detected since the subscriber started
+type GapStats struct {
+	Counts          map[GapKind]int64 `json:"counts"`
+	MissingBytes    int64             `json:"missing_bytes"`
+	MissingMessages int64             `json:"missing_messages"`
+	Last            *Gap              `json:"last,omitempty"`
+}
+
+// streamState is what the gap detector knows about one session
+type streamState struct {
+	position int64     // end of the last fragment seen
+	sequence uint64    // highest sequence number seen, zero before the first
+	goneAt   time.Time // when the image went away; zero while connected
+}
+
+// gapDetector checks the fragments and messages of each session for
+// discontinuities. sessions is owned by the poll goroutine (and by the
+// replay before Start); the rest is guarded by mu.
+type gapDetector struct {
+	sessions map[int32]*streamState
+	logger   *slog.Logger
+
+	mu              sync.Mutex
+	joins           []ImageInfo // images that joined since the last poll
+	counts          map[GapKind]int64
+	missingBytes    int64
+	missingMessages int64
+	last            *Gap
+}
+
+func newGapDetector(logger *slog.Logger) *gapDetector {
+	return &gapDetector{
+		sessions: make(map[int32]*streamState),
+		logger:   logger,
+		counts:   make(map[GapKind]int64, len(GapKinds)),
+	}
+}
+
+// seed records positions already applied, so that images joining past
+// them are reported
+func (d *gapDetector) seed(positions map[int32]int64) {
+	for sessionID, position := range positions {
+		if state, ok := d.sessions[sessionID]; ok {
+			state.position = max(state.position, position)
+			continue
+		}
+		d.sessions[sessionID] = &streamState{position: position}
+	}
+}
+
+// fragment checks that a fragment of sessionID starts where the previous
+// one ended. A fragment at the start of a term may follow the padding that
+// fills the end of the previous term, which is never delivered, so only
+// jumps within a term count as loss.
+func (d *gapDetector) fragment(sessionID int32, header *logbuffer.Header) {
+	end := header.Position()
+	offset := header.Offset()
+	start := end - int64(util.AlignInt32(offset+header.FrameLength(), logbuffer.FrameAlignment)-offset)
+
+	state := d.state(sessionID, start)
+	if start > state.position && offset != 0 {
+		d.record(GapLoss, sessionID, state.position, start, start-state.position)
+	}
+	state.position = max(state.position, end)
+}
+
+// sequence checks that the messages of sessionID are numbered one after
+// the other. Unsequenced messages are not checked, and the first numbered
+// message of a session is taken as it is.
+func (d *gapDetector) sequence(sessionID int32, sequence uint64) {
+	if sequence == 0 {
+		return
+	}
+	state := d.state(sessionID, 0)
+	expected := state.sequence + 1
+	switch {
+	case state.sequence == 0:
+	case sequence > expected:
+		d.record(GapSequence, sessionID, int64(expected), int64(sequence), int64(sequence-expected))
+	case sequence < expected:
+		d.record(GapReordered, sessionID, int64(expected), int64(sequence), 0)
+	}
+	state.sequence = max(state.sequence, sequence)
+}
+
+// joined queues an image that became available. It runs on the conductor
+// goroutine; the join is checked on the next poll.
+func (d *gapDetector) joined(info ImageInfo) {
+	d.mu.Lock()
+	d.joins = append(d.joins, info)
+	d.mu.Unlock()
+}
+
+// checkJoins checks the images that joined since the last poll against
+// where their sessions were last seen, and forgets sessions long gone
+func (d *gapDetector) checkJoins(now time.Time) {
+	d.mu.Lock()
+	joins := d.joins
+	d.joins = nil
+	d.mu.Unlock()
+	if len(joins) == 0 {
+		return
+	}
+
+	for _, info := range joins {
+		state := d.state(info.SessionID, info.JoinPosition)
+		if info.JoinPosition > state.position {
+			d.record(GapRejoin, info.SessionID, state.position, info.JoinPosition, info.JoinPosition-state.position)
+		}
+		state.position = max(state.position, info.JoinPosition)
+		state.goneAt = time.Time{}
+	}
+	for sessionID, state := range d.sessions {
+		if !state.goneAt.IsZero() && now.Sub(state.goneAt) > sessionRetention {
+			delete(d.sessions, sessionID)
+		}
+	}
+}
+
+// gone marks the image of sessionID as gone. It is a SessionFlushHook.
+func (d *gapDetector) gone(sessionID int32) {
+	if state, ok := d.sessions[sessionID]; ok {
+		state.goneAt = time.Now()
+	}
+}
+
+// state returns the state of sessionID. A session seen for the first time
+// at position reports a late join unless it starts at the beginning of
+// its stream.
+func (d *gapDetector) state(sessionID int32, position int64) *streamState {
+	state, ok := d.sessions[sessionID]
+	if ok {
+		return state
+	}
+	state = &streamState{position: position}
+	d.sessions[sessionID] = state
+	if position > 0 {
+		d.record(GapLateJoin, sessionID, 0, position, position)
+	}
+	return state
+}
+
+func (d *gapDetector) record(kind GapKind, sessionID int32, expected, actual, missing int64) {
+	gap := &Gap{
+		Kind:       kind,
+		SessionID:  sessionID,
+		Expected:   expected,
+		Actual:     actual,
+		Missing:    missing,
+		DetectedAt: time.Now(),
+	}
+
+	d.mu.Lock()
+	d.counts[kind]++
+	switch kind {
+	case GapSequence:
+		d.missingMessages += missing
+	default:
+		d.missingBytes += missing
+	}
+	d.last = gap
+	d.mu.Unlock()
+
+	d.logger.Warn("stream gap detected",
+		"kind", kind,
+		"sessionID", sessionID,
+		"expected", expected,
+		"actual", actual,
+		"missing", missing,
+	)
+}
+
+func (d *gapDetector) stats() GapStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	stats := GapStats{
+		Counts:          make(map[GapKind]int64, len(GapKinds)),
+		MissingBytes:    d.missingBytes,
+		MissingMessages: d.missingMessages,
+	}
+	for _, kind := range GapKinds {
+		stats.Counts[kind] = d.counts[kind]
+	}
+	if d.last != nil {
+		last := *d.last
+		stats.Last = &last
+	}
+	return stats
+}
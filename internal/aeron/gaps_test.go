@@ -0,0 +1,240 @@
+package aeron
+
+import (
+	"testing"
+	"time"
+
+	aeronatomic "github.com/lirm/aeron-go/aeron/atomic"
+	"github.com/lirm/aeron-go/aeron/logbuffer"
+	"github.com/lirm/aeron-go/aeron/util"
+)
+
+// frameAt returns the header of a data frame of length bytes that starts
+// at stream position start, in a term of testTermLength
+func frameAt(sessionID int32, start int64, length int32) *logbuffer.Header {
+	bits := int32(util.NumberOfTrailingZeroes(testTermLength))
+	termID := int32(start >> bits)
+	offset := int32(start & (testTermLength - 1))
+
+	buffer := aeronatomic.MakeBuffer(make([]byte, testTermLength))
+	h := logbuffer.DataFrameHeader
+	buffer.PutInt32(offset+h.FrameLengthFieldOffset, length)
+	buffer.PutUInt16(offset+h.TypeFieldOffset, h.TypeData)
+	buffer.PutInt32(offset+h.TermOffsetFieldOffset, offset)
+	buffer.PutInt32(offset+h.SessionIDFieldOffset, sessionID)
+	buffer.PutInt32(offset+h.TermIDFieldOffset, termID)
+
+	header := new(logbuffer.Header).Wrap(buffer.Ptr(), buffer.Capacity())
+	return header.SetOffset(offset).SetInitialTermID(0).SetPositionBitsToShift(bits)
+}
+
+// gapStep is one thing that happens to a gap detector
+type gapStep func(d *gapDetector, now time.Time)
+
+func fragmentStep(sessionID int32, start int64, length int32) gapStep {
+	return func(d *gapDetector, now time.Time) {
+		d.fragment(sessionID, frameAt(sessionID, start, length))
+	}
+}
+
+// joinStep joins an image and checks it on a poll after the given delay
+func joinStep(sessionID int32, position int64, after time.Duration) gapStep {
+	return func(d *gapDetector, now time.Time) {
+		d.joined(ImageInfo{SessionID: sessionID, JoinPosition: position})
+		d.checkJoins(now.Add(after))
+	}
+}
+
+func goneStep(sessionID int32) gapStep {
+	return func(d *gapDetector, now time.Time) { d.gone(sessionID) }
+}
+
+func sequenceStep(sessionID int32, sequences ...uint64) gapStep {
+	return func(d *gapDetector, now time.Time) {
+		for _, sequence := range sequences {
+			d.sequence(sessionID, sequence)
+		}
+	}
+}
+
+func seedStep(positions map[int32]int64) gapStep {
+	return func(d *gapDetector, now time.Time) { d.seed(positions) }
+}
+
+func TestGapDetector(t *testing.T) {
+	const frame = 64
+	tests := []struct {
+		name     string
+		steps    []gapStep
+		counts   map[GapKind]int64
+		bytes    int64
+		messages int64
+		last     *Gap
+	}{
+		{
+			name:  "contiguous from the start",
+			steps: []gapStep{fragmentStep(1, 0, frame), fragmentStep(1, frame, frame), fragmentStep(1, 2*frame, 40)},
+		},
+		{
+			name:   "late join",
+			steps:  []gapStep{fragmentStep(1, 4096, frame), fragmentStep(1, 4096+frame, frame)},
+			counts: map[GapKind]int64{GapLateJoin: 1},
+			bytes:  4096,
+			last:   &Gap{Kind: GapLateJoin, SessionID: 1, Expected: 0, Actual: 4096, Missing: 4096},
+		},
+		{
+			name:   "loss within a term",
+			steps:  []gapStep{fragmentStep(1, 0, frame), fragmentStep(1, 1024, frame)},
+			counts: map[GapKind]int64{GapLoss: 1},
+			bytes:  1024 - frame,
+			last:   &Gap{Kind: GapLoss, SessionID: 1, Expected: frame, Actual: 1024, Missing: 1024 - frame},
+		},
+		{
+			name: "unaligned frames end at the aligned position",
+			// 40 bytes round up to 64, so the next frame follows on
+			steps: []gapStep{fragmentStep(1, 0, 40), fragmentStep(1, 64, frame)},
+		},
+		{
+			name: "padding at the end of a term",
+			steps: []gapStep{
+				fragmentStep(1, 0, frame),
+				fragmentStep(1, testTermLength-4*frame, frame), // loss
+				fragmentStep(1, testTermLength, frame),         // after undelivered padding
+			},
+			counts: map[GapKind]int64{GapLoss: 1},
+			bytes:  testTermLength - 5*frame,
+		},
+		{
+			name:   "loss into the next term",
+			steps:  []gapStep{fragmentStep(1, 0, frame), fragmentStep(1, testTermLength+frame, frame)},
+			counts: map[GapKind]int64{GapLoss: 1},
+			bytes:  testTermLength,
+		},
+		{
+			name:  "redelivered fragment",
+			steps: []gapStep{fragmentStep(1, 0, frame), fragmentStep(1, frame, frame), fragmentStep(1, frame, frame)},
+		},
+		{
+			name:  "sessions are independent",
+			steps: []gapStep{fragmentStep(1, 0, frame), fragmentStep(2, 0, frame), fragmentStep(1, frame, frame), fragmentStep(2, frame, frame)},
+		},
+		{
+			name:  "new image at the start of its stream",
+			steps: []gapStep{joinStep(1, 0, 0), fragmentStep(1, 0, frame)},
+		},
+		{
+			name:   "new image partway through its stream",
+			steps:  []gapStep{joinStep(1, 8192, 0), fragmentStep(1, 8192, frame)},
+			counts: map[GapKind]int64{GapLateJoin: 1},
+			bytes:  8192,
+		},
+		{
+			name:   "rejoin past the last position",
+			steps:  []gapStep{fragmentStep(1, 0, frame), goneStep(1), joinStep(1, 4096, 0), fragmentStep(1, 4096, frame)},
+			counts: map[GapKind]int64{GapRejoin: 1},
+			bytes:  4096 - frame,
+			last:   &Gap{Kind: GapRejoin, SessionID: 1, Expected: frame, Actual: 4096, Missing: 4096 - frame},
+		},
+		{
+			name:  "rejoin where it left off",
+			steps: []gapStep{fragmentStep(1, 0, frame), goneStep(1), joinStep(1, frame, 0), fragmentStep(1, frame, frame)},
+		},
+		{
+			name: "session long gone is forgotten",
+			steps: []gapStep{
+				fragmentStep(1, 0, frame),
+				goneStep(1),
+				joinStep(2, 0, sessionRetention+time.Minute), // a poll with a join prunes
+				joinStep(1, 4096, sessionRetention+time.Minute),
+			},
+			counts: map[GapKind]int64{GapLateJoin: 1},
+			bytes:  4096,
+		},
+		{
+			name: "rejoined session is not forgotten",
+			steps: []gapStep{
+				fragmentStep(1, 0, frame),
+				goneStep(1),
+				joinStep(1, frame, 0),
+				joinStep(2, 0, sessionRetention+time.Minute),
+				fragmentStep(1, frame, frame),
+			},
+		},
+		{
+			name:  "seeded position continued",
+			steps: []gapStep{seedStep(map[int32]int64{1: 4096}), joinStep(1, 4096, 0), fragmentStep(1, 4096, frame)},
+		},
+		{
+			name:   "seeded position skipped by the join",
+			steps:  []gapStep{seedStep(map[int32]int64{1: 4096}), joinStep(1, 8192, 0), fragmentStep(1, 8192, frame)},
+			counts: map[GapKind]int64{GapRejoin: 1},
+			bytes:  4096,
+		},
+		{
+			name: "seed behind fragments already seen",
+			// A replay got further than the snapshot: the seed does not move it back
+			steps: []gapStep{fragmentStep(1, 0, frame), fragmentStep(1, frame, frame), seedStep(map[int32]int64{1: frame}), joinStep(1, 2*frame, 0)},
+		},
+		{
+			name:  "consecutive sequences",
+			steps: []gapStep{sequenceStep(1, 1, 2, 3), sequenceStep(2, 1, 2)},
+		},
+		{
+			name:  "first sequence taken as it is",
+			steps: []gapStep{sequenceStep(1, 40, 41)},
+		},
+		{
+			name:  "unsequenced messages are not checked",
+			steps: []gapStep{sequenceStep(1, 1, 0, 0, 2)},
+		},
+		{
+			name:     "sequence gap",
+			steps:    []gapStep{sequenceStep(1, 1, 2, 5, 6)},
+			counts:   map[GapKind]int64{GapSequence: 1},
+			messages: 2,
+			last:     &Gap{Kind: GapSequence, SessionID: 1, Expected: 3, Actual: 5, Missing: 2},
+		},
+		{
+			name:   "reordered sequence",
+			steps:  []gapStep{sequenceStep(1, 1, 3, 2, 4)},
+			counts: map[GapKind]int64{GapSequence: 1, GapReordered: 1},
+			// 2 arrives after 3: one missing, then the late one reordered
+			messages: 1,
+			last:     &Gap{Kind: GapReordered, SessionID: 1, Expected: 4, Actual: 2},
+		},
+		{
+			name:   "repeated sequence",
+			steps:  []gapStep{sequenceStep(1, 1, 2, 2, 3)},
+			counts: map[GapKind]int64{GapReordered: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newGapDetector(discardLogger())
+			now := time.Now()
+			for _, step := range tt.steps {
+				step(d, now)
+			}
+
+			stats := d.stats()
+			for _, kind := range GapKinds {
+				if stats.Counts[kind] != tt.counts[kind] {
+					t.Errorf("%s gaps = %d, want %d", kind, stats.Counts[kind], tt.counts[kind])
+				}
+			}
+			if stats.MissingBytes != tt.bytes || stats.MissingMessages != tt.messages {
+				t.Errorf("missing %d bytes and %d messages, want %d and %d", stats.MissingBytes, stats.MissingMessages, tt.bytes, tt.messages)
+			}
+			if tt.last != nil {
+				if stats.Last == nil {
+					t.Fatal("no last gap")
+				}
+				got := *stats.Last
+				got.DetectedAt = time.Time{}
+				if got != *tt.last {
+					t.Errorf("last gap = %+v, want %+v", got, *tt.last)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package aeron
+
+import (
+	"reflect"
+	"sort"
+	"time"
+
+	aeronlib "github.com/lirm/aeron-go/aeron"
+)
+
+// ImageInfo describes a publisher image of the subscription, i.e. one
+// publisher session
+type ImageInfo struct {
+	SessionID      int32     `json:"session_id"`
+	SourceIdentity string    `json:"source_identity"` // publisher address, e.g. "172.18.0.5:51234"
+	JoinPosition   int64     `json:"join_position"`
+	CorrelationID  int64     `json:"correlation_id"`
+	ConnectedAt    time.Time `json:"connected_at"`
+}
+
+// PublisherInfo is an active publisher image and how far it has been consumed
+type PublisherInfo struct {
+	ImageInfo
+	Position int64 `json:"position"`
+}
+
+// ImageStats counts publisher churn
+type ImageStats struct {
+	Active      int   `json:"active"`
+	Connects    int64 `json:"connects"`
+	Disconnects int64 `json:"disconnects"`
+}
+
+// SessionFlushHook discards per-session state once a publisher image has
+// gone away. It runs on the poll goroutine, inside the barrier set with
+// SetFlushBarrier; without one, a Dispatcher's workers may be handling
+// messages at the same time.
+type SessionFlushHook func(sessionID int32)
+
+// activeImage is an image in the publisher registry
+type activeImage struct {
+	info  ImageInfo
+	image aeronlib.Image
+}
+
+// AddSessionFlushHook registers h to run after a publisher image goes away.
+// It must be called before Start.
+func (s *Subscriber) AddSessionFlushHook(h SessionFlushHook) {
+	s.flushHooks = append(s.flushHooks, h)
+}
+
+// SetFlushBarrier makes the flush hooks run inside barrier, such as
+// Dispatcher.Quiesce, so that no message of a gone session is still being
+// handled while its state is discarded. It must be called before Start.
+func (s *Subscriber) SetFlushBarrier(barrier func(fn func())) {
+	s.flushBarrier = barrier
+}
+
+// Publishers returns the active publisher images, sorted by session ID
+func (s *Subscriber) Publishers() []PublisherInfo {
+	s.imagesMu.Lock()
+	publishers := make([]PublisherInfo, 0, len(s.images))
+	for _, active := range s.images {
+		publishers = append(publishers, PublisherInfo{ImageInfo: active.info, Position: active.image.Position()})
+	}
+	s.imagesMu.Unlock()
+
+	sort.Slice(publishers, func(i, j int) bool { return publishers[i].SessionID < publishers[j].SessionID })
+	return publishers
+}
+
+// ImageStats returns the publisher churn counters
+func (s *Subscriber) ImageStats() ImageStats {
+	s.imagesMu.Lock()
+	defer s.imagesMu.Unlock()
+	return ImageStats{
+		Active:      len(s.images),
+		Connects:    s.connects,
+		Disconnects: s.disconnects,
+	}
+}
+
+func (s *Subscriber) onImageAvailable(image aeronlib.Image) {
+	info := ImageInfo{
+		SessionID:      image.SessionID(),
+		SourceIdentity: sourceIdentity(image),
+		JoinPosition:   image.Position(), // an image starts at its join position
+		CorrelationID:  image.CorrelationID(),
+		ConnectedAt:    time.Now(),
+	}
+
+	s.imagesMu.Lock()
+	s.images[info.CorrelationID] = activeImage{info: info, image: image}
+	s.connects++
+	s.imagesMu.Unlock()
+	s.gaps.joined(info)
+
+	s.logger.Info("publisher connected",
+		"sessionID", info.SessionID,
+		"source", info.SourceIdentity,
+		"joinPosition", info.JoinPosition,
+	)
+}
+
+func (s *Subscriber) onImageUnavailable(image aeronlib.Image) {
+	if image == nil {
+		return
+	}
+	correlationID := image.CorrelationID()
+
+	s.imagesMu.Lock()
+	active, ok := s.images[correlationID]
+	if !ok {
+		s.imagesMu.Unlock()
+		return
+	}
+	delete(s.images, correlationID)
+	s.disconnects++
+	s.gone = append(s.gone, active.info.SessionID)
+	s.imagesMu.Unlock()
+
+	s.logger.Info("publisher disconnected",
+		"sessionID", active.info.SessionID,
+		"source", active.info.SourceIdentity,
+		"finalPosition", image.Position(),
+		"connectedFor", time.Since(active.info.ConnectedAt).Round(time.Millisecond),
+	)
+}
+
+// flushGoneSessions runs the flush hooks for sessions whose image went
+// away since the last poll, unless the publisher has already rejoined.
+// It runs on the poll goroutine.
+func (s *Subscriber) flushGoneSessions() {
+	s.imagesMu.Lock()
+	if len(s.gone) == 0 {
+		s.imagesMu.Unlock()
+		return
+	}
+	gone := s.gone
+	s.gone = nil
+	active := make(map[int32]bool, len(s.images))
+	for _, image := range s.images {
+		active[image.info.SessionID] = true
+	}
+	s.imagesMu.Unlock()
+
+	flush := gone[:0]
+	for _, sessionID := range gone {
+		if active[sessionID] {
+			continue
+		}
+		s.reassembler.Flush(sessionID)
+		flush = append(flush, sessionID)
+	}
+	if len(flush) == 0 {
+		return
+	}
+	s.flushBarrier(func() {
+		for _, sessionID := range flush {
+			for _, h := range s.flushHooks {
+				h(sessionID)
+			}
+		}
+	})
+}
+
+// sourceIdentity returns the publisher address of image. aeron-go keeps it
+// unexported, so it is read by reflection; it is empty if that fails.
+func sourceIdentity(image aeronlib.Image) string {
+	v := reflect.ValueOf(image)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return ""
+	}
+	field := v.Elem().FieldByName("sourceIdentity")
+	if !field.IsValid() || field.Kind() != reflect.String {
+		return ""
+	}
+	return field.String()
+}
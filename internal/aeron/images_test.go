@@ -0,0 +1,84 @@
+package aeron
+
+import (
+	"reflect"
+	"testing"
+	"unsafe"
+
+	aeronlib "github.com/lirm/aeron-go/aeron"
+	aeronatomic "github.com/lirm/aeron-go/aeron/atomic"
+	"github.com/lirm/aeron-go/aeron/logbuffer"
+	"github.com/lirm/aeron-go/aeron/logbuffer/term"
+)
+
+func TestFlushGoneSessions(t *testing.T) {
+	s := &Subscriber{
+		logger: discardLogger(),
+		images: map[int64]activeImage{
+			// Session 1 went away and has already rejoined under a new image
+			11: {info: ImageInfo{SessionID: 1, CorrelationID: 11}},
+		},
+		gone: []int32{1, 2},
+	}
+	barriers := 0
+	s.SetFlushBarrier(func(fn func()) {
+		barriers++
+		fn()
+	})
+	s.reassembler = NewControlledReassembler(func(*aeronatomic.Buffer, int32, int32, *logbuffer.Header) term.ControlledPollAction {
+		return term.ControlledPollActionContinue
+	}, 1024, discardLogger())
+	var flushed []int32
+	s.AddSessionFlushHook(func(sessionID int32) {
+		if barriers == 0 {
+			t.Error("flush hook ran outside the barrier")
+		}
+		flushed = append(flushed, sessionID)
+	})
+
+	// Both sessions are partway through a fragmented message
+	tb := newTestTerm()
+	for _, session := range []int32{1, 2} {
+		f := tb.append(session, flagBegin, []byte("partial"))
+		s.reassembler.OnControlledFragment(tb.buffer, f.offset, f.length, f.header)
+	}
+
+	s.flushGoneSessions()
+	if !reflect.DeepEqual(flushed, []int32{2}) {
+		t.Errorf("flushed sessions %v, want only [2]", flushed)
+	}
+	if stats := s.reassembler.Stats(); stats.Abandoned != 1 || stats.InProgress != 1 {
+		t.Errorf("reassembler stats = %+v, want session 2 abandoned and session 1 in progress", stats)
+	}
+	if len(s.gone) != 0 {
+		t.Errorf("gone = %v after flushing", s.gone)
+	}
+
+	s.flushGoneSessions()
+	if len(flushed) != 1 || barriers != 1 {
+		t.Errorf("flushed %v through %d barriers, want no second flush", flushed, barriers)
+	}
+}
+
+// TestSourceIdentity pins the unexported aeron-go field sourceIdentity
+// reads, so a dependency bump that renames it fails here instead of
+// blanking source_identity in /api/publishers
+func TestSourceIdentity(t *testing.T) {
+	imageType := reflect.TypeOf(aeronlib.NewImage).Out(0)
+	if imageType.Kind() != reflect.Pointer {
+		t.Fatalf("aeron.NewImage returns %s, want a pointer", imageType)
+	}
+	image := reflect.New(imageType.Elem())
+	field := image.Elem().FieldByName("sourceIdentity")
+	if !field.IsValid() || field.Kind() != reflect.String {
+		t.Fatalf("%s has no string field sourceIdentity", imageType.Elem())
+	}
+	reflect.NewAt(field.Type(), unsafe.Pointer(field.UnsafeAddr())).Elem().SetString("172.18.0.5:51234")
+
+	if got := sourceIdentity(image.Interface().(aeronlib.Image)); got != "172.18.0.5:51234" {
+		t.Errorf("sourceIdentity = %q, want %q", got, "172.18.0.5:51234")
+	}
+	if got := sourceIdentity(nil); got != "" {
+		t.Errorf("sourceIdentity(nil) = %q, want empty", got)
+	}
+}
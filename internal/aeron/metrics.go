@@ -0,0 +1,268 @@
+package aeron
+
+import (
+	"errors"
+	"time"
+
+	"github.com/k-omotani/aeron-sample/internal/message"
+	"github.com/k-omotani/aeron-sample/internal/metrics"
+)
+
+// publisherMetrics instruments a Publisher; nil records nothing
+type publisherMetrics struct {
+	offers    *metrics.CounterVec
+	publishes *metrics.CounterVec
+	retries   *metrics.Counter
+	duration  *metrics.Histogram
+}
+
+// RegisterMetrics exposes the publisher's offer results, publish outcomes,
+// retries, latency and circuit state in r. It must be called before the
+// first publish.
+func (p *Publisher) RegisterMetrics(r *metrics.Registry) {
+	p.metrics = &publisherMetrics{
+		offers:    r.CounterVec("aeron_publication_offers_total", "Offer and TryClaim calls by Aeron result.", "result"),
+		publishes: r.CounterVec("aeron_publishes_total", "Publishes by final outcome.", "outcome"),
+		retries:   r.Counter("aeron_publish_retries_total", "Offers retried after a negative Aeron result."),
+		duration:  r.Histogram("aeron_publish_duration_seconds", "Time to publish a message, including retries.", nil),
+	}
+	r.GaugeFunc("aeron_publication_connected", "Whether a subscriber is connected to the publication.", nil, func() []metrics.Sample {
+		return []metrics.Sample{{Value: boolValue(p.IsConnected())}}
+	})
+	r.GaugeFunc("aeron_circuit_state", "Circuit breaker state (0 closed, 1 open, 2 half-open).", nil, func() []metrics.Sample {
+		return []metrics.Sample{{Value: float64(p.CircuitStatus().State)}}
+	})
+}
+
+func (m *publisherMetrics) offer(result int64) {
+	if m == nil {
+		return
+	}
+	if result >= 0 {
+		m.offers.With("success").Inc()
+		return
+	}
+	m.offers.With(classify(result).String()).Inc()
+}
+
+func (m *publisherMetrics) retry() {
+	if m == nil {
+		return
+	}
+	m.retries.Inc()
+}
+
+func (m *publisherMetrics) publish(start time.Time, err error) {
+	if m == nil {
+		return
+	}
+	m.duration.Observe(time.Since(start).Seconds())
+	m.publishes.With(publishOutcome(err)).Inc()
+}
+
+// publishOutcome labels the result of a publish
+func publishOutcome(err error) string {
+	var offerErr *OfferError
+	var circuitErr *CircuitOpenError
+	switch {
+	case err == nil:
+		return "success"
+	case errors.As(err, &circuitErr):
+		return "circuit_open"
+	case errors.As(err, &offerErr):
+		return offerErr.Class().String()
+	default:
+		return "error"
+	}
+}
+
+// RegisterMetrics exposes the async queue depth in r
+func (a *AsyncPublisher) RegisterMetrics(r *metrics.Registry) {
+	r.GaugeFunc("aeron_async_queue_length", "Messages waiting in the async publish queue.", nil, func() []metrics.Sample {
+		return []metrics.Sample{{Value: float64(a.Len())}}
+	})
+	r.GaugeFunc("aeron_async_queue_capacity", "Capacity of the async publish queue.", nil, func() []metrics.Sample {
+		return []metrics.Sample{{Value: float64(a.config.QueueSize)}}
+	})
+}
+
+// subscriberMetrics instruments a Subscriber; nil records nothing
+type subscriberMetrics struct {
+	fragments      *metrics.Counter
+	messages       *metrics.CounterVec
+	decodeFailures *metrics.Counter
+	handlerErrors  *metrics.Counter
+	aborts         *metrics.Counter
+	deadLetters    *metrics.CounterVec
+	latency        *metrics.Histogram
+}
+
+// RegisterMetrics exposes the subscriber's fragment, message, failure and
+// end-to-end latency counters in r. It must be called before Start.
+func (s *Subscriber) RegisterMetrics(r *metrics.Registry) {
+	s.metrics = &subscriberMetrics{
+		fragments:      r.Counter("aeron_fragments_polled_total", "Fragments read from the subscription."),
+		messages:       r.CounterVec("aeron_messages_received_total", "Messages decoded, by type.", "type"),
+		decodeFailures: r.Counter("aeron_decode_failures_total", "Frames that could not be decoded."),
+		handlerErrors:  r.Counter("aeron_handler_failures_total", "Messages the handler returned an error for."),
+		aborts:         r.Counter("aeron_handler_aborts_total", "Messages the handler aborted, to be delivered again."),
+		deadLetters:    r.CounterVec("aeron_dead_letters_total", "Frames stored in the dead-letter sink, by failed stage.", "stage"),
+		latency:        r.Histogram("aeron_end_to_end_latency_seconds", "Time from Message.Timestamp to receipt of live messages.", nil),
+	}
+	r.GaugeFunc("aeron_images", "Publisher images connected to the subscription.", nil, func() []metrics.Sample {
+		return []metrics.Sample{{Value: float64(s.ImageCount())}}
+	})
+	r.CounterFunc("aeron_image_connects_total", "Publisher images that became available.", nil, func() []metrics.Sample {
+		return []metrics.Sample{{Value: float64(s.ImageStats().Connects)}}
+	})
+	r.CounterFunc("aeron_image_disconnects_total", "Publisher images that went away.", nil, func() []metrics.Sample {
+		return []metrics.Sample{{Value: float64(s.ImageStats().Disconnects)}}
+	})
+	r.CounterFunc("aeron_reassembly_total", "Fragmented messages by reassembly outcome.", []string{"outcome"}, func() []metrics.Sample {
+		stats := s.ReassemblyStats()
+		return []metrics.Sample{
+			{Labels: []string{"assembled"}, Value: float64(stats.Assembled)},
+			{Labels: []string{"dropped_oversize"}, Value: float64(stats.DroppedOversize)},
+			{Labels: []string{"dropped_orphan"}, Value: float64(stats.DroppedOrphan)},
+			{Labels: []string{"abandoned"}, Value: float64(stats.Abandoned)},
+		}
+	})
+	r.CounterFunc("aeron_gaps_total", "Stream discontinuities detected, by kind.", []string{"kind"}, func() []metrics.Sample {
+		stats := s.GapStats()
+		samples := make([]metrics.Sample, 0, len(GapKinds))
+		for _, kind := range GapKinds {
+			samples = append(samples, metrics.Sample{Labels: []string{string(kind)}, Value: float64(stats.Counts[kind])})
+		}
+		return samples
+	})
+	r.CounterFunc("aeron_gap_missing_bytes_total", "Stream bytes skipped by loss, rejoin and late join gaps.", nil, func() []metrics.Sample {
+		return []metrics.Sample{{Value: float64(s.GapStats().MissingBytes)}}
+	})
+	r.CounterFunc("aeron_gap_missing_messages_total", "Messages skipped according to envelope sequence numbers.", nil, func() []metrics.Sample {
+		return []metrics.Sample{{Value: float64(s.GapStats().MissingMessages)}}
+	})
+	r.GaugeFunc("aeron_last_gap_timestamp_seconds", "Unix time of the last detected gap, 0 if none.", nil, func() []metrics.Sample {
+		var value float64
+		if last := s.GapStats().Last; last != nil {
+			value = float64(last.DetectedAt.UnixNano()) / 1e9
+		}
+		return []metrics.Sample{{Value: value}}
+	})
+}
+
+func (m *subscriberMetrics) polled(fragments int) {
+	if m == nil || fragments == 0 {
+		return
+	}
+	m.fragments.Add(float64(fragments))
+}
+
+// received counts a decoded message; end-to-end latency is only observed
+// for live messages, as replayed ones are as old as the recording
+func (m *subscriberMetrics) received(msg *message.Message, now time.Time, live bool) {
+	if m == nil {
+		return
+	}
+	m.messages.With(msg.Type.String()).Inc()
+	if live && msg.Timestamp != 0 {
+		m.latency.Observe(max(now.Sub(time.Unix(0, msg.Timestamp)).Seconds(), 0))
+	}
+}
+
+func (m *subscriberMetrics) decodeFailed() {
+	if m == nil {
+		return
+	}
+	m.decodeFailures.Inc()
+}
+
+func (m *subscriberMetrics) aborted() {
+	if m == nil {
+		return
+	}
+	m.aborts.Inc()
+}
+
+func (m *subscriberMetrics) deadLettered(stage string) {
+	if m == nil {
+		return
+	}
+	m.deadLetters.With(stage).Inc()
+}
+
+func (m *subscriberMetrics) handlerFailed() {
+	if m == nil {
+		return
+	}
+	m.handlerErrors.Inc()
+}
+
+// dispatcherMetrics instruments a Dispatcher; nil records nothing
+type dispatcherMetrics struct {
+	aborts        *metrics.CounterVec
+	handlerErrors *metrics.Counter
+}
+
+// RegisterMetrics exposes the dispatcher's backlog, aborts and worker
+// failures in r. It must be called before Start.
+func (d *Dispatcher) RegisterMetrics(r *metrics.Registry) {
+	d.metrics = &dispatcherMetrics{
+		aborts:        r.CounterVec("aeron_dispatch_aborts_total", "Messages the dispatcher aborted, by reason.", "reason"),
+		handlerErrors: r.Counter("aeron_dispatch_failures_total", "Messages a worker's handler returned an error for."),
+	}
+	r.GaugeFunc("aeron_dispatch_pending", "Messages queued for or being handled by workers.", nil, func() []metrics.Sample {
+		return []metrics.Sample{{Value: float64(d.Len())}}
+	})
+}
+
+// aborted counts a message held back because its worker queue was full,
+// a Quiesce was running, or an unkeyed message waited for the workers
+func (m *dispatcherMetrics) aborted(reason string) {
+	if m == nil {
+		return
+	}
+	m.aborts.With(reason).Inc()
+}
+
+func (m *dispatcherMetrics) handlerFailed() {
+	if m == nil {
+		return
+	}
+	m.handlerErrors.Inc()
+}
+
+// RegisterMetrics exposes the reply sender counters in r
+func (s *ReplySender) RegisterMetrics(r *metrics.Registry) {
+	r.CounterFunc("aeron_replies_sent_total", "Replies sent to publishers.", nil, func() []metrics.Sample {
+		return []metrics.Sample{{Value: float64(s.Stats().Sent)}}
+	})
+	r.CounterFunc("aeron_replies_dropped_total", "Replies dropped because the queue was full or the send failed.", nil, func() []metrics.Sample {
+		return []metrics.Sample{{Value: float64(s.Stats().Dropped)}}
+	})
+	r.CounterFunc("aeron_replies_rejected_total", "Replies not sent because the reply channel is not allowed.", nil, func() []metrics.Sample {
+		return []metrics.Sample{{Value: float64(s.Stats().Rejected)}}
+	})
+}
+
+// RegisterMetrics exposes the reply receiver counters in r
+func (r *ReplyReceiver) RegisterMetrics(registry *metrics.Registry) {
+	registry.CounterFunc("aeron_replies_received_total", "Replies received from the subscriber.", nil, func() []metrics.Sample {
+		return []metrics.Sample{{Value: float64(r.Stats().Received)}}
+	})
+	registry.CounterFunc("aeron_replies_unmatched_total", "Replies no request was waiting for.", nil, func() []metrics.Sample {
+		return []metrics.Sample{{Value: float64(r.Stats().Unmatched)}}
+	})
+}
+
+// RegisterMetrics exposes the driver heartbeat, counters and error log
+// from cnc.dat in r
+func (m *DriverMonitor) RegisterMetrics(r *metrics.Registry) {
+	m.cnc.RegisterMetrics(r)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
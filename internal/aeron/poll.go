@@ -0,0 +1,160 @@
+package aeron
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lirm/aeron-go/aeron/idlestrategy"
+	"github.com/lirm/aeron-go/aeron/logbuffer/term"
+
+	"github.com/k-omotani/aeron-sample/internal/message"
+)
+
+// Action tells the poll loop what to do with the fragment a message
+// arrived in, once the MessageHandler returns
+type Action int8
+
+const (
+	// ActionContinue consumes the message and carries on polling
+	ActionContinue Action = iota
+	// ActionAbort leaves the message unconsumed, so it is delivered again
+	// on the next poll. The handler uses it to push back when it cannot
+	// take the message yet.
+	ActionAbort
+	// ActionBreak consumes the message and ends the current poll
+	ActionBreak
+	// ActionCommit consumes the message and commits the subscriber
+	// position straight away, so flow control sees it before the poll ends
+	ActionCommit
+)
+
+// String returns the lower-case name of the action
+func (a Action) String() string {
+	switch a {
+	case ActionContinue:
+		return "continue"
+	case ActionAbort:
+		return "abort"
+	case ActionBreak:
+		return "break"
+	case ActionCommit:
+		return "commit"
+	default:
+		return fmt.Sprintf("action(%d)", int8(a))
+	}
+}
+
+// controlled maps the action onto the Aeron controlled poll action
+func (a Action) controlled() term.ControlledPollAction {
+	switch a {
+	case ActionAbort:
+		return term.ControlledPollActionAbort
+	case ActionBreak:
+		return term.ControlledPollActionBreak
+	case ActionCommit:
+		return term.ControlledPollActionCommit
+	default:
+		return term.ControlledPollActionContinue
+	}
+}
+
+// merge combines the actions of the messages of one batch frame: the
+// frame is handled as strictly as its strictest message asks
+func (a Action) merge(other Action) Action {
+	rank := func(a Action) int {
+		switch a {
+		case ActionAbort:
+			return 3
+		case ActionBreak:
+			return 2
+		case ActionCommit:
+			return 1
+		default:
+			return 0
+		}
+	}
+	if rank(other) > rank(a) {
+		return other
+	}
+	return a
+}
+
+// ContinueOnError adapts a handler that only reports errors. Every message
+// is consumed, whether it succeeded or not.
+func ContinueOnError(handle func(msg *message.Message) error) MessageHandler {
+	return func(msg *message.Message) (Action, error) {
+		return ActionContinue, handle(msg)
+	}
+}
+
+// IdleStrategy names how the poll loop waits when a poll finds no work
+type IdleStrategy uint8
+
+const (
+	// IdleBusySpin polls again straight away, burning a core for the
+	// lowest latency
+	IdleBusySpin IdleStrategy = iota
+	// IdleYielding yields the processor between polls
+	IdleYielding
+	// IdleBackoff spins, then yields, then parks for up to PollConfig.SleepFor
+	IdleBackoff
+	// IdleSleeping sleeps for PollConfig.SleepFor
+	IdleSleeping
+)
+
+// String returns the flag name of the strategy
+func (s IdleStrategy) String() string {
+	switch s {
+	case IdleBusySpin:
+		return "busy-spin"
+	case IdleYielding:
+		return "yielding"
+	case IdleBackoff:
+		return "backoff"
+	case IdleSleeping:
+		return "sleeping"
+	default:
+		return fmt.Sprintf("idle(%d)", uint8(s))
+	}
+}
+
+// ParseIdleStrategy parses a strategy name as returned by String
+func ParseIdleStrategy(name string) (IdleStrategy, error) {
+	for _, s := range []IdleStrategy{IdleBusySpin, IdleYielding, IdleBackoff, IdleSleeping} {
+		if s.String() == name {
+			return s, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown idle strategy %q", name)
+}
+
+// PollConfig configures how the subscriber polls its subscription
+type PollConfig struct {
+	// FragmentLimit is the most fragments handled per poll
+	FragmentLimit int
+	// Idle is how the poll loop waits after a poll that found no work
+	Idle IdleStrategy
+	// SleepFor is how long the sleeping strategy sleeps, and the longest
+	// the backoff strategy parks
+	SleepFor time.Duration
+}
+
+// NewIdler creates the configured idle strategy. Strategies may keep
+// state, so each poll loop needs its own.
+func (c PollConfig) NewIdler() idlestrategy.Idler {
+	switch c.Idle {
+	case IdleBusySpin:
+		return idlestrategy.Busy{}
+	case IdleYielding:
+		return idlestrategy.Yielding{}
+	case IdleBackoff:
+		return idlestrategy.NewBackoffIdleStrategy(
+			idlestrategy.DefaultMaxSpins,
+			idlestrategy.DefaultMaxYields,
+			idlestrategy.DefaultMinParkNs,
+			max(c.SleepFor.Nanoseconds(), idlestrategy.DefaultMinParkNs),
+		)
+	default:
+		return idlestrategy.Sleeping{SleepFor: c.SleepFor}
+	}
+}
@@ -4,10 +4,12 @@ import (
 	"context"
 	"errors"
 	"log/slog"
+	"sync"
 	"time"
 
 	aeronlib "github.com/lirm/aeron-go/aeron"
 	"github.com/lirm/aeron-go/aeron/atomic"
+	"github.com/lirm/aeron-go/aeron/logbuffer"
 
 	"github.com/k-omotani/aeron-sample/internal/message"
 )
@@ -20,14 +22,41 @@ var (
 
 // Publisher wraps Aeron publication for sending messages
 type Publisher struct {
-	publication *aeronlib.Publication
-	codec       *message.Codec
-	logger      *slog.Logger
+	publication    *aeronlib.Publication
+	codec          message.Codec
+	encoder        message.BufferEncoder // nil when codec cannot encode in place
+	maxClaimLength int32
+	retry          RetryPolicy
+	breaker        *CircuitBreaker
+	attempts       sync.Pool
+	metrics        *publisherMetrics
+	logger         *slog.Logger
+
+	// seqMu serializes publish attempts so that sequence numbers follow
+	// stream order. sequence is the last number published.
+	seqMu    sync.Mutex
+	sequence uint64
+}
+
+// publishAttempt carries one message through the offer retry loop.
+// Attempts are pooled so the claim path does not allocate per publish.
+type publishAttempt struct {
+	// claim path
+	claim logbuffer.Claim
+	msg   *message.Message
+
+	// offer path
+	buffer *atomic.Buffer
+	batch  []*message.Message // messages buffer was encoded from; nil for a raw frame
+
+	length int32
+	code   int64 // last negative offer result
+	err    error
 }
 
-// NewPublisher creates a publisher on the given channel/stream
-func NewPublisher(aeron *aeronlib.Aeron, channel string, streamID int32, logger *slog.Logger) (*Publisher, error) {
-	publication, err := aeron.AddPublication(channel, streamID)
+// NewPublisher creates a publisher on the configured channel/stream that encodes with codec
+func NewPublisher(aeron *aeronlib.Aeron, config *Config, codec message.Codec, logger *slog.Logger) (*Publisher, error) {
+	publication, err := aeron.AddPublication(config.Channel, config.StreamID)
 	if err != nil {
 		return nil, err
 	}
@@ -45,54 +74,265 @@ func NewPublisher(aeron *aeronlib.Aeron, channel string, streamID int32, logger
 		}
 	}
 
-	return &Publisher{
-		publication: publication,
-		codec:       message.NewCodec(),
-		logger:      logger.With("component", "publisher"),
-	}, nil
+	p := &Publisher{
+		publication:    publication,
+		codec:          codec,
+		maxClaimLength: config.MaxClaimLength,
+		retry:          config.Retry,
+		breaker:        NewCircuitBreaker(config.Breaker, logger),
+		logger:         logger.With("component", "publisher"),
+	}
+	p.encoder, _ = codec.(message.BufferEncoder)
+	p.attempts.New = func() any { return new(publishAttempt) }
+	return p, nil
 }
 
-// Publish sends a message through Aeron
+// Publish sends a message through Aeron.
+// Messages that fit in a single frame are encoded straight into the term
+// buffer with TryClaim when the codec supports it; everything else is
+// encoded into a new buffer and sent with Offer.
+// msg.Sequence is set to the next sequence number of the publisher.
+// While the circuit breaker is open it fails fast with a *CircuitOpenError.
 func (p *Publisher) Publish(ctx context.Context, msg *message.Message) error {
-	buffer, length, err := p.codec.ToBuffer(msg)
-	if err != nil {
+	start := time.Now()
+	if err := p.breaker.Allow(); err != nil {
+		p.metrics.publish(start, err)
 		return err
 	}
+	err := p.publish(ctx, msg)
+	p.breaker.Record(err)
+	p.metrics.publish(start, err)
+	return err
+}
 
-	return p.offer(ctx, buffer, length)
+func (p *Publisher) publish(ctx context.Context, msg *message.Message) error {
+	attempt := p.attempts.Get().(*publishAttempt)
+	defer p.release(attempt)
+
+	if p.encoder != nil {
+		length := message.FrameHeaderLength + p.encoder.EncodedLength(msg)
+		if length <= p.maxClaimLength {
+			attempt.msg = msg
+			attempt.length = length
+			return p.offer(ctx, attempt)
+		}
+	}
+
+	attempt.batch = []*message.Message{msg}
+	if err := p.encode(attempt, p.nextSequence()); err != nil {
+		return err
+	}
+	return p.offer(ctx, attempt)
 }
 
-func (p *Publisher) offer(ctx context.Context, buffer *atomic.Buffer, length int32) error {
-	maxRetries := 100
-	retries := 0
+// PublishFrame sends a frame that is already encoded, such as one built by
+// message.Marshal or message.AppendBatch. The frame is sent as is, so the
+// messages in it keep whatever sequence numbers they were encoded with.
+func (p *Publisher) PublishFrame(ctx context.Context, frame []byte) error {
+	return p.publishFrame(ctx, frame, nil)
+}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
+// publishFrame sends frame, which was encoded from batch. The messages are
+// renumbered and the frame re-encoded if other publishes took their
+// sequence numbers in the meantime.
+func (p *Publisher) publishFrame(ctx context.Context, frame []byte, batch []*message.Message) error {
+	start := time.Now()
+	if err := p.breaker.Allow(); err != nil {
+		p.metrics.publish(start, err)
+		return err
+	}
+
+	attempt := p.attempts.Get().(*publishAttempt)
+	defer p.release(attempt)
+
+	attempt.buffer = atomic.MakeBuffer(frame)
+	attempt.length = int32(len(frame))
+	attempt.batch = batch
+	err := p.offer(ctx, attempt)
+	p.breaker.Record(err)
+	p.metrics.publish(start, err)
+	return err
+}
+
+// Codec returns the codec messages are encoded with
+func (p *Publisher) Codec() message.Codec {
+	return p.codec
+}
+
+// IsConnected reports whether a subscriber is connected to the publication
+func (p *Publisher) IsConnected() bool {
+	return p.publication.IsConnected()
+}
+
+// CheckCircuit returns a *CircuitOpenError while publishes are being
+// rejected, without using up a half-open probe
+func (p *Publisher) CheckCircuit() error {
+	return p.breaker.Check()
+}
+
+// CircuitStatus returns the state of the circuit breaker
+func (p *Publisher) CircuitStatus() BreakerStatus {
+	return p.breaker.Status()
+}
+
+// nextSequence returns the sequence number the next published message
+// gets, unless another publish takes it first
+func (p *Publisher) nextSequence() uint64 {
+	p.seqMu.Lock()
+	defer p.seqMu.Unlock()
+	return p.sequence + 1
+}
+
+// encode numbers the messages of attempt.batch from first and encodes them
+// into attempt.buffer, as a batch frame when there are several
+func (p *Publisher) encode(attempt *publishAttempt, first uint64) error {
+	frames := make([][]byte, len(attempt.batch))
+	for i, msg := range attempt.batch {
+		msg.Sequence = first + uint64(i)
+		frame, err := message.Marshal(p.codec, msg)
+		if err != nil {
+			return err
 		}
+		frames[i] = frame
+	}
+
+	frame := frames[0]
+	if len(frames) > 1 {
+		frame = message.AppendBatch(nil, frames...)
+	}
+	attempt.buffer = atomic.MakeBuffer(frame)
+	attempt.length = int32(len(frame))
+	return nil
+}
 
-		result := p.publication.Offer(buffer, 0, length, nil)
+// try makes a single publish attempt and returns the Aeron result code.
+// Messages are numbered while the attempt holds seqMu, and the numbers are
+// only used up when the attempt succeeds. An encoding failure is left in
+// attempt.err, and the result is then meaningless.
+func (p *Publisher) try(attempt *publishAttempt) int64 {
+	p.seqMu.Lock()
+	defer p.seqMu.Unlock()
+	next := p.sequence + 1
 
-		switch {
-		case result == aeronlib.NotConnected:
-			p.logger.Warn("publication not connected, retrying")
-			time.Sleep(100 * time.Millisecond)
-		case result == aeronlib.BackPressured:
-			p.logger.Debug("back pressured, retrying")
-			time.Sleep(10 * time.Millisecond)
-		case result < 0:
-			retries++
-			if retries > maxRetries {
-				return ErrOfferFailed
+	var result int64
+	var published uint64
+	switch {
+	case attempt.buffer == nil:
+		attempt.msg.Sequence = next
+		result = p.claim(attempt)
+		published = 1
+	case attempt.batch != nil:
+		if attempt.batch[0].Sequence != next {
+			if err := p.encode(attempt, next); err != nil {
+				attempt.err = err
+				return 0
 			}
-			time.Sleep(10 * time.Millisecond)
-		default:
+		}
+		result = p.publication.Offer(attempt.buffer, 0, attempt.length, nil)
+		published = uint64(len(attempt.batch))
+	default:
+		return p.publication.Offer(attempt.buffer, 0, attempt.length, nil)
+	}
+
+	if result >= 0 && attempt.err == nil {
+		p.sequence += published
+	}
+	return result
+}
+
+// claim encodes attempt.msg straight into the term buffer
+func (p *Publisher) claim(attempt *publishAttempt) int64 {
+	result := p.publication.TryClaim(attempt.length, &attempt.claim)
+	if result < 0 {
+		return result
+	}
+
+	if err := p.encodeTo(attempt.claim.Buffer(), attempt.claim.Offset(), attempt.msg); err != nil {
+		attempt.claim.Abort()
+		attempt.err = err
+		return result
+	}
+	attempt.claim.Commit()
+	return result
+}
+
+// encodeTo writes msg as a frame into buffer at offset
+func (p *Publisher) encodeTo(buffer *atomic.Buffer, offset int32, msg *message.Message) error {
+	buffer.PutUInt8(offset, uint8(p.codec.ID()))
+	_, err := p.encoder.EncodeTo(buffer, offset+message.FrameHeaderLength, msg)
+	return err
+}
+
+func (p *Publisher) release(attempt *publishAttempt) {
+	attempt.msg = nil
+	attempt.buffer = nil
+	attempt.batch = nil
+	attempt.length = 0
+	attempt.code = 0
+	attempt.err = nil
+	p.attempts.Put(attempt)
+}
+
+// offer retries attempt according to the retry policy until it succeeds,
+// a failure class runs out of budget, or ctx is done
+func (p *Publisher) offer(ctx context.Context, attempt *publishAttempt) error {
+	var retriesByClass [FailureOther + 1]int
+	retries := 0
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return p.offerError(attempt, retries, err)
+		}
+
+		result := p.try(attempt)
+		if attempt.err != nil {
+			// Encoding failed, so nothing was published whatever the result
+			return attempt.err
+		}
+		p.metrics.offer(result)
+		if result >= 0 {
 			p.logger.Debug("message published", "position", result)
 			return nil
 		}
+
+		attempt.code = result
+		class := classify(result)
+		retriesByClass[class]++
+		retries++
+
+		if retriesByClass[class] == 1 {
+			switch class {
+			case FailureNotConnected:
+				p.logger.Warn("publication not connected, retrying")
+			case FailureBackPressured:
+				p.logger.Debug("back pressured, retrying")
+			}
+		}
+
+		// Stop waiting once the publication has been down long enough to
+		// open the circuit; any other failure shows it is connected
+		if class != FailureNotConnected {
+			p.breaker.Connected()
+		} else if p.breaker.NotConnected() {
+			return p.offerError(attempt, retries, p.breaker.Check())
+		}
+
+		if p.retry.exhausted(class, retriesByClass[class]) {
+			return p.offerError(attempt, retries, nil)
+		}
+		p.metrics.retry()
+		if err := p.retry.pause(ctx, retries); err != nil {
+			return p.offerError(attempt, retries, err)
+		}
+	}
+}
+
+// offerError builds the error returned when a publish gives up
+func (p *Publisher) offerError(attempt *publishAttempt, attempts int, cause error) error {
+	if attempt.code == 0 {
+		return cause
 	}
+	return &OfferError{Code: attempt.code, Attempts: attempts, Cause: cause}
 }
 
 // Close releases the publication resources
@@ -0,0 +1,109 @@
+package aeron
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lirm/aeron-go/aeron/atomic"
+
+	"github.com/k-omotani/aeron-sample/internal/message"
+	"github.com/k-omotani/aeron-sample/internal/metrics"
+)
+
+// encodingPublisher returns a publisher without a publication, enough to
+// exercise the encoding half of each publish path
+func encodingPublisher(codec message.Codec) *Publisher {
+	p := &Publisher{codec: codec}
+	p.encoder, _ = codec.(message.BufferEncoder)
+	return p
+}
+
+func benchmarkMessage() *message.Message {
+	return &message.Message{
+		Type:          message.MessageTypeIncrement,
+		Timestamp:     1_700_000_000_000_000_000,
+		RequestID:     "6f1c2a3e-8d4b-4c5a-9e7f-0a1b2c3d4e5f",
+		Payload:       &message.IncrementPayload{Amount: 1, Source: "publisher-a", Name: "page-views"},
+		ReplyChannel:  "aeron:udp?endpoint=publisher-a-driver:40124",
+		ReplyStreamID: 1003,
+	}
+}
+
+func TestClaimEncodingDoesNotAllocate(t *testing.T) {
+	p := encodingPublisher(message.NewBinaryCodec())
+	msg := benchmarkMessage()
+	// Stands in for the term buffer a claim points into
+	claimed := atomic.MakeBuffer(make([]byte, 1024))
+
+	allocs := testing.AllocsPerRun(100, func() {
+		msg.Sequence++
+		if err := p.encodeTo(claimed, 64, msg); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("encoding into a claimed buffer allocated %v times, want 0", allocs)
+	}
+
+	got, err := message.DefaultRegistry().Decode(claimed, 64, message.FrameHeaderLength+p.encoder.EncodedLength(msg))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if got.Sequence != msg.Sequence {
+		t.Errorf("decoded sequence %d, want %d", got.Sequence, msg.Sequence)
+	}
+}
+
+func TestOfferStopsWhenReencodingFails(t *testing.T) {
+	p := encodingPublisher(message.NewBinaryCodec())
+	p.logger = discardLogger()
+	p.RegisterMetrics(metrics.NewRegistry())
+
+	// The batch was numbered before another publish took sequence 8, and
+	// its request ID cannot be binary encoded when it is renumbered
+	msg := benchmarkMessage()
+	msg.RequestID = "not-a-uuid"
+	msg.Sequence = 8
+	attempt := &publishAttempt{batch: []*message.Message{msg}, buffer: atomic.MakeBuffer(make([]byte, 64)), length: 64}
+	p.sequence = 8
+
+	if err := p.offer(context.Background(), attempt); !errors.Is(err, message.ErrInvalidRequestID) {
+		t.Fatalf("offer = %v, want ErrInvalidRequestID", err)
+	}
+	if offers := p.metrics.offers.With("success").Value(); offers != 0 {
+		t.Errorf("counted %v successful offers, want 0", offers)
+	}
+	if p.sequence != 8 {
+		t.Errorf("sequence = %d, want 8 with nothing published", p.sequence)
+	}
+}
+
+func BenchmarkPublishEncoding(b *testing.B) {
+	msg := benchmarkMessage()
+
+	b.Run("claim", func(b *testing.B) {
+		p := encodingPublisher(message.NewBinaryCodec())
+		claimed := atomic.MakeBuffer(make([]byte, 1024))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			msg.Sequence = uint64(i)
+			if err := p.encodeTo(claimed, 0, msg); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	for _, codec := range []message.Codec{message.NewBinaryCodec(), message.NewMsgPackCodec(), message.NewProtobufCodec(), message.NewJSONCodec()} {
+		b.Run("offer/"+codec.Name(), func(b *testing.B) {
+			p := encodingPublisher(codec)
+			attempt := &publishAttempt{batch: []*message.Message{msg}}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := p.encode(attempt, uint64(i)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package aeron
+
+import (
+	"log/slog"
+	"slices"
+	"sync/atomic"
+
+	aeronatomic "github.com/lirm/aeron-go/aeron/atomic"
+	"github.com/lirm/aeron-go/aeron/logbuffer"
+	"github.com/lirm/aeron-go/aeron/logbuffer/term"
+)
+
+// Frame flags from the Aeron data header
+const (
+	flagBegin        uint8 = 0x80
+	flagEnd          uint8 = 0x40
+	flagUnfragmented       = flagBegin | flagEnd
+)
+
+// ReassemblyStats reports fragment reassembly counters
+type ReassemblyStats struct {
+	// Assembled counts fragmented messages delivered whole
+	Assembled int64 `json:"assembled"`
+	// DroppedOversize counts messages discarded for exceeding the maximum size
+	DroppedOversize int64 `json:"droppedOversize"`
+	// DroppedOrphan counts MIDDLE/END fragments that arrived without a BEGIN
+	DroppedOrphan int64 `json:"droppedOrphan"`
+	// Abandoned counts partial messages discarded because a new BEGIN arrived
+	Abandoned int64 `json:"abandoned"`
+	// InProgress is the number of sessions currently holding a partial message
+	InProgress int64 `json:"inProgress"`
+}
+
+// reassemblyBuffer accumulates the fragments of one session's message
+type reassemblyBuffer struct {
+	data     []byte
+	active   bool // a BEGIN has been seen and END is pending
+	dropping bool // the message exceeded the limit; skip until END
+}
+
+// Reassembler sits in front of a fragment handler and rebuilds messages
+// that Aeron split into BEGIN/MIDDLE/END fragments, keyed by session ID.
+// Unfragmented messages are passed through without a copy. With a
+// controlled delegate, a message whose END fragment is aborted keeps its
+// earlier fragments until the END is delivered again.
+//
+// It is not safe for concurrent use; call it from the poll goroutine only.
+// Stats may be read from any goroutine.
+type Reassembler struct {
+	delegate       term.ControlledFragmentHandler
+	maxMessageSize int32
+	sessions       map[int32]*reassemblyBuffer
+	logger         *slog.Logger
+
+	assembled       atomic.Int64
+	droppedOversize atomic.Int64
+	droppedOrphan   atomic.Int64
+	abandoned       atomic.Int64
+	inProgress      atomic.Int64
+}
+
+// NewReassembler wraps delegate, discarding messages larger than maxMessageSize bytes
+func NewReassembler(delegate term.FragmentHandler, maxMessageSize int32, logger *slog.Logger) *Reassembler {
+	return NewControlledReassembler(func(buffer *aeronatomic.Buffer, offset, length int32, header *logbuffer.Header) term.ControlledPollAction {
+		delegate(buffer, offset, length, header)
+		return term.ControlledPollActionContinue
+	}, maxMessageSize, logger)
+}
+
+// NewControlledReassembler wraps a controlled delegate for use with
+// ControlledPoll, discarding messages larger than maxMessageSize bytes
+func NewControlledReassembler(delegate term.ControlledFragmentHandler, maxMessageSize int32, logger *slog.Logger) *Reassembler {
+	return &Reassembler{
+		delegate:       delegate,
+		maxMessageSize: maxMessageSize,
+		sessions:       make(map[int32]*reassemblyBuffer),
+		logger:         logger.With("component", "reassembler"),
+	}
+}
+
+// OnFragment is a term.FragmentHandler that delivers whole messages to the delegate
+func (r *Reassembler) OnFragment(buffer *aeronatomic.Buffer, offset, length int32, header *logbuffer.Header) {
+	r.OnControlledFragment(buffer, offset, length, header)
+}
+
+// OnControlledFragment is a term.ControlledFragmentHandler that delivers
+// whole messages to the delegate and returns its action. Fragments before
+// the END are always consumed.
+func (r *Reassembler) OnControlledFragment(buffer *aeronatomic.Buffer, offset, length int32, header *logbuffer.Header) term.ControlledPollAction {
+	flags := header.Flags()
+	if flags&flagUnfragmented == flagUnfragmented {
+		return r.delegate(buffer, offset, length, header)
+	}
+
+	sessionID := header.SessionId()
+	buf := r.sessions[sessionID]
+	if buf == nil {
+		buf = &reassemblyBuffer{}
+		r.sessions[sessionID] = buf
+	}
+
+	if flags&flagBegin == flagBegin {
+		if buf.active {
+			r.abandoned.Add(1)
+			r.logger.Warn("abandoning partial message", "sessionID", sessionID, "bufferedBytes", len(buf.data))
+			r.reset(buf)
+		}
+		r.start(buf)
+	} else if !buf.active {
+		r.droppedOrphan.Add(1)
+		r.logger.Warn("dropping fragment without BEGIN", "sessionID", sessionID, "length", length)
+		return term.ControlledPollActionContinue
+	}
+
+	buffered := len(buf.data)
+	if !buf.dropping {
+		if int64(len(buf.data))+int64(length) > int64(r.maxMessageSize) {
+			buf.dropping = true
+			buf.data = buf.data[:0]
+			r.droppedOversize.Add(1)
+			r.logger.Warn("dropping oversize message",
+				"sessionID", sessionID,
+				"maxMessageSize", r.maxMessageSize,
+			)
+		} else {
+			start := len(buf.data)
+			buf.data = slices.Grow(buf.data, int(length))[:start+int(length)]
+			buffer.GetBytes(offset, buf.data[start:])
+		}
+	}
+
+	if flags&flagEnd != flagEnd {
+		return term.ControlledPollActionContinue
+	}
+	var action term.ControlledPollAction = term.ControlledPollActionContinue
+	if !buf.dropping && len(buf.data) > 0 {
+		action = r.delegate(aeronatomic.MakeBuffer(buf.data), 0, int32(len(buf.data)), header)
+		if action == term.ControlledPollActionAbort {
+			// The END fragment is delivered again; drop its bytes until then
+			buf.data = buf.data[:buffered]
+			return action
+		}
+		r.assembled.Add(1)
+	}
+	r.reset(buf)
+	return action
+}
+
+// Stats returns a snapshot of the reassembly counters
+func (r *Reassembler) Stats() ReassemblyStats {
+	return ReassemblyStats{
+		Assembled:       r.assembled.Load(),
+		DroppedOversize: r.droppedOversize.Load(),
+		DroppedOrphan:   r.droppedOrphan.Load(),
+		Abandoned:       r.abandoned.Load(),
+		InProgress:      r.inProgress.Load(),
+	}
+}
+
+func (r *Reassembler) start(buf *reassemblyBuffer) {
+	buf.active = true
+	buf.dropping = false
+	buf.data = buf.data[:0]
+	r.inProgress.Add(1)
+}
+
+func (r *Reassembler) reset(buf *reassemblyBuffer) {
+	if buf.active {
+		r.inProgress.Add(-1)
+	}
+	buf.active = false
+	buf.dropping = false
+	buf.data = buf.data[:0]
+}
+
+// Flush discards any partial message of sessionID and forgets the session,
+// once its image has gone away
+func (r *Reassembler) Flush(sessionID int32) {
+	buf, ok := r.sessions[sessionID]
+	if !ok {
+		return
+	}
+	if buf.active {
+		r.abandoned.Add(1)
+		r.logger.Warn("abandoning partial message of closed image", "sessionID", sessionID, "bufferedBytes", len(buf.data))
+	}
+	r.reset(buf)
+	delete(r.sessions, sessionID)
+}
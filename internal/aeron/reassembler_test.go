@@ -0,0 +1,260 @@
+package aeron
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"testing"
+
+	aeronatomic "github.com/lirm/aeron-go/aeron/atomic"
+	"github.com/lirm/aeron-go/aeron/logbuffer"
+	"github.com/lirm/aeron-go/aeron/logbuffer/term"
+	"github.com/lirm/aeron-go/aeron/util"
+)
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// testTerm lays data frames out in a term buffer the way the driver does,
+// so headers report real flags, sessions and positions
+type testTerm struct {
+	buffer *aeronatomic.Buffer
+	tail   int32
+}
+
+const testTermLength = 64 << 10
+
+func newTestTerm() *testTerm {
+	return &testTerm{buffer: aeronatomic.MakeBuffer(make([]byte, testTermLength))}
+}
+
+// fragment is one data frame handed to a fragment handler
+type fragment struct {
+	offset, length int32
+	header         *logbuffer.Header
+}
+
+// append writes a data frame with payload and returns it as the poller
+// would deliver it
+func (t *testTerm) append(sessionID int32, flags uint8, payload []byte) fragment {
+	frameOffset := t.tail
+	frameLength := logbuffer.DataFrameHeader.Length + int32(len(payload))
+	h := logbuffer.DataFrameHeader
+	t.buffer.PutInt32(frameOffset+h.FrameLengthFieldOffset, frameLength)
+	t.buffer.PutUInt8(frameOffset+h.FlagsFieldOffset, flags)
+	t.buffer.PutUInt16(frameOffset+h.TypeFieldOffset, h.TypeData)
+	t.buffer.PutInt32(frameOffset+h.TermOffsetFieldOffset, frameOffset)
+	t.buffer.PutInt32(frameOffset+h.SessionIDFieldOffset, sessionID)
+	t.buffer.PutInt32(frameOffset+h.TermIDFieldOffset, 0)
+	dataOffset := frameOffset + h.Length
+	for i, b := range payload {
+		t.buffer.PutUInt8(dataOffset+int32(i), b)
+	}
+	t.tail += util.AlignInt32(frameLength, logbuffer.FrameAlignment)
+
+	header := new(logbuffer.Header).Wrap(t.buffer.Ptr(), t.buffer.Capacity())
+	header.SetOffset(frameOffset).SetInitialTermID(0).SetPositionBitsToShift(int32(util.NumberOfTrailingZeroes(testTermLength)))
+	return fragment{offset: dataOffset, length: int32(len(payload)), header: header}
+}
+
+// delivered records the messages a reassembler hands to its delegate
+type delivered struct {
+	messages [][]byte
+	sessions []int32
+}
+
+func (d *delivered) handler(buffer *aeronatomic.Buffer, offset, length int32, header *logbuffer.Header) term.ControlledPollAction {
+	data := make([]byte, length)
+	buffer.GetBytes(offset, data)
+	d.messages = append(d.messages, data)
+	d.sessions = append(d.sessions, header.SessionId())
+	return term.ControlledPollActionContinue
+}
+
+func TestReassembler(t *testing.T) {
+	type input struct {
+		session int32
+		flags   uint8
+		payload string
+	}
+	const middle uint8 = 0
+
+	tests := []struct {
+		name     string
+		max      int32
+		input    []input
+		want     []string
+		sessions []int32
+		stats    ReassemblyStats
+	}{
+		{
+			name:     "unfragmented",
+			max:      1024,
+			input:    []input{{1, flagUnfragmented, "whole"}},
+			want:     []string{"whole"},
+			sessions: []int32{1},
+		},
+		{
+			name:     "begin middle end",
+			max:      1024,
+			input:    []input{{1, flagBegin, "he"}, {1, middle, "ll"}, {1, flagEnd, "o"}},
+			want:     []string{"hello"},
+			sessions: []int32{1},
+			stats:    ReassemblyStats{Assembled: 1},
+		},
+		{
+			name: "interleaved sessions",
+			max:  1024,
+			input: []input{
+				{1, flagBegin, "a1"}, {2, flagBegin, "b1"}, {1, middle, "a2"},
+				{3, flagUnfragmented, "c"}, {2, flagEnd, "b2"}, {1, flagEnd, "a3"},
+			},
+			want:     []string{"c", "b1b2", "a1a2a3"},
+			sessions: []int32{3, 2, 1},
+			stats:    ReassemblyStats{Assembled: 2},
+		},
+		{
+			name:     "orphan middle and end",
+			max:      1024,
+			input:    []input{{1, middle, "x"}, {1, flagEnd, "y"}, {1, flagUnfragmented, "z"}},
+			want:     []string{"z"},
+			sessions: []int32{1},
+			stats:    ReassemblyStats{DroppedOrphan: 2},
+		},
+		{
+			name:     "oversize",
+			max:      4,
+			input:    []input{{1, flagBegin, "abc"}, {1, middle, "def"}, {1, flagEnd, "g"}, {1, flagBegin, "ab"}, {1, flagEnd, "cd"}},
+			want:     []string{"abcd"},
+			sessions: []int32{1},
+			stats:    ReassemblyStats{Assembled: 1, DroppedOversize: 1},
+		},
+		{
+			name:     "begin abandons partial",
+			max:      1024,
+			input:    []input{{1, flagBegin, "lost"}, {1, flagBegin, "ke"}, {1, flagEnd, "pt"}},
+			want:     []string{"kept"},
+			sessions: []int32{1},
+			stats:    ReassemblyStats{Assembled: 1, Abandoned: 1},
+		},
+		{
+			name:     "partial message in progress",
+			max:      1024,
+			input:    []input{{1, flagBegin, "a"}, {2, flagBegin, "b"}, {2, flagEnd, "c"}},
+			want:     []string{"bc"},
+			sessions: []int32{2},
+			stats:    ReassemblyStats{Assembled: 1, InProgress: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got delivered
+			r := NewControlledReassembler(got.handler, tt.max, discardLogger())
+			tb := newTestTerm()
+			for _, in := range tt.input {
+				f := tb.append(in.session, in.flags, []byte(in.payload))
+				if action := r.OnControlledFragment(tb.buffer, f.offset, f.length, f.header); action != term.ControlledPollActionContinue {
+					t.Fatalf("action = %d, want continue", action)
+				}
+			}
+
+			if len(got.messages) != len(tt.want) {
+				t.Fatalf("delivered %q, want %q", got.messages, tt.want)
+			}
+			for i, want := range tt.want {
+				if string(got.messages[i]) != want || got.sessions[i] != tt.sessions[i] {
+					t.Errorf("message %d = %q from session %d, want %q from %d", i, got.messages[i], got.sessions[i], want, tt.sessions[i])
+				}
+			}
+			if stats := r.Stats(); stats != tt.stats {
+				t.Errorf("stats = %+v, want %+v", stats, tt.stats)
+			}
+		})
+	}
+}
+
+func TestReassemblerPassesUnfragmentedInPlace(t *testing.T) {
+	tb := newTestTerm()
+	f := tb.append(1, flagUnfragmented, []byte("in place"))
+
+	called := false
+	r := NewControlledReassembler(func(buffer *aeronatomic.Buffer, offset, length int32, header *logbuffer.Header) term.ControlledPollAction {
+		called = true
+		if buffer != tb.buffer || offset != f.offset || length != f.length {
+			t.Errorf("delegate got a copy: offset %d length %d", offset, length)
+		}
+		return term.ControlledPollActionContinue
+	}, 1024, discardLogger())
+	r.OnControlledFragment(tb.buffer, f.offset, f.length, f.header)
+	if !called {
+		t.Fatal("delegate not called")
+	}
+}
+
+func TestReassemblerAbortedEnd(t *testing.T) {
+	tb := newTestTerm()
+	begin := tb.append(1, flagBegin, []byte("abc"))
+	end := tb.append(1, flagEnd, []byte("def"))
+
+	var got [][]byte
+	abort := 2
+	r := NewControlledReassembler(func(buffer *aeronatomic.Buffer, offset, length int32, header *logbuffer.Header) term.ControlledPollAction {
+		data := make([]byte, length)
+		buffer.GetBytes(offset, data)
+		got = append(got, data)
+		if abort > 0 {
+			abort--
+			return term.ControlledPollActionAbort
+		}
+		return term.ControlledPollActionContinue
+	}, 1024, discardLogger())
+
+	if action := r.OnControlledFragment(tb.buffer, begin.offset, begin.length, begin.header); action != term.ControlledPollActionContinue {
+		t.Fatalf("BEGIN action = %d, want continue", action)
+	}
+	// The poller redelivers an aborted fragment until it is consumed
+	for i := 0; i < 3; i++ {
+		action := r.OnControlledFragment(tb.buffer, end.offset, end.length, end.header)
+		want := term.ControlledPollActionAbort
+		if i == 2 {
+			want = term.ControlledPollActionContinue
+		}
+		if action != want {
+			t.Fatalf("END delivery %d action = %d, want %d", i, action, want)
+		}
+	}
+
+	for i, data := range got {
+		if !bytes.Equal(data, []byte("abcdef")) {
+			t.Errorf("delivery %d = %q, want %q", i, data, "abcdef")
+		}
+	}
+	if len(got) != 3 {
+		t.Errorf("delegate called %d times, want 3", len(got))
+	}
+	if stats := r.Stats(); stats != (ReassemblyStats{Assembled: 1}) {
+		t.Errorf("stats = %+v, want one assembled", stats)
+	}
+}
+
+func TestReassemblerFlush(t *testing.T) {
+	var got delivered
+	r := NewControlledReassembler(got.handler, 1024, discardLogger())
+	tb := newTestTerm()
+	f := tb.append(7, flagBegin, []byte("partial"))
+	r.OnControlledFragment(tb.buffer, f.offset, f.length, f.header)
+
+	r.Flush(7)
+	r.Flush(8) // unknown sessions are ignored
+
+	f = tb.append(7, flagEnd, []byte("tail"))
+	r.OnControlledFragment(tb.buffer, f.offset, f.length, f.header)
+	if len(got.messages) != 0 {
+		t.Errorf("delivered %q after flush", got.messages)
+	}
+	want := ReassemblyStats{Abandoned: 1, DroppedOrphan: 1}
+	if stats := r.Stats(); stats != want {
+		t.Errorf("stats = %+v, want %+v", stats, want)
+	}
+}
@@ -0,0 +1,263 @@
+package aeron
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	aeronlib "github.com/lirm/aeron-go/aeron"
+	"github.com/lirm/aeron-go/aeron/idlestrategy"
+	"github.com/lirm/aeron-go/archive"
+	"github.com/lirm/aeron-go/archive/codecs"
+)
+
+// ErrReplayImageTimeout means a replay was started but its image never
+// appeared on the replay subscription
+var ErrReplayImageTimeout = errors.New("replay image did not appear")
+
+// maxRecordings bounds how many recordings of the stream are replayed
+const maxRecordings = 1000
+
+// ArchiveConfig configures recording and replay through Aeron Archive.
+// The archive must run in the subscriber's media driver
+// (an ArchivingMediaDriver), so its channels are local to that driver.
+type ArchiveConfig struct {
+	// Enabled turns on recording of the stream and replay at startup
+	Enabled bool
+
+	// ControlChannel and ControlStreamID reach the archive's control endpoint
+	ControlChannel  string
+	ControlStreamID int32
+
+	// ResponseChannel and ResponseStreamID receive control responses
+	ResponseChannel  string
+	ResponseStreamID int32
+
+	// ReplayChannel and ReplayStreamID carry replayed recordings
+	ReplayChannel  string
+	ReplayStreamID int32
+
+	// Timeout bounds each archive control request
+	Timeout time.Duration
+	// ImageTimeout bounds how long a started replay may take to appear as
+	// an image on the replay subscription
+	ImageTimeout time.Duration
+}
+
+// Replayer records the subscriber's stream in Aeron Archive and replays
+// it to rebuild state before the live stream is consumed.
+type Replayer struct {
+	archive      *archive.Archive
+	config       *Config
+	logger       *slog.Logger
+	idleStrategy idlestrategy.Idler
+}
+
+// NewReplayer connects an archive client through the media driver in
+// config.AeronDir
+func NewReplayer(config *Config, logger *slog.Logger) (*Replayer, error) {
+	aeronCtx := aeronlib.NewContext()
+	aeronCtx.AeronDir(config.AeronDir)
+	aeronCtx.MediaDriverTimeout(config.MediaDriverTimeout)
+
+	options := archive.DefaultOptions()
+	options.RequestChannel = config.Archive.ControlChannel
+	options.RequestStream = config.Archive.ControlStreamID
+	options.ResponseChannel = config.Archive.ResponseChannel
+	options.ResponseStream = config.Archive.ResponseStreamID
+	options.Timeout = config.Archive.Timeout
+
+	arch, err := archive.NewArchive(options, aeronCtx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to archive: %w", err)
+	}
+
+	return &Replayer{
+		archive:      arch,
+		config:       config,
+		logger:       logger.With("component", "replayer"),
+		idleStrategy: config.Poll.NewIdler(),
+	}, nil
+}
+
+// EnsureRecording starts recording the configured channel and stream
+// unless the archive is already recording it
+func (r *Replayer) EnsureRecording() error {
+	subscriptions, err := r.archive.ListRecordingSubscriptions(0, 1, true, r.config.StreamID, r.config.Channel)
+	if err != nil {
+		return fmt.Errorf("failed to list recording subscriptions: %w", err)
+	}
+	if len(subscriptions) > 0 {
+		r.logger.Info("stream already being recorded",
+			"channel", r.config.Channel,
+			"streamID", r.config.StreamID,
+		)
+		return nil
+	}
+
+	if _, err := r.archive.StartRecording(r.config.Channel, r.config.StreamID, false, false); err != nil {
+		return fmt.Errorf("failed to start recording: %w", err)
+	}
+	r.logger.Info("recording started",
+		"channel", r.config.Channel,
+		"streamID", r.config.StreamID,
+	)
+	return nil
+}
+
+// Replay feeds every recording of the stream to subscriber, starting each
+// publisher session after the position in from (or at the start of the
+// recording) and returns the position reached per session.
+//
+// It must run before subscriber.Start. A session whose publisher is still
+// connected, or connects while its recording is replayed, is replayed up
+// to the position its live image joined at, so live polling picks up
+// exactly where the replay ends. Sessions are
+// replayed one after another in recording order.
+func (r *Replayer) Replay(ctx context.Context, subscriber *Subscriber, from map[int32]int64) (map[int32]int64, error) {
+	descriptors, err := r.archive.ListRecordingsForUri(0, maxRecordings, r.config.Channel, r.config.StreamID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recordings: %w", err)
+	}
+	// The archive reuses its result slice between requests
+	recordings := make([]codecs.RecordingDescriptor, len(descriptors))
+	for i, d := range descriptors {
+		recordings[i] = *d
+	}
+	sort.Slice(recordings, func(i, j int) bool { return recordings[i].RecordingId < recordings[j].RecordingId })
+
+	reached := make(map[int32]int64, len(from)+len(recordings))
+	for session, position := range from {
+		reached[session] = position
+	}
+	subscriber.gaps.seed(from)
+
+	for _, rec := range recordings {
+		start := max(rec.StartPosition, reached[rec.SessionId])
+		stop, err := r.stopPosition(&rec, subscriber)
+		if err != nil {
+			return nil, err
+		}
+		if start >= stop {
+			continue
+		}
+
+		for start < stop {
+			r.logger.Info("replaying recording",
+				"recordingID", rec.RecordingId,
+				"sessionID", rec.SessionId,
+				"from", start,
+				"to", stop,
+			)
+			position, err := r.replayRecording(ctx, subscriber, &rec, start, stop)
+			if position > reached[rec.SessionId] {
+				reached[rec.SessionId] = position
+			}
+			if err != nil {
+				return reached, err
+			}
+
+			// A publisher that connected during the replay joined past the
+			// recording position the replay stopped at; carry on up to it
+			join, live := liveJoinPosition(&rec, subscriber)
+			if !live || position <= start {
+				break
+			}
+			start, stop = position, join
+		}
+	}
+
+	r.logger.Info("replay complete", "recordings", len(recordings), "sessions", len(reached))
+	return reached, nil
+}
+
+// stopPosition returns where the replay of rec should end: the live join
+// position when its publisher is connected, otherwise the end of the recording
+func (r *Replayer) stopPosition(rec *codecs.RecordingDescriptor, subscriber *Subscriber) (int64, error) {
+	if join, live := liveJoinPosition(rec, subscriber); live {
+		return join, nil
+	}
+	if rec.StopPosition != archive.RecordingPositionNull {
+		return rec.StopPosition, nil
+	}
+	position, err := r.archive.GetRecordingPosition(rec.RecordingId)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get recording position of %d: %w", rec.RecordingId, err)
+	}
+	return position, nil
+}
+
+// liveJoinPosition returns the position the live image of the publisher of
+// rec joined at, and false while the publisher is not connected
+func liveJoinPosition(rec *codecs.RecordingDescriptor, subscriber *Subscriber) (int64, bool) {
+	image := subscriber.subscription.ImageBySessionID(rec.SessionId)
+	if image == nil {
+		return 0, false
+	}
+	// The live image has not been polled yet, so it sits at its join position
+	return image.Position(), true
+}
+
+// replayRecording replays rec from start to stop and returns the last
+// position handed to the subscriber, also when the replay fails part way
+func (r *Replayer) replayRecording(ctx context.Context, subscriber *Subscriber, rec *codecs.RecordingDescriptor, start, stop int64) (int64, error) {
+	replayChannel := r.config.Archive.ReplayChannel
+	replayStreamID := r.config.Archive.ReplayStreamID
+
+	replaySessionID, err := r.archive.StartReplay(rec.RecordingId, start, stop-start, replayChannel, replayStreamID)
+	if err != nil {
+		return start, fmt.Errorf("failed to start replay of %d: %w", rec.RecordingId, err)
+	}
+
+	imageSessionID := archive.ReplaySessionIdToSessionId(replaySessionID)
+	channel, err := archive.AddSessionIdToChannel(replayChannel, imageSessionID)
+	if err != nil {
+		r.archive.StopReplay(replaySessionID)
+		return start, err
+	}
+	subscription, err := r.archive.AddSubscription(channel, replayStreamID)
+	if err != nil {
+		r.archive.StopReplay(replaySessionID)
+		return start, err
+	}
+	defer subscription.Close()
+
+	handler := subscriber.replayHandler(rec.SessionId)
+	seen := false
+	position := start
+	deadline := time.Now().Add(r.config.Archive.ImageTimeout)
+	for {
+		if err := ctx.Err(); err != nil {
+			r.archive.StopReplay(replaySessionID)
+			return position, err
+		}
+
+		fragments := subscription.ControlledPoll(handler, r.config.Poll.FragmentLimit)
+
+		image := subscription.ImageBySessionID(imageSessionID)
+		switch {
+		case image != nil:
+			seen = true
+			position = image.Position()
+			if position >= stop || image.IsEndOfStream() {
+				return position, nil
+			}
+		case seen:
+			// The replay image went away before reaching stop
+			return position, fmt.Errorf("replay of recording %d ended early at %d of %d", rec.RecordingId, position, stop)
+		case time.Now().After(deadline):
+			r.archive.StopReplay(replaySessionID)
+			return position, fmt.Errorf("%w: recording %d after %s", ErrReplayImageTimeout, rec.RecordingId, r.config.Archive.ImageTimeout)
+		}
+
+		r.idleStrategy.Idle(fragments)
+	}
+}
+
+// Close disconnects from the archive
+func (r *Replayer) Close() error {
+	return r.archive.Close()
+}
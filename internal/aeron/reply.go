@@ -0,0 +1,415 @@
+package aeron
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	aeronlib "github.com/lirm/aeron-go/aeron"
+	aeronatomic "github.com/lirm/aeron-go/aeron/atomic"
+	"github.com/lirm/aeron-go/aeron/idlestrategy"
+	"github.com/lirm/aeron-go/aeron/logbuffer"
+	"github.com/lirm/aeron-go/aeron/logbuffer/term"
+
+	"github.com/k-omotani/aeron-sample/internal/message"
+)
+
+// ReplyConfig configures the reply stream from the subscriber back to
+// each publisher
+type ReplyConfig struct {
+	// Channel is carried in the envelope of messages that want a reply and
+	// is where the subscriber sends it, e.g.
+	// "aeron:udp?endpoint=publisher-a-driver:40124". Empty disables replies.
+	Channel string
+
+	// ListenChannel is the publisher's subscription for replies, e.g.
+	// "aeron:udp?endpoint=0.0.0.0:40124". Empty means Channel.
+	ListenChannel string
+
+	// StreamID carries the replies
+	StreamID int32
+
+	// QueueSize bounds replies waiting to be sent by the subscriber;
+	// replies beyond it are dropped and counted
+	QueueSize int
+
+	// SendTimeout bounds how long the subscriber tries to send one reply,
+	// including waiting for a new reply publication to connect
+	SendTimeout time.Duration
+
+	// AllowedChannels are the channel prefixes the subscriber sends replies
+	// to, e.g. "aeron:udp?endpoint=publisher-a-driver:". Replies to any
+	// other channel are rejected; empty rejects every reply.
+	AllowedChannels []string
+
+	// MaxPublications bounds the reply publications the subscriber keeps
+	// open; the least recently used one is closed to make room
+	MaxPublications int
+
+	// PublicationIdleTimeout closes reply publications unused for this long
+	PublicationIdleTimeout time.Duration
+}
+
+// ReplyStats reports reply stream counters
+type ReplyStats struct {
+	Sent      int64 `json:"sent"`
+	Dropped   int64 `json:"dropped"`
+	Rejected  int64 `json:"rejected"` // replies to channels that are not allowed
+	Received  int64 `json:"received"`
+	Unmatched int64 `json:"unmatched"` // replies no request was waiting for
+}
+
+// replyTarget identifies a reply publication
+type replyTarget struct {
+	channel  string
+	streamID int32
+}
+
+// outgoingReply is a reply queued for the sender goroutine
+type outgoingReply struct {
+	target replyTarget
+	msg    *message.Message
+}
+
+// replyPublication is the part of an Aeron publication the reply sender uses
+type replyPublication interface {
+	Offer(buffer *aeronatomic.Buffer, offset, length int32, reservedValueSupplier term.ReservedValueSupplier) int64
+	Close() error
+}
+
+// openPublication is a reply publication and when it last sent a reply
+type openPublication struct {
+	publication replyPublication
+	lastUsed    time.Time
+}
+
+// ReplySender sends replies from the subscriber to the channel named in
+// each request, as long as it is one of the allowed channels. Replies are
+// queued so the poll loop never waits on a send; publications are added
+// the first time a reply channel is seen and closed once idle.
+type ReplySender struct {
+	addPublication func(channel string, streamID int32) (replyPublication, error)
+	codec          message.Codec
+	config         ReplyConfig
+	queue          chan outgoingReply
+	publications   map[replyTarget]*openPublication // owned by the run goroutine
+	now            func() time.Time
+	logger         *slog.Logger
+	stopped        chan struct{}
+
+	sent     atomic.Int64
+	dropped  atomic.Int64
+	rejected atomic.Int64
+}
+
+// NewReplySender creates a reply sender that encodes replies with codec
+func NewReplySender(aeron *aeronlib.Aeron, config *Config, codec message.Codec, logger *slog.Logger) *ReplySender {
+	return newReplySender(func(channel string, streamID int32) (replyPublication, error) {
+		return aeron.AddPublication(channel, streamID)
+	}, config.Reply, codec, logger)
+}
+
+func newReplySender(add func(channel string, streamID int32) (replyPublication, error), config ReplyConfig, codec message.Codec, logger *slog.Logger) *ReplySender {
+	return &ReplySender{
+		addPublication: add,
+		codec:          codec,
+		config:         config,
+		queue:          make(chan outgoingReply, max(config.QueueSize, 1)),
+		publications:   make(map[replyTarget]*openPublication),
+		now:            time.Now,
+		logger:         logger.With("component", "reply-sender"),
+		stopped:        make(chan struct{}),
+	}
+}
+
+// Start begins sending queued replies in a goroutine until ctx is done
+func (s *ReplySender) Start(ctx context.Context) {
+	go s.run(ctx)
+}
+
+// Send queues reply for channel and streamID without blocking. It returns
+// false if the channel is not allowed or the queue is full, and the reply
+// was not queued.
+func (s *ReplySender) Send(channel string, streamID int32, reply *message.Message) bool {
+	if !s.allowed(channel) {
+		s.rejected.Add(1)
+		s.logger.Warn("reply channel not allowed, reply rejected",
+			"requestID", reply.RequestID,
+			"channel", channel,
+			"streamID", streamID,
+		)
+		return false
+	}
+	select {
+	case s.queue <- outgoingReply{target: replyTarget{channel: channel, streamID: streamID}, msg: reply}:
+		return true
+	default:
+		s.dropped.Add(1)
+		s.logger.Warn("reply queue full, reply dropped", "requestID", reply.RequestID)
+		return false
+	}
+}
+
+// allowed reports whether channel starts with one of the allowed prefixes
+func (s *ReplySender) allowed(channel string) bool {
+	for _, prefix := range s.config.AllowedChannels {
+		if prefix != "" && strings.HasPrefix(channel, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Stats returns the reply counters
+func (s *ReplySender) Stats() ReplyStats {
+	return ReplyStats{Sent: s.sent.Load(), Dropped: s.dropped.Load(), Rejected: s.rejected.Load()}
+}
+
+func (s *ReplySender) run(ctx context.Context) {
+	defer close(s.stopped)
+	defer func() {
+		for target := range s.publications {
+			s.closePublication(target, "stopped")
+		}
+	}()
+
+	var idle <-chan time.Time
+	if s.config.PublicationIdleTimeout > 0 {
+		ticker := time.NewTicker(s.config.PublicationIdleTimeout / 2)
+		defer ticker.Stop()
+		idle = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-idle:
+			s.closeIdle()
+		case reply := <-s.queue:
+			if err := s.send(ctx, reply); err != nil {
+				s.dropped.Add(1)
+				s.logger.Warn("failed to send reply",
+					"requestID", reply.msg.RequestID,
+					"channel", reply.target.channel,
+					"error", err,
+				)
+				continue
+			}
+			s.sent.Add(1)
+		}
+	}
+}
+
+func (s *ReplySender) send(ctx context.Context, reply outgoingReply) error {
+	publication, err := s.publication(reply.target)
+	if err != nil {
+		return err
+	}
+	buffer, length, err := message.ToBuffer(s.codec, reply.msg)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.SendTimeout)
+	defer cancel()
+
+	for {
+		result := publication.Offer(buffer, 0, length, nil)
+		if result >= 0 {
+			return nil
+		}
+		switch classify(result) {
+		case FailureNotConnected, FailureBackPressured, FailureAdminAction:
+		default:
+			return &OfferError{Code: result, Attempts: 1}
+		}
+		select {
+		case <-ctx.Done():
+			return &OfferError{Code: result, Attempts: 1, Cause: ctx.Err()}
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+// publication returns the publication for target, adding it on first use
+// and closing the least recently used one when MaxPublications are open
+func (s *ReplySender) publication(target replyTarget) (replyPublication, error) {
+	now := s.now()
+	if open, ok := s.publications[target]; ok {
+		open.lastUsed = now
+		return open.publication, nil
+	}
+
+	if s.config.MaxPublications > 0 && len(s.publications) >= s.config.MaxPublications {
+		var oldest replyTarget
+		var oldestUsed time.Time
+		for t, open := range s.publications {
+			if oldestUsed.IsZero() || open.lastUsed.Before(oldestUsed) {
+				oldest, oldestUsed = t, open.lastUsed
+			}
+		}
+		s.closePublication(oldest, "limit")
+	}
+
+	publication, err := s.addPublication(target.channel, target.streamID)
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Info("reply publication added", "channel", target.channel, "streamID", target.streamID)
+	s.publications[target] = &openPublication{publication: publication, lastUsed: now}
+	return publication, nil
+}
+
+// closeIdle closes the publications unused for PublicationIdleTimeout
+func (s *ReplySender) closeIdle() {
+	cutoff := s.now().Add(-s.config.PublicationIdleTimeout)
+	for target, open := range s.publications {
+		if open.lastUsed.Before(cutoff) {
+			s.closePublication(target, "idle")
+		}
+	}
+}
+
+func (s *ReplySender) closePublication(target replyTarget, reason string) {
+	if err := s.publications[target].publication.Close(); err != nil {
+		s.logger.Warn("failed to close reply publication", "channel", target.channel, "error", err)
+	}
+	delete(s.publications, target)
+	s.logger.Info("reply publication closed",
+		"channel", target.channel,
+		"streamID", target.streamID,
+		"reason", reason,
+	)
+}
+
+// Close waits for the sender goroutine to stop after its context is done
+func (s *ReplySender) Close() {
+	<-s.stopped
+}
+
+// ReplyReceiver subscribes to the reply stream on the publisher and hands
+// each reply to the request waiting for it
+type ReplyReceiver struct {
+	subscription *aeronlib.Subscription
+	registry     *message.Registry
+	reassembler  *Reassembler
+	config       ReplyConfig
+	logger       *slog.Logger
+	idleStrategy idlestrategy.Idler
+
+	mu      sync.Mutex
+	pending map[string][]chan *message.ReplyPayload
+
+	received  atomic.Int64
+	unmatched atomic.Int64
+}
+
+// NewReplyReceiver subscribes to config.Reply.ListenChannel, or
+// config.Reply.Channel when no listen channel is set
+func NewReplyReceiver(aeron *aeronlib.Aeron, config *Config, registry *message.Registry, logger *slog.Logger) (*ReplyReceiver, error) {
+	channel := config.Reply.ListenChannel
+	if channel == "" {
+		channel = config.Reply.Channel
+	}
+	subscription, err := aeron.AddSubscription(channel, config.Reply.StreamID)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &ReplyReceiver{
+		subscription: subscription,
+		registry:     registry,
+		config:       config.Reply,
+		logger:       logger.With("component", "reply-receiver"),
+		idleStrategy: idlestrategy.Sleeping{SleepFor: time.Millisecond},
+		pending:      make(map[string][]chan *message.ReplyPayload),
+	}
+	r.reassembler = NewReassembler(r.onMessage, config.MaxMessageSize, logger)
+	return r, nil
+}
+
+// Channel returns the reply channel and stream ID to put in the envelope
+func (r *ReplyReceiver) Channel() (string, int32) {
+	return r.config.Channel, r.config.StreamID
+}
+
+// Expect registers interest in the reply to requestID. It must be called
+// before the request is published. The returned cancel func must be
+// called once the caller stops waiting.
+func (r *ReplyReceiver) Expect(requestID string) (<-chan *message.ReplyPayload, func()) {
+	ch := make(chan *message.ReplyPayload, 1)
+
+	r.mu.Lock()
+	r.pending[requestID] = append(r.pending[requestID], ch)
+	r.mu.Unlock()
+
+	return ch, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		waiters := r.pending[requestID]
+		for i, w := range waiters {
+			if w == ch {
+				waiters = append(waiters[:i], waiters[i+1:]...)
+				break
+			}
+		}
+		if len(waiters) == 0 {
+			delete(r.pending, requestID)
+		} else {
+			r.pending[requestID] = waiters
+		}
+	}
+}
+
+// Stats returns the reply counters
+func (r *ReplyReceiver) Stats() ReplyStats {
+	return ReplyStats{Received: r.received.Load(), Unmatched: r.unmatched.Load()}
+}
+
+// Start begins polling for replies in a goroutine
+func (r *ReplyReceiver) Start(ctx context.Context) {
+	go r.pollLoop(ctx)
+}
+
+func (r *ReplyReceiver) pollLoop(ctx context.Context) {
+	for ctx.Err() == nil {
+		r.idleStrategy.Idle(r.subscription.Poll(r.reassembler.OnFragment, 10))
+	}
+}
+
+func (r *ReplyReceiver) onMessage(buffer *aeronatomic.Buffer, offset, length int32, header *logbuffer.Header) {
+	msg, err := r.registry.Decode(buffer, offset, length)
+	if err != nil {
+		r.logger.Error("failed to decode reply", "error", err)
+		return
+	}
+	reply, err := msg.DecodeReplyPayload()
+	if err != nil {
+		r.logger.Error("unexpected message on reply stream", "type", msg.Type, "requestID", msg.RequestID)
+		return
+	}
+	r.received.Add(1)
+
+	r.mu.Lock()
+	waiters := r.pending[msg.RequestID]
+	delete(r.pending, msg.RequestID)
+	r.mu.Unlock()
+
+	if len(waiters) == 0 {
+		r.unmatched.Add(1)
+		r.logger.Debug("reply without a waiting request", "requestID", msg.RequestID)
+		return
+	}
+	for _, ch := range waiters {
+		ch <- reply // buffered; each waiter receives at most one reply
+	}
+}
+
+// Close releases the subscription resources
+func (r *ReplyReceiver) Close() error {
+	return r.subscription.Close()
+}
@@ -0,0 +1,129 @@
+package aeron
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	aeronatomic "github.com/lirm/aeron-go/aeron/atomic"
+	"github.com/lirm/aeron-go/aeron/logbuffer/term"
+
+	"github.com/k-omotani/aeron-sample/internal/message"
+)
+
+// fakePublication accepts every offer
+type fakePublication struct {
+	offers int
+	closed bool
+}
+
+func (p *fakePublication) Offer(*aeronatomic.Buffer, int32, int32, term.ReservedValueSupplier) int64 {
+	p.offers++
+	return int64(p.offers)
+}
+
+func (p *fakePublication) Close() error {
+	p.closed = true
+	return nil
+}
+
+// newTestReplySender returns a reply sender whose publications are fakes,
+// recorded in added by channel
+func newTestReplySender(config ReplyConfig) (*ReplySender, map[string]*fakePublication, *fakeClock) {
+	added := make(map[string]*fakePublication)
+	s := newReplySender(func(channel string, streamID int32) (replyPublication, error) {
+		p := &fakePublication{}
+		added[channel] = p
+		return p, nil
+	}, config, message.NewBinaryCodec(), discardLogger())
+	clock := &fakeClock{t: time.Unix(1_700_000_000, 0)}
+	s.now = clock.now
+	return s, added, clock
+}
+
+func testReply(t *testing.T) *message.Message {
+	t.Helper()
+	reply, err := message.NewReplyMessage("6f1c2a3e-8d4b-4c5a-9e7f-0a1b2c3d4e5f", &message.ReplyPayload{Status: "applied", Counter: "page-views", Value: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reply
+}
+
+func TestReplySenderAllowedChannels(t *testing.T) {
+	s, _, _ := newTestReplySender(ReplyConfig{
+		QueueSize:       8,
+		AllowedChannels: []string{"aeron:udp?endpoint=publisher-a-driver:", "", "aeron:ipc"},
+	})
+	tests := []struct {
+		channel string
+		want    bool
+	}{
+		{"aeron:udp?endpoint=publisher-a-driver:40124", true},
+		{"aeron:ipc", true},
+		{"aeron:udp?endpoint=attacker:40124", false},
+		{"aeron:udp?endpoint=publisher-a", false},
+		{"", false},
+	}
+	var rejected int64
+	for _, tt := range tests {
+		if got := s.Send(tt.channel, 1003, testReply(t)); got != tt.want {
+			t.Errorf("Send(%q) = %v, want %v", tt.channel, got, tt.want)
+		}
+		if !tt.want {
+			rejected++
+		}
+	}
+	if stats := s.Stats(); stats.Rejected != rejected || stats.Dropped != 0 {
+		t.Errorf("stats = %+v, want %d rejected and none dropped", stats, rejected)
+	}
+
+	if s, _, _ := newTestReplySender(ReplyConfig{QueueSize: 8}); s.Send("aeron:ipc", 1003, testReply(t)) {
+		t.Error("Send without allowed channels queued the reply")
+	}
+}
+
+func TestReplySenderEvictsPublications(t *testing.T) {
+	s, added, clock := newTestReplySender(ReplyConfig{
+		SendTimeout:            time.Second,
+		MaxPublications:        2,
+		PublicationIdleTimeout: time.Minute,
+	})
+	send := func(channel string) {
+		t.Helper()
+		target := replyTarget{channel: channel, streamID: 1003}
+		if err := s.send(context.Background(), outgoingReply{target: target, msg: testReply(t)}); err != nil {
+			t.Fatalf("send to %s: %v", channel, err)
+		}
+		clock.advance(time.Second)
+	}
+
+	send("a")
+	send("b")
+	send("a")
+	// At the limit the least recently used publication makes room
+	send("c")
+	if !added["b"].closed || added["a"].closed || added["c"].closed {
+		t.Errorf("closed a=%v b=%v c=%v, want only b", added["a"].closed, added["b"].closed, added["c"].closed)
+	}
+	if len(s.publications) != 2 {
+		t.Errorf("%d publications open, want 2", len(s.publications))
+	}
+
+	// A closed publication is added again when it is needed
+	send("b")
+	if added["b"].closed || !added["a"].closed {
+		t.Error("b was not re-added in place of a")
+	}
+
+	clock.advance(30 * time.Second)
+	send("b")
+	clock.advance(31 * time.Second)
+	s.closeIdle()
+	if !added["c"].closed || added["b"].closed {
+		t.Errorf("closed b=%v c=%v after idle timeout, want only c", added["b"].closed, added["c"].closed)
+	}
+	if len(s.publications) != 1 {
+		t.Errorf("%d publications open, want 1", len(s.publications))
+	}
+}
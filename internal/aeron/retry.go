@@ -0,0 +1,248 @@
+package aeron
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"runtime"
+	"time"
+
+	aeronlib "github.com/lirm/aeron-go/aeron"
+)
+
+var (
+	ErrAdminAction         = errors.New("publication admin action")
+	ErrPublicationClosed   = errors.New("publication closed")
+	ErrMaxPositionExceeded = errors.New("publication max position exceeded")
+)
+
+// Unlimited disables the retry budget of a failure class
+const Unlimited = -1
+
+// FailureClass groups the negative Aeron offer results
+type FailureClass uint8
+
+const (
+	FailureNotConnected FailureClass = iota
+	FailureBackPressured
+	FailureAdminAction
+	FailureClosed
+	FailureMaxPositionExceeded
+	FailureOther
+)
+
+// String returns a short name of the class
+func (c FailureClass) String() string {
+	switch c {
+	case FailureNotConnected:
+		return "not_connected"
+	case FailureBackPressured:
+		return "back_pressured"
+	case FailureAdminAction:
+		return "admin_action"
+	case FailureClosed:
+		return "closed"
+	case FailureMaxPositionExceeded:
+		return "max_position_exceeded"
+	default:
+		return "other"
+	}
+}
+
+// classify maps an Aeron offer result code to its failure class
+func classify(code int64) FailureClass {
+	switch code {
+	case aeronlib.NotConnected:
+		return FailureNotConnected
+	case aeronlib.BackPressured:
+		return FailureBackPressured
+	case aeronlib.AdminAction:
+		return FailureAdminAction
+	case aeronlib.PublicationClosed:
+		return FailureClosed
+	case aeronlib.MaxPositionExceeded:
+		return FailureMaxPositionExceeded
+	default:
+		return FailureOther
+	}
+}
+
+// sentinel returns the error value matching a failure class
+func (c FailureClass) sentinel() error {
+	switch c {
+	case FailureNotConnected:
+		return ErrNotConnected
+	case FailureBackPressured:
+		return ErrBackPressured
+	case FailureAdminAction:
+		return ErrAdminAction
+	case FailureClosed:
+		return ErrPublicationClosed
+	case FailureMaxPositionExceeded:
+		return ErrMaxPositionExceeded
+	default:
+		return nil
+	}
+}
+
+// OfferError reports the Aeron result code that ended a publish.
+// It matches ErrOfferFailed and the sentinel for its class with errors.Is,
+// plus the context error when the publish was cut short by its context.
+type OfferError struct {
+	// Code is the last negative result from Offer or TryClaim
+	Code int64
+	// Attempts is the number of offers made
+	Attempts int
+	// Cause is set when the context ended the retries
+	Cause error
+}
+
+func (e *OfferError) Error() string {
+	msg := fmt.Sprintf("offer failed: %s (code %d) after %d attempts", classify(e.Code), e.Code, e.Attempts)
+	if e.Cause != nil {
+		msg += ": " + e.Cause.Error()
+	}
+	return msg
+}
+
+func (e *OfferError) Unwrap() []error {
+	errs := []error{ErrOfferFailed}
+	if sentinel := classify(e.Code).sentinel(); sentinel != nil {
+		errs = append(errs, sentinel)
+	}
+	if e.Cause != nil {
+		errs = append(errs, e.Cause)
+	}
+	return errs
+}
+
+// Class returns the failure class of the result code
+func (e *OfferError) Class() FailureClass {
+	return classify(e.Code)
+}
+
+// RetryPolicy controls how Publisher retries a failed offer.
+// Each retry first busy-spins, then yields the processor, then sleeps with
+// exponential backoff and jitter. Every failure class has its own budget
+// of retries per publish; the context bounds the total time.
+type RetryPolicy struct {
+	// SpinAttempts is the number of retries made immediately
+	SpinAttempts int
+	// YieldAttempts is the number of retries made after runtime.Gosched
+	YieldAttempts int
+	// InitialBackoff is the first sleep once spinning and yielding are exhausted
+	InitialBackoff time.Duration
+	// MaxBackoff caps the sleep between retries
+	MaxBackoff time.Duration
+	// Multiplier grows the backoff after each sleep
+	Multiplier float64
+	// Jitter randomizes each sleep by up to this fraction (0 to 1)
+	Jitter float64
+
+	// Retry budgets per failure class; Unlimited retries until the context ends
+	MaxNotConnected        int
+	MaxBackPressured       int
+	MaxAdminAction         int
+	MaxClosed              int
+	MaxMaxPositionExceeded int
+}
+
+// DefaultRetryPolicy returns a policy that rides out back pressure and
+// disconnects until the context ends and fails fast on closed publications
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		SpinAttempts:           10,
+		YieldAttempts:          10,
+		InitialBackoff:         time.Millisecond,
+		MaxBackoff:             100 * time.Millisecond,
+		Multiplier:             2,
+		Jitter:                 0.2,
+		MaxNotConnected:        Unlimited,
+		MaxBackPressured:       Unlimited,
+		MaxAdminAction:         100,
+		MaxClosed:              0,
+		MaxMaxPositionExceeded: 0,
+	}
+}
+
+// Budget returns the retry budget of a failure class
+func (p RetryPolicy) Budget(class FailureClass) int {
+	switch class {
+	case FailureNotConnected:
+		return p.MaxNotConnected
+	case FailureBackPressured:
+		return p.MaxBackPressured
+	case FailureAdminAction:
+		return p.MaxAdminAction
+	case FailureClosed:
+		return p.MaxClosed
+	case FailureMaxPositionExceeded:
+		return p.MaxMaxPositionExceeded
+	default:
+		return 0
+	}
+}
+
+// exhausted reports whether retries of class have used up their budget
+func (p RetryPolicy) exhausted(class FailureClass, retries int) bool {
+	budget := p.Budget(class)
+	return budget != Unlimited && retries > budget
+}
+
+// backoff returns the sleep before retry n (counted from zero after the
+// spin and yield phases)
+func (p RetryPolicy) backoff(n int) time.Duration {
+	d := float64(p.InitialBackoff)
+	for i := 0; i < n && d < float64(p.MaxBackoff); i++ {
+		d *= p.Multiplier
+	}
+	d = min(d, float64(p.MaxBackoff))
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(max(d, 0))
+}
+
+// retryPhase is how pause waits before a retry
+type retryPhase uint8
+
+const (
+	phaseSpin retryPhase = iota
+	phaseYield
+	phaseBackoff
+)
+
+// phase returns how pause waits before retry number retry (starting at
+// one), and for phaseBackoff which backoff step it sleeps for
+func (p RetryPolicy) phase(retry int) (retryPhase, int) {
+	switch {
+	case retry <= p.SpinAttempts:
+		return phaseSpin, 0
+	case retry <= p.SpinAttempts+p.YieldAttempts:
+		return phaseYield, 0
+	default:
+		return phaseBackoff, retry - p.SpinAttempts - p.YieldAttempts - 1
+	}
+}
+
+// pause waits before retry number retry (starting at one) of a publish
+func (p RetryPolicy) pause(ctx context.Context, retry int) error {
+	phase, n := p.phase(retry)
+	switch phase {
+	case phaseSpin:
+		return nil
+	case phaseYield:
+		runtime.Gosched()
+		return nil
+	}
+
+	timer := time.NewTimer(p.backoff(n))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,162 @@
+package aeron
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetryPhases(t *testing.T) {
+	p := RetryPolicy{SpinAttempts: 2, YieldAttempts: 3}
+	tests := []struct {
+		retry int
+		phase retryPhase
+		step  int
+	}{
+		{retry: 1, phase: phaseSpin},
+		{retry: 2, phase: phaseSpin},
+		{retry: 3, phase: phaseYield},
+		{retry: 5, phase: phaseYield},
+		{retry: 6, phase: phaseBackoff, step: 0},
+		{retry: 7, phase: phaseBackoff, step: 1},
+		{retry: 20, phase: phaseBackoff, step: 14},
+	}
+	for _, tt := range tests {
+		if phase, step := p.phase(tt.retry); phase != tt.phase || step != tt.step {
+			t.Errorf("phase(%d) = %d, %d, want %d, %d", tt.retry, phase, step, tt.phase, tt.step)
+		}
+	}
+
+	// Without spinning or yielding the first retry already sleeps
+	if phase, step := (RetryPolicy{}).phase(1); phase != phaseBackoff || step != 0 {
+		t.Errorf("phase(1) with no spin or yield = %d, %d, want backoff step 0", phase, step)
+	}
+}
+
+func TestRetryPauseSleepsOnlyAfterSpinAndYield(t *testing.T) {
+	p := RetryPolicy{SpinAttempts: 2, YieldAttempts: 1, InitialBackoff: time.Hour, MaxBackoff: time.Hour, Multiplier: 2}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Spinning and yielding return at once, whatever the context
+	for retry := 1; retry <= 3; retry++ {
+		if err := p.pause(ctx, retry); err != nil {
+			t.Errorf("pause(%d) = %v, want nil", retry, err)
+		}
+	}
+	// The first sleep is cut short by the context
+	if err := p.pause(ctx, 4); !errors.Is(err, context.Canceled) {
+		t.Errorf("pause(4) = %v, want context.Canceled", err)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond, Multiplier: 2}
+	for n, want := range []time.Duration{
+		time.Millisecond,
+		2 * time.Millisecond,
+		4 * time.Millisecond,
+		8 * time.Millisecond,
+		10 * time.Millisecond,
+		10 * time.Millisecond,
+	} {
+		if got := p.backoff(n); got != want {
+			t.Errorf("backoff(%d) = %s, want %s", n, got, want)
+		}
+	}
+	if got := p.backoff(1000); got != p.MaxBackoff {
+		t.Errorf("backoff(1000) = %s, want the cap %s", got, p.MaxBackoff)
+	}
+}
+
+func TestRetryBackoffJitter(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 10 * time.Millisecond, Multiplier: 2, Jitter: 0.2}
+	low, high := 8*time.Millisecond, 12*time.Millisecond
+
+	var below, above bool
+	for i := 0; i < 1000; i++ {
+		d := p.backoff(3)
+		if d < low || d > high {
+			t.Fatalf("backoff = %s, want within [%s, %s]", d, low, high)
+		}
+		below = below || d < p.MaxBackoff
+		above = above || d > p.MaxBackoff
+	}
+	if !below || !above {
+		t.Errorf("jitter only moved the backoff one way (below %v, above %v)", below, above)
+	}
+
+	// Full jitter never sleeps a negative time
+	p.Jitter = 1
+	for i := 0; i < 1000; i++ {
+		if d := p.backoff(0); d < 0 || d > 2*p.InitialBackoff {
+			t.Fatalf("backoff with full jitter = %s, want within [0, %s]", d, 2*p.InitialBackoff)
+		}
+	}
+}
+
+func TestRetryBudgets(t *testing.T) {
+	p := RetryPolicy{
+		MaxNotConnected:        3,
+		MaxBackPressured:       Unlimited,
+		MaxAdminAction:         1,
+		MaxClosed:              0,
+		MaxMaxPositionExceeded: 2,
+	}
+	tests := []struct {
+		class  FailureClass
+		budget int // Unlimited: never exhausted
+	}{
+		{FailureNotConnected, 3},
+		{FailureBackPressured, Unlimited},
+		{FailureAdminAction, 1},
+		{FailureClosed, 0},
+		{FailureMaxPositionExceeded, 2},
+		{FailureOther, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.class.String(), func(t *testing.T) {
+			if tt.budget == Unlimited {
+				if p.exhausted(tt.class, 1_000_000) {
+					t.Error("unlimited budget exhausted")
+				}
+				return
+			}
+			if p.exhausted(tt.class, tt.budget) {
+				t.Errorf("exhausted after %d retries, want within budget", tt.budget)
+			}
+			if !p.exhausted(tt.class, tt.budget+1) {
+				t.Errorf("not exhausted after %d retries, want cut off", tt.budget+1)
+			}
+		})
+	}
+}
+
+func TestRetryBudgetsAreCountedPerClass(t *testing.T) {
+	p := RetryPolicy{MaxNotConnected: 2, MaxBackPressured: 1, MaxAdminAction: Unlimited}
+
+	// Failures as the offer loop counts them: a publish stops at the first
+	// failure that takes its own class past its budget
+	failures := []FailureClass{
+		FailureNotConnected,
+		FailureBackPressured,
+		FailureAdminAction,
+		FailureNotConnected,
+		FailureAdminAction,
+		FailureBackPressured, // second back pressure: past a budget of 1
+		FailureNotConnected,
+	}
+	retries := make(map[FailureClass]int)
+	stopped := -1
+	for i, class := range failures {
+		retries[class]++
+		if p.exhausted(class, retries[class]) {
+			stopped = i
+			break
+		}
+	}
+	if stopped != 5 {
+		t.Errorf("stopped at failure %d, want 5 (the second back pressure)", stopped)
+	}
+}
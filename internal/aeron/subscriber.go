@@ -3,48 +3,97 @@ package aeron
 import (
 	"context"
 	"log/slog"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	aeronlib "github.com/lirm/aeron-go/aeron"
-	"github.com/lirm/aeron-go/aeron/atomic"
+	aeronatomic "github.com/lirm/aeron-go/aeron/atomic"
 	"github.com/lirm/aeron-go/aeron/idlestrategy"
 	"github.com/lirm/aeron-go/aeron/logbuffer"
+	"github.com/lirm/aeron-go/aeron/logbuffer/term"
 
+	"github.com/k-omotani/aeron-sample/internal/deadletter"
 	"github.com/k-omotani/aeron-sample/internal/message"
 )
 
-// MessageHandler processes received messages
-type MessageHandler func(msg *message.Message) error
+// MessageHandler processes a received message. The action decides what
+// happens to the message; an error is logged and counted either way.
+type MessageHandler func(msg *message.Message) (Action, error)
+
+// resumePoint is where handling of a batch frame picks up again after a
+// message inside it was aborted
+type resumePoint struct {
+	position int64
+	next     int // index of the first message not yet handled
+}
 
 // Subscriber wraps Aeron subscription for receiving messages
 type Subscriber struct {
 	subscription *aeronlib.Subscription
-	codec        *message.Codec
+	registry     *message.Registry
+	codec        message.Codec // nil accepts any registered codec
+	reassembler  *Reassembler
 	handler      MessageHandler
 	logger       *slog.Logger
 	idleStrategy idlestrategy.Idler
+	poll         PollConfig
+	lastMessage  atomic.Int64 // unix nanoseconds, zero before the first message
+	metrics      *subscriberMetrics
+	gaps         *gapDetector
+
+	maxMessageSize int32
+	applied        map[int32]int64 // live fragments at or below these positions are skipped
+	resume         map[int32]resumePoint
+	flushHooks     []SessionFlushHook
+	flushBarrier   func(fn func())
+	deadLetters    deadletter.Sink
+
+	imagesMu    sync.Mutex
+	images      map[int64]activeImage // active publishers by image correlation ID
+	gone        []int32               // sessions to flush on the poll goroutine
+	connects    int64
+	disconnects int64
 }
 
-// NewSubscriber creates a subscriber on the given channel/stream
+// NewSubscriber creates a subscriber on the configured channel/stream.
+// Frames are decoded with the codec named by their first byte; unless
+// config.Codec is CodecAuto, frames written by any other codec are rejected.
 func NewSubscriber(
 	aeron *aeronlib.Aeron,
-	channel string,
-	streamID int32,
+	config *Config,
+	registry *message.Registry,
 	handler MessageHandler,
 	logger *slog.Logger,
 ) (*Subscriber, error) {
-	subscription, err := aeron.AddSubscription(channel, streamID)
+	codec, err := config.ResolveCodec(registry)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Subscriber{
-		subscription: subscription,
-		codec:        message.NewCodec(),
+	s := &Subscriber{
+		registry:     registry,
+		codec:        codec,
 		handler:      handler,
 		logger:       logger.With("component", "subscriber"),
-		idleStrategy: idlestrategy.Sleeping{SleepFor: time.Millisecond},
-	}, nil
+		idleStrategy: config.Poll.NewIdler(),
+		poll:         config.Poll,
+
+		maxMessageSize: config.MaxMessageSize,
+		resume:         make(map[int32]resumePoint),
+		images:         make(map[int64]activeImage),
+		flushBarrier:   func(fn func()) { fn() },
+	}
+	s.reassembler = NewControlledReassembler(s.onMessage, config.MaxMessageSize, logger)
+	s.gaps = newGapDetector(s.logger)
+	s.flushHooks = []SessionFlushHook{s.gaps.gone}
+
+	subscription, err := aeron.AddSubscriptionWithHandlers(config.Channel, config.StreamID, s.onImageAvailable, s.onImageUnavailable)
+	if err != nil {
+		return nil, err
+	}
+	s.subscription = subscription
+	return s, nil
 }
 
 // Start begins the polling loop in a goroutine
@@ -52,42 +101,237 @@ func (s *Subscriber) Start(ctx context.Context) {
 	go s.pollLoop(ctx)
 }
 
-func (s *Subscriber) pollLoop(ctx context.Context) {
-	s.logger.Info("subscriber poll loop started")
+// SkipThrough makes the live stream skip every message at or below the
+// given position per session, because it was already applied from a
+// snapshot or a replay. It must be called before Start.
+func (s *Subscriber) SkipThrough(positions map[int32]int64) {
+	s.applied = positions
+	s.gaps.seed(positions)
+}
 
-	fragmentHandler := func(buffer *atomic.Buffer, offset, length int32, header *logbuffer.Header) {
-		msg, err := s.codec.Decode(buffer, offset, length)
-		if err != nil {
-			s.logger.Error("failed to decode message", "error", err)
-			return
-		}
+// SetDeadLetterSink makes the subscriber keep live frames it cannot decode,
+// and messages the handler fails without aborting, in sink. It must be
+// called before Start.
+func (s *Subscriber) SetDeadLetterSink(sink deadletter.Sink) {
+	s.deadLetters = sink
+}
 
-		s.logger.Debug("received message",
-			"type", msg.Type,
-			"requestID", msg.RequestID,
-			"timestamp", msg.Timestamp,
-		)
+// replayHandler returns a controlled fragment handler for a replay of
+// sessionID's recording. Replayed messages carry the original session and
+// positions.
+func (s *Subscriber) replayHandler(sessionID int32) term.ControlledFragmentHandler {
+	reassembler := NewControlledReassembler(func(buffer *aeronatomic.Buffer, offset, length int32, header *logbuffer.Header) term.ControlledPollAction {
+		return s.dispatch(buffer, offset, length, sessionID, header.Position(), false).controlled()
+	}, s.maxMessageSize, s.logger)
+	return func(buffer *aeronatomic.Buffer, offset, length int32, header *logbuffer.Header) term.ControlledPollAction {
+		s.gaps.fragment(sessionID, header)
+		return reassembler.OnControlledFragment(buffer, offset, length, header)
+	}
+}
 
-		if err := s.handler(msg); err != nil {
-			s.logger.Error("handler failed", "error", err)
-		}
+// HasImages reports whether any publisher is currently connected
+func (s *Subscriber) HasImages() bool {
+	return s.subscription.HasImages()
+}
+
+// ImageCount returns the number of connected publisher images
+func (s *Subscriber) ImageCount() int {
+	return s.subscription.ImageCount()
+}
+
+// LastMessageTime returns when the last message was received, or the zero
+// time if none has been
+func (s *Subscriber) LastMessageTime() time.Time {
+	nanos := s.lastMessage.Load()
+	if nanos == 0 {
+		return time.Time{}
 	}
+	return time.Unix(0, nanos)
+}
+
+// GapStats returns the stream gaps detected so far
+func (s *Subscriber) GapStats() GapStats {
+	return s.gaps.stats()
+}
+
+// ReassemblyStats returns the fragment reassembly counters
+func (s *Subscriber) ReassemblyStats() ReassemblyStats {
+	return s.reassembler.Stats()
+}
+
+func (s *Subscriber) pollLoop(ctx context.Context) {
+	s.logger.Info("subscriber poll loop started",
+		"fragmentLimit", s.poll.FragmentLimit,
+		"idleStrategy", s.poll.Idle,
+	)
 
 	for {
 		select {
 		case <-ctx.Done():
-			s.logger.Info("subscriber stopping")
+			s.logger.Info("subscriber stopping", "reassembly", s.reassembler.Stats())
 			return
 		default:
 		}
 
-		fragmentsRead := s.subscription.Poll(fragmentHandler, 10)
+		s.flushGoneSessions()
+		s.gaps.checkJoins(time.Now())
+		fragmentsRead := s.subscription.ControlledPoll(s.onFragment, s.poll.FragmentLimit)
+		s.metrics.polled(fragmentsRead)
 		if fragmentsRead == 0 {
 			s.idleStrategy.Idle(0)
 		}
 	}
 }
 
+// onFragment checks a live fragment for gaps before reassembly
+func (s *Subscriber) onFragment(buffer *aeronatomic.Buffer, offset, length int32, header *logbuffer.Header) term.ControlledPollAction {
+	s.gaps.fragment(header.SessionId(), header)
+	return s.reassembler.OnControlledFragment(buffer, offset, length, header)
+}
+
+// onMessage handles one whole live message, after reassembly
+func (s *Subscriber) onMessage(buffer *aeronatomic.Buffer, offset, length int32, header *logbuffer.Header) term.ControlledPollAction {
+	sessionID, position := header.SessionId(), header.Position()
+	if applied, ok := s.applied[sessionID]; ok && position <= applied {
+		return term.ControlledPollActionContinue
+	}
+	return s.dispatch(buffer, offset, length, sessionID, position, true).controlled()
+}
+
+// dispatch splits batch frames from an AsyncPublisher into their
+// individual frames and handles each. live is false for replayed messages.
+// When a message of a batch is aborted, the messages before it are not
+// handled again when the frame is redelivered.
+func (s *Subscriber) dispatch(buffer *aeronatomic.Buffer, offset, length, sessionID int32, position int64, live bool) Action {
+	if !message.IsBatch(buffer, offset, length) {
+		return s.onFrame(buffer, offset, length, sessionID, position, live)
+	}
+
+	skip := 0
+	if point, ok := s.resume[sessionID]; ok {
+		delete(s.resume, sessionID)
+		if point.position == position {
+			skip = point.next
+		}
+	}
+
+	action := ActionContinue
+	index := 0
+	err := message.ForEachBatchFrame(buffer, offset, length, func(offset, length int32) {
+		defer func() { index++ }()
+		if index < skip || action == ActionAbort {
+			return
+		}
+		frameAction := s.onFrame(buffer, offset, length, sessionID, position, live)
+		if frameAction == ActionAbort {
+			s.resume[sessionID] = resumePoint{position: position, next: index}
+		}
+		action = action.merge(frameAction)
+	})
+	if err != nil {
+		s.metrics.decodeFailed()
+		s.logger.Error("failed to split batch frame", "error", err)
+		if live {
+			s.deadLetter(buffer, offset, length, sessionID, position, deadletter.StageDecode, err)
+		}
+	}
+	return action
+}
+
+// onFrame decodes and handles a single frame, recording where it arrived
+// from. Frames that cannot be decoded are consumed.
+func (s *Subscriber) onFrame(buffer *aeronatomic.Buffer, offset, length, sessionID int32, position int64, live bool) Action {
+	msg, err := s.decode(buffer, offset, length)
+	if err != nil {
+		s.metrics.decodeFailed()
+		s.logger.Error("failed to decode message", "error", err)
+		if live {
+			s.deadLetter(buffer, offset, length, sessionID, position, deadletter.StageDecode, err)
+		}
+		return ActionContinue
+	}
+	msg.SessionID = sessionID
+	msg.Position = position
+	if live && s.deadLetters != nil {
+		// The handler may fail on a Dispatcher worker after the term
+		// buffer has moved on
+		msg.Frame = make([]byte, length)
+		buffer.GetBytes(offset, msg.Frame)
+	}
+	now := time.Now()
+	s.lastMessage.Store(now.UnixNano())
+
+	s.logger.Debug("received message",
+		"type", msg.Type,
+		"requestID", msg.RequestID,
+		"timestamp", msg.Timestamp,
+		"sessionID", msg.SessionID,
+		"position", msg.Position,
+	)
+
+	action, err := s.handler(msg)
+	if err != nil {
+		s.metrics.handlerFailed()
+		s.logger.Error("handler failed", "error", err, "action", action)
+	}
+	if action == ActionAbort {
+		s.metrics.aborted()
+		return action
+	}
+	if err != nil && live {
+		s.storeDeadLetter(msg.Frame, sessionID, position, deadletter.StageHandle, err)
+	}
+	// An aborted message is seen again, so it only counts once consumed
+	s.gaps.sequence(sessionID, msg.Sequence)
+	s.metrics.received(msg, now, live)
+	return action
+}
+
+// deadLetter stores a copy of a frame that failed at stage. Replayed frames
+// are not stored, as they were stored when they first arrived.
+func (s *Subscriber) deadLetter(buffer *aeronatomic.Buffer, offset, length, sessionID int32, position int64, stage string, cause error) {
+	if s.deadLetters == nil {
+		return
+	}
+	frame := make([]byte, length)
+	buffer.GetBytes(offset, frame)
+	s.storeDeadLetter(frame, sessionID, position, stage, cause)
+}
+
+// storeDeadLetter stores frame, which the caller no longer uses
+func (s *Subscriber) storeDeadLetter(frame []byte, sessionID int32, position int64, stage string, cause error) {
+	if s.deadLetters == nil || frame == nil {
+		return
+	}
+	err := s.deadLetters.Write(deadletter.Letter{
+		Time:      time.Now(),
+		SessionID: sessionID,
+		Position:  position,
+		Stage:     stage,
+		Error:     cause.Error(),
+		Frame:     frame,
+	})
+	if err != nil {
+		s.logger.Error("failed to store dead letter", "error", err, "stage", stage, "sessionID", sessionID, "position", position)
+		return
+	}
+	s.metrics.deadLettered(stage)
+}
+
+// DeadLetterMessage stores the frame msg arrived in, for a message a
+// handler failed away from the poll goroutine. Replayed messages carry no
+// frame and are not stored, as they were stored when they first arrived.
+func (s *Subscriber) DeadLetterMessage(msg *message.Message, cause error) {
+	s.storeDeadLetter(msg.Frame, msg.SessionID, msg.Position, deadletter.StageHandle, cause)
+}
+
+func (s *Subscriber) decode(buffer *aeronatomic.Buffer, offset, length int32) (*message.Message, error) {
+	if s.codec == nil {
+		return s.registry.Decode(buffer, offset, length)
+	}
+	return s.registry.DecodeWith(s.codec, buffer, offset, length)
+}
+
 // Close releases the subscription resources
 func (s *Subscriber) Close() error {
 	return s.subscription.Close()
@@ -0,0 +1,72 @@
+package aeron
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	aeronatomic "github.com/lirm/aeron-go/aeron/atomic"
+
+	"github.com/k-omotani/aeron-sample/internal/deadletter"
+	"github.com/k-omotani/aeron-sample/internal/message"
+)
+
+// letterSink keeps the dead letters written to it
+type letterSink struct {
+	letters []deadletter.Letter
+}
+
+func (s *letterSink) Write(letter deadletter.Letter) error {
+	s.letters = append(s.letters, letter)
+	return nil
+}
+
+func TestDeadLetterMessageStoresFrameAsReceived(t *testing.T) {
+	// A request ID the binary codec would refuse to encode
+	msg := &message.Message{
+		Type:      message.MessageTypeIncrement,
+		RequestID: "not-a-uuid",
+		Payload:   &message.IncrementPayload{Amount: 1, Name: "page-views"},
+	}
+	frame, err := message.Marshal(message.NewJSONCodec(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := append([]byte(nil), frame...)
+	buffer := aeronatomic.MakeBuffer(received)
+
+	var queued []*message.Message
+	sink := &letterSink{}
+	s := &Subscriber{
+		registry: message.DefaultRegistry(),
+		logger:   discardLogger(),
+		gaps:     newGapDetector(discardLogger()),
+		handler: func(msg *message.Message) (Action, error) {
+			queued = append(queued, msg) // handed to a worker, as a Dispatcher does
+			return ActionContinue, nil
+		},
+	}
+	s.SetDeadLetterSink(sink)
+
+	s.onFrame(buffer, 0, int32(len(received)), 7, 4096, true)
+	s.onFrame(buffer, 0, int32(len(received)), 7, 4096, false) // replayed
+	// The term buffer moves on before the worker fails
+	for i := range received {
+		received[i] = 0
+	}
+	failure := errors.New("handler failed")
+	for _, m := range queued {
+		s.DeadLetterMessage(m, failure)
+	}
+
+	if len(sink.letters) != 1 {
+		t.Fatalf("stored %d dead letters, want only the live one", len(sink.letters))
+	}
+	letter := sink.letters[0]
+	if !bytes.Equal(letter.Frame, frame) {
+		t.Errorf("stored frame %q, want the frame as received %q", letter.Frame, frame)
+	}
+	if letter.SessionID != 7 || letter.Position != 4096 || letter.Stage != deadletter.StageHandle || letter.Error != failure.Error() {
+		t.Errorf("letter = %+v", letter)
+	}
+}
@@ -0,0 +1,183 @@
+// Package cnc reads the Aeron media driver's command-and-control file
+// (cnc.dat) without attaching a client: the driver heartbeat, the counters
+// and the distinct error log. The file is mapped read-only, so reading it
+// never affects the driver.
+package cnc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// FileName is the name of the CnC file in the Aeron directory
+const FileName = "cnc.dat"
+
+// Version is the CnC layout version understood, 0.2.0
+const Version int32 = 0x200
+
+var (
+	ErrUnsupportedVersion = errors.New("unsupported cnc version")
+	ErrTruncated          = errors.New("cnc file truncated")
+)
+
+// Layout of the metadata header at the start of the file
+const (
+	versionOffset               = 0
+	toDriverLengthOffset        = 4
+	toClientsLengthOffset       = 8
+	counterMetadataLengthOffset = 12
+	counterValuesLengthOffset   = 16
+	errorLogLengthOffset        = 20
+	clientLivenessTimeoutOffset = 24
+	startTimestampOffset        = 32
+	pidOffset                   = 40
+	headerLength                = 128
+)
+
+// cacheLineLength aligns the ring buffer trailer fields
+const cacheLineLength = 64
+
+// toDriverHeartbeatOffset is the consumer heartbeat in the to-driver ring
+// buffer trailer, relative to the end of its data
+const (
+	toDriverTrailerLength   = cacheLineLength * 12
+	toDriverHeartbeatOffset = cacheLineLength * 10
+)
+
+// File is a decoded view of a cnc.dat mapping. Values are read from the
+// mapping on every call, so they follow the running driver.
+type File struct {
+	data  []byte
+	close func() error
+
+	toDriver        []byte
+	counterMetadata []byte
+	counterValues   []byte
+	errorLog        []byte
+}
+
+// Open maps the cnc.dat in aeronDir read-only
+func Open(aeronDir string) (*File, error) {
+	return OpenFile(filepath.Join(aeronDir, FileName))
+}
+
+// OpenFile maps the CnC file at path read-only
+func OpenFile(path string) (*File, error) {
+	data, unmap, err := mapFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map %s: %w", path, err)
+	}
+	f, err := Decode(data)
+	if err != nil {
+		unmap()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	f.close = unmap
+	return f, nil
+}
+
+// Decode wraps the contents of a CnC file. data must stay valid while the
+// File is in use; it is not copied.
+func Decode(data []byte) (*File, error) {
+	if len(data) < headerLength {
+		return nil, ErrTruncated
+	}
+	if version := getInt32(data, versionOffset); version != Version {
+		return nil, fmt.Errorf("%w: %d.%d.%d", ErrUnsupportedVersion, version>>16&0xff, version>>8&0xff, version&0xff)
+	}
+
+	f := &File{data: data}
+	offset := headerLength
+	sections := []struct {
+		lengthOffset int
+		section      *[]byte
+	}{
+		{toDriverLengthOffset, &f.toDriver},
+		{toClientsLengthOffset, nil},
+		{counterMetadataLengthOffset, &f.counterMetadata},
+		{counterValuesLengthOffset, &f.counterValues},
+		{errorLogLengthOffset, &f.errorLog},
+	}
+	for _, s := range sections {
+		length := int(getInt32(data, s.lengthOffset))
+		if length < 0 || offset+length > len(data) {
+			return nil, ErrTruncated
+		}
+		if s.section != nil {
+			*s.section = data[offset : offset+length]
+		}
+		offset += length
+	}
+	if len(f.toDriver) < toDriverTrailerLength {
+		return nil, ErrTruncated
+	}
+	return f, nil
+}
+
+// Close unmaps the file; it does nothing for a File made by Decode
+func (f *File) Close() error {
+	if f.close == nil {
+		return nil
+	}
+	return f.close()
+}
+
+// PID returns the process ID of the media driver
+func (f *File) PID() int64 {
+	return getInt64(f.data, pidOffset)
+}
+
+// StartTime returns when the media driver started
+func (f *File) StartTime() time.Time {
+	return time.UnixMilli(getInt64(f.data, startTimestampOffset))
+}
+
+// ClientLivenessTimeout returns how long the driver waits for a silent
+// client before it releases the client's resources
+func (f *File) ClientLivenessTimeout() time.Duration {
+	return time.Duration(getInt64(f.data, clientLivenessTimeoutOffset))
+}
+
+// Heartbeat returns when the driver last serviced its command buffer.
+// A driver that has stopped leaves the last heartbeat behind.
+func (f *File) Heartbeat() time.Time {
+	offset := len(f.toDriver) - toDriverTrailerLength + toDriverHeartbeatOffset
+	return time.UnixMilli(loadInt64(f.toDriver, offset))
+}
+
+// HeartbeatAge returns how long ago the driver last heartbeated
+func (f *File) HeartbeatAge() time.Duration {
+	return time.Since(f.Heartbeat())
+}
+
+func getInt32(b []byte, offset int) int32 {
+	return int32(binary.LittleEndian.Uint32(b[offset:]))
+}
+
+func getInt64(b []byte, offset int) int64 {
+	return int64(binary.LittleEndian.Uint64(b[offset:]))
+}
+
+// loadInt32 reads a field the driver updates concurrently. Aligned loads
+// are atomic on every platform Aeron supports.
+func loadInt32(b []byte, offset int) int32 {
+	if uintptr(unsafe.Pointer(&b[offset]))%4 != 0 {
+		return getInt32(b, offset)
+	}
+	_ = b[offset+3]
+	return atomic.LoadInt32((*int32)(unsafe.Pointer(&b[offset])))
+}
+
+// loadInt64 is loadInt32 for 64-bit fields
+func loadInt64(b []byte, offset int) int64 {
+	if uintptr(unsafe.Pointer(&b[offset]))%8 != 0 {
+		return getInt64(b, offset)
+	}
+	_ = b[offset+7]
+	return atomic.LoadInt64((*int64)(unsafe.Pointer(&b[offset])))
+}
@@ -0,0 +1,265 @@
+package cnc
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testCounter is one counter record in a synthetic CnC file
+type testCounter struct {
+	state  int32 // recordAlloc when zero
+	unused bool  // writes recordUnused, which is also zero
+	typeID int32
+	label  string
+	key    []byte
+	value  int64
+}
+
+// testCnC describes a synthetic CnC file
+type testCnC struct {
+	pid       int64
+	start     time.Time
+	heartbeat time.Time
+	counters  []testCounter
+	errors    []ErrorRecord
+}
+
+const (
+	testToDriverData  = 1024
+	testToClients     = 1024
+	testErrorLogBytes = 4096
+)
+
+// bytes lays the file out as the media driver does: the metadata header,
+// the to-driver ring buffer with its trailer, the to-clients buffer, the
+// counters metadata and values and the distinct error log
+func (c testCnC) bytes() []byte {
+	toDriver := testToDriverData + toDriverTrailerLength
+	records := len(c.counters) + 1 // an unused record ends the scan
+	metadata := records * metadataLength
+	values := records * counterLength
+
+	data := make([]byte, headerLength+toDriver+testToClients+metadata+values+testErrorLogBytes)
+	putInt32 := func(b []byte, offset int, v int32) { binary.LittleEndian.PutUint32(b[offset:], uint32(v)) }
+	putInt64 := func(b []byte, offset int, v int64) { binary.LittleEndian.PutUint64(b[offset:], uint64(v)) }
+
+	putInt32(data, versionOffset, Version)
+	putInt32(data, toDriverLengthOffset, int32(toDriver))
+	putInt32(data, toClientsLengthOffset, testToClients)
+	putInt32(data, counterMetadataLengthOffset, int32(metadata))
+	putInt32(data, counterValuesLengthOffset, int32(values))
+	putInt32(data, errorLogLengthOffset, testErrorLogBytes)
+	putInt64(data, clientLivenessTimeoutOffset, int64(10*time.Second))
+	putInt64(data, startTimestampOffset, c.start.UnixMilli())
+	putInt64(data, pidOffset, c.pid)
+
+	offset := headerLength
+	putInt64(data, offset+testToDriverData+toDriverHeartbeatOffset, c.heartbeat.UnixMilli())
+	offset += toDriver + testToClients
+
+	metadataSection := data[offset : offset+metadata]
+	valuesSection := data[offset+metadata : offset+metadata+values]
+	for id, counter := range c.counters {
+		record := metadataSection[id*metadataLength:]
+		state := counter.state
+		switch {
+		case counter.unused:
+			state = recordUnused
+		case state == 0:
+			state = recordAlloc
+		}
+		putInt32(record, 0, state)
+		putInt32(record, typeIDOffset, counter.typeID)
+		copy(record[keyOffset:labelOffset], counter.key)
+		putInt32(record, labelOffset, int32(len(counter.label)))
+		copy(record[labelOffset+4:], counter.label)
+		putInt64(valuesSection, id*counterLength, counter.value)
+	}
+	offset += metadata + values
+
+	log := data[offset:]
+	for _, e := range c.errors {
+		length := errorEncodedOffset + len(e.Message)
+		putInt32(log, errorLengthOffset, int32(length))
+		putInt32(log, errorCountOffset, e.Count)
+		putInt64(log, errorLastOffset, e.Last.UnixMilli())
+		putInt64(log, errorFirstOffset, e.First.UnixMilli())
+		copy(log[errorEncodedOffset:], e.Message)
+		log = log[align(length, errorRecordAlignment):]
+	}
+	return data
+}
+
+// writeCnC writes c as cnc.dat in a new directory and returns the directory
+func writeCnC(t *testing.T, c testCnC) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, FileName), c.bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// positionKey encodes the key of a stream position counter
+func positionKey(sessionID, streamID int32, channel string) []byte {
+	key := make([]byte, labelOffset-keyOffset)
+	binary.LittleEndian.PutUint64(key, 42) // registration ID
+	binary.LittleEndian.PutUint32(key[8:], uint32(sessionID))
+	binary.LittleEndian.PutUint32(key[12:], uint32(streamID))
+	binary.LittleEndian.PutUint32(key[16:], uint32(len(channel)))
+	copy(key[20:], channel)
+	return key
+}
+
+func testFile() testCnC {
+	now := time.Now().Truncate(time.Millisecond)
+	return testCnC{
+		pid:       4242,
+		start:     now.Add(-time.Hour),
+		heartbeat: now.Add(-3 * time.Second),
+		counters: []testCounter{
+			{typeID: TypeSystem, label: "Bytes sent", value: 1000},
+			{typeID: TypeSystem, label: "NAKs received", value: 7},
+			{typeID: TypeSystem, label: "Errors", value: 2},
+			{state: -1, typeID: TypeSystem, label: "Bytes received", value: 99}, // reclaimed
+			{typeID: TypePublisherPosition, label: "pub-pos: 42 -5 1001 aeron:udp", key: positionKey(-5, 1001, "aeron:udp?endpoint=subscriber:40123"), value: 4096},
+			{typeID: TypeSubscriberPosition, label: "sub-pos: 43 -5 1001 aeron:udp", key: positionKey(-5, 1001, "aeron:udp?endpoint=0.0.0.0:40123"), value: 2048},
+			{typeID: TypeSenderBPE, label: "snd-bpe", value: 3},
+			{typeID: TypeSenderBPE, label: "snd-bpe", value: 4},
+		},
+		errors: []ErrorRecord{
+			{Count: 3, First: now.Add(-time.Minute), Last: now.Add(-time.Second), Message: "java.io.IOException: connection refused"},
+			{Count: 1, First: now.Add(-2 * time.Minute), Last: now.Add(-2 * time.Minute), Message: "odd length"},
+		},
+	}
+}
+
+func TestOpen(t *testing.T) {
+	want := testFile()
+	f, err := Open(writeCnC(t, want))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer f.Close()
+
+	if f.PID() != want.pid {
+		t.Errorf("PID = %d, want %d", f.PID(), want.pid)
+	}
+	if !f.StartTime().Equal(want.start) {
+		t.Errorf("StartTime = %s, want %s", f.StartTime(), want.start)
+	}
+	if f.ClientLivenessTimeout() != 10*time.Second {
+		t.Errorf("ClientLivenessTimeout = %s, want 10s", f.ClientLivenessTimeout())
+	}
+	if !f.Heartbeat().Equal(want.heartbeat) {
+		t.Errorf("Heartbeat = %s, want %s", f.Heartbeat(), want.heartbeat)
+	}
+	if age := f.HeartbeatAge(); age < 3*time.Second || age > time.Minute {
+		t.Errorf("HeartbeatAge = %s, want about 3s", age)
+	}
+
+	counters := f.Counters()
+	if len(counters) != len(want.counters)-1 {
+		t.Fatalf("got %d counters, want %d without the reclaimed one", len(counters), len(want.counters)-1)
+	}
+	if got := counters[3]; got != (Counter{ID: 4, TypeID: TypePublisherPosition, Label: "pub-pos: 42 -5 1001 aeron:udp", Value: 4096}) {
+		t.Errorf("counter 4 = %+v", got)
+	}
+
+	wantPositions := []Position{
+		{Type: "pub-pos", SessionID: -5, StreamID: 1001, Channel: "aeron:udp?endpoint=subscriber:40123", Value: 4096},
+		{Type: "sub-pos", SessionID: -5, StreamID: 1001, Channel: "aeron:udp?endpoint=0.0.0.0:40123", Value: 2048},
+	}
+	if got := f.Positions(); !reflect.DeepEqual(got, wantPositions) {
+		t.Errorf("Positions = %+v, want %+v", got, wantPositions)
+	}
+
+	wantSummary := Summary{BytesSent: 1000, NaksReceived: 7, Errors: 2, BackPressureEvents: 7}
+	if got := f.Summary(); got != wantSummary {
+		t.Errorf("Summary = %+v, want %+v", got, wantSummary)
+	}
+
+	if got := f.Errors(); !reflect.DeepEqual(got, want.errors) {
+		t.Errorf("Errors = %+v, want %+v", got, want.errors)
+	}
+}
+
+func TestCountersStopAtUnusedRecord(t *testing.T) {
+	c := testFile()
+	c.counters[2].unused = true
+	f, err := Decode(c.bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(f.Counters()); got != 2 {
+		t.Errorf("got %d counters, want the 2 before the unused record", got)
+	}
+}
+
+func TestErrorsStopAtPartialRecord(t *testing.T) {
+	c := testFile()
+	data := c.bytes()
+	f, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A record being written claims more bytes than the log holds
+	second := align(errorEncodedOffset+len(c.errors[0].Message), errorRecordAlignment)
+	binary.LittleEndian.PutUint32(f.errorLog[second:], uint32(len(f.errorLog)))
+
+	if got := f.Errors(); len(got) != 1 || got[0].Message != c.errors[0].Message {
+		t.Errorf("Errors = %+v, want only the first record", got)
+	}
+}
+
+func TestDecodeRejects(t *testing.T) {
+	data := testFile().bytes()
+	toDriverEnd := headerLength + testToDriverData + toDriverTrailerLength
+	badVersion := append([]byte(nil), data...)
+	binary.LittleEndian.PutUint32(badVersion[versionOffset:], 0x10000)
+	shortToDriver := append([]byte(nil), data...)
+	binary.LittleEndian.PutUint32(shortToDriver[toDriverLengthOffset:], toDriverTrailerLength-1)
+	negative := append([]byte(nil), data...)
+	binary.LittleEndian.PutUint32(negative[counterValuesLengthOffset:], 0xffffffff)
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, ErrTruncated},
+		{"partial header", data[:headerLength-1], ErrTruncated},
+		{"header only", data[:headerLength], ErrTruncated},
+		{"inside to-driver buffer", data[:toDriverEnd-1], ErrTruncated},
+		{"inside counters", data[:toDriverEnd+testToClients+metadataLength], ErrTruncated},
+		{"inside error log", data[:len(data)-1], ErrTruncated},
+		{"to-driver buffer without trailer", shortToDriver, ErrTruncated},
+		{"negative section length", negative, ErrTruncated},
+		{"unsupported version", badVersion, ErrUnsupportedVersion},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decode(tt.data); !errors.Is(err, tt.want) {
+				t.Errorf("Decode = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenTruncatedFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, FileName), testFile().bytes()[:headerLength/2], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(dir); !errors.Is(err, ErrTruncated) {
+		t.Errorf("Open = %v, want ErrTruncated", err)
+	}
+	if _, err := Open(t.TempDir()); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Open without a cnc.dat = %v, want os.ErrNotExist", err)
+	}
+}
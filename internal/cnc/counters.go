@@ -0,0 +1,179 @@
+package cnc
+
+import (
+	"strings"
+)
+
+// Layout of the counters metadata and values buffers
+const (
+	counterLength        = 128 // one value record
+	metadataLength       = 512 // one metadata record
+	typeIDOffset         = 4
+	keyOffset            = 16
+	labelOffset          = 128
+	maxLabelLength       = 380
+	recordUnused   int32 = 0
+	recordAlloc    int32 = 1
+)
+
+// Counter type IDs allocated by the media driver
+const (
+	TypeSystem              int32 = 0
+	TypePublisherLimit      int32 = 1
+	TypeSenderPosition      int32 = 2
+	TypeReceiverHWM         int32 = 3
+	TypeSubscriberPosition  int32 = 4
+	TypeReceiverPosition    int32 = 5
+	TypeSendChannelStatus   int32 = 6
+	TypeReceiveChannelState int32 = 7
+	TypeSenderLimit         int32 = 9
+	TypeClientHeartbeat     int32 = 11
+	TypePublisherPosition   int32 = 12
+	TypeSenderBPE           int32 = 13
+)
+
+// positionTypes names the stream position counters, as in their labels
+var positionTypes = map[int32]string{
+	TypePublisherLimit:     "pub-lmt",
+	TypeSenderPosition:     "snd-pos",
+	TypeReceiverHWM:        "rcv-hwm",
+	TypeSubscriberPosition: "sub-pos",
+	TypeReceiverPosition:   "rcv-pos",
+	TypeSenderLimit:        "snd-lmt",
+	TypePublisherPosition:  "pub-pos",
+}
+
+// Counter is one allocated driver counter
+type Counter struct {
+	ID     int32  `json:"id"`
+	TypeID int32  `json:"type_id"`
+	Label  string `json:"label"`
+	Value  int64  `json:"value"`
+}
+
+// Position is a stream position counter of a publication or image
+type Position struct {
+	Type      string `json:"type"` // pub-pos, snd-pos, sub-pos, rcv-hwm, ...
+	SessionID int32  `json:"session_id"`
+	StreamID  int32  `json:"stream_id"`
+	Channel   string `json:"channel"`
+	Value     int64  `json:"value"`
+}
+
+// Summary holds the system counters most useful for monitoring, plus
+// back-pressure events summed over every publication
+type Summary struct {
+	BytesSent          int64 `json:"bytes_sent"`
+	BytesReceived      int64 `json:"bytes_received"`
+	NaksSent           int64 `json:"naks_sent"`
+	NaksReceived       int64 `json:"naks_received"`
+	RetransmitsSent    int64 `json:"retransmits_sent"`
+	HeartbeatsSent     int64 `json:"heartbeats_sent"`
+	HeartbeatsReceived int64 `json:"heartbeats_received"`
+	InvalidPackets     int64 `json:"invalid_packets"`
+	Errors             int64 `json:"errors"`
+	ShortSends         int64 `json:"short_sends"`
+	LossGapFills       int64 `json:"loss_gap_fills"`
+	ClientTimeouts     int64 `json:"client_timeouts"`
+	BackPressureEvents int64 `json:"back_pressure_events"`
+}
+
+// systemCounters maps the labels of system counters to Summary fields
+var systemCounters = map[string]func(*Summary) *int64{
+	"Bytes sent":               func(s *Summary) *int64 { return &s.BytesSent },
+	"Bytes received":           func(s *Summary) *int64 { return &s.BytesReceived },
+	"NAKs sent":                func(s *Summary) *int64 { return &s.NaksSent },
+	"NAKs received":            func(s *Summary) *int64 { return &s.NaksReceived },
+	"Retransmits sent":         func(s *Summary) *int64 { return &s.RetransmitsSent },
+	"Heartbeats sent":          func(s *Summary) *int64 { return &s.HeartbeatsSent },
+	"Heartbeats received":      func(s *Summary) *int64 { return &s.HeartbeatsReceived },
+	"Invalid packets":          func(s *Summary) *int64 { return &s.InvalidPackets },
+	"Errors":                   func(s *Summary) *int64 { return &s.Errors },
+	"Short sends":              func(s *Summary) *int64 { return &s.ShortSends },
+	"Loss gap fills":           func(s *Summary) *int64 { return &s.LossGapFills },
+	"Client liveness timeouts": func(s *Summary) *int64 { return &s.ClientTimeouts },
+}
+
+// Counters returns every allocated counter, in ID order
+func (f *File) Counters() []Counter {
+	var counters []Counter
+	f.forEachCounter(func(id int32, record []byte, value int64) {
+		counters = append(counters, Counter{
+			ID:     id,
+			TypeID: getInt32(record, typeIDOffset),
+			Label:  label(record),
+			Value:  value,
+		})
+	})
+	return counters
+}
+
+// Positions returns the stream position counters
+func (f *File) Positions() []Position {
+	var positions []Position
+	f.forEachCounter(func(id int32, record []byte, value int64) {
+		name, ok := positionTypes[getInt32(record, typeIDOffset)]
+		if !ok {
+			return
+		}
+		// Position keys are registration ID, session ID, stream ID and channel
+		key := record[keyOffset:labelOffset]
+		channelLength := int(getInt32(key, 16))
+		channel := ""
+		if channelLength > 0 && 20+channelLength <= len(key) {
+			channel = string(key[20 : 20+channelLength])
+		}
+		positions = append(positions, Position{
+			Type:      name,
+			SessionID: getInt32(key, 8),
+			StreamID:  getInt32(key, 12),
+			Channel:   channel,
+			Value:     value,
+		})
+	})
+	return positions
+}
+
+// Summary returns the main system counters
+func (f *File) Summary() Summary {
+	var summary Summary
+	f.forEachCounter(func(id int32, record []byte, value int64) {
+		switch getInt32(record, typeIDOffset) {
+		case TypeSystem:
+			if field, ok := systemCounters[label(record)]; ok {
+				*field(&summary) = value
+			}
+		case TypeSenderBPE:
+			summary.BackPressureEvents += value
+		}
+	})
+	return summary
+}
+
+// forEachCounter calls fn with the metadata record and value of each
+// allocated counter. Records are allocated in order, so the first unused
+// one ends the scan.
+func (f *File) forEachCounter(fn func(id int32, record []byte, value int64)) {
+	maxCounters := min(len(f.counterMetadata)/metadataLength, len(f.counterValues)/counterLength)
+	for id := range maxCounters {
+		record := f.counterMetadata[id*metadataLength : (id+1)*metadataLength]
+		state := loadInt32(record, 0)
+		if state == recordUnused {
+			return
+		}
+		if state != recordAlloc {
+			continue
+		}
+		fn(int32(id), record, loadInt64(f.counterValues, id*counterLength))
+	}
+}
+
+// label decodes the ASCII label of a metadata record
+func label(record []byte) string {
+	length := int(getInt32(record, labelOffset))
+	if length <= 0 {
+		return ""
+	}
+	length = min(length, maxLabelLength)
+	return strings.ToValidUTF8(string(record[labelOffset+4:labelOffset+4+length]), "?")
+}
@@ -0,0 +1,51 @@
+package cnc
+
+import (
+	"time"
+)
+
+// Layout of a distinct error log record
+const (
+	errorLengthOffset    = 0
+	errorCountOffset     = 4
+	errorLastOffset      = 8
+	errorFirstOffset     = 16
+	errorEncodedOffset   = 24
+	errorRecordAlignment = 8
+)
+
+// ErrorRecord is one distinct error observed by the media driver, with
+// how often and when it was seen
+type ErrorRecord struct {
+	Count   int32     `json:"count"`
+	First   time.Time `json:"first"`
+	Last    time.Time `json:"last"`
+	Message string    `json:"message"` // usually a full stack trace
+}
+
+// Errors returns the distinct errors the driver has logged since it started
+func (f *File) Errors() []ErrorRecord {
+	var records []ErrorRecord
+	log := f.errorLog
+	for offset := 0; offset+errorEncodedOffset <= len(log); {
+		length := int(loadInt32(log, offset+errorLengthOffset))
+		if length == 0 {
+			break
+		}
+		if length < errorEncodedOffset || offset+length > len(log) {
+			break // partially written or corrupt
+		}
+		records = append(records, ErrorRecord{
+			Count:   loadInt32(log, offset+errorCountOffset),
+			First:   time.UnixMilli(getInt64(log, offset+errorFirstOffset)),
+			Last:    time.UnixMilli(loadInt64(log, offset+errorLastOffset)),
+			Message: string(log[offset+errorEncodedOffset : offset+length]),
+		})
+		offset += align(length, errorRecordAlignment)
+	}
+	return records
+}
+
+func align(n, alignment int) int {
+	return (n + alignment - 1) &^ (alignment - 1)
+}
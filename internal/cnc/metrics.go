@@ -0,0 +1,51 @@
+package cnc
+
+import (
+	"strconv"
+
+	"github.com/k-omotani/aeron-sample/internal/metrics"
+)
+
+// RegisterMetrics exposes the driver's system counters, stream positions
+// and error log in r
+func (f *File) RegisterMetrics(r *metrics.Registry) {
+	summaryCounters := []struct {
+		name, help string
+		value      func(Summary) int64
+	}{
+		{"aeron_driver_bytes_sent_total", "Bytes sent by the media driver.", func(s Summary) int64 { return s.BytesSent }},
+		{"aeron_driver_bytes_received_total", "Bytes received by the media driver.", func(s Summary) int64 { return s.BytesReceived }},
+		{"aeron_driver_naks_sent_total", "NAKs sent by the media driver.", func(s Summary) int64 { return s.NaksSent }},
+		{"aeron_driver_naks_received_total", "NAKs received by the media driver.", func(s Summary) int64 { return s.NaksReceived }},
+		{"aeron_driver_retransmits_sent_total", "Retransmits sent by the media driver.", func(s Summary) int64 { return s.RetransmitsSent }},
+		{"aeron_driver_invalid_packets_total", "Invalid packets received by the media driver.", func(s Summary) int64 { return s.InvalidPackets }},
+		{"aeron_driver_errors_total", "Errors observed by the media driver.", func(s Summary) int64 { return s.Errors }},
+		{"aeron_driver_short_sends_total", "Sends that wrote fewer bytes than requested.", func(s Summary) int64 { return s.ShortSends }},
+		{"aeron_driver_loss_gap_fills_total", "Gaps filled after loss was not recovered.", func(s Summary) int64 { return s.LossGapFills }},
+		{"aeron_driver_client_timeouts_total", "Clients timed out by the media driver.", func(s Summary) int64 { return s.ClientTimeouts }},
+		{"aeron_driver_back_pressure_events_total", "Sender back-pressure events, summed over publications.", func(s Summary) int64 { return s.BackPressureEvents }},
+	}
+	for _, c := range summaryCounters {
+		r.CounterFunc(c.name, c.help, nil, func() []metrics.Sample {
+			return []metrics.Sample{{Value: float64(c.value(f.Summary()))}}
+		})
+	}
+
+	r.GaugeFunc("aeron_driver_position", "Stream position counters of the media driver.", []string{"type", "session_id", "stream_id", "channel"}, func() []metrics.Sample {
+		positions := f.Positions()
+		samples := make([]metrics.Sample, len(positions))
+		for i, p := range positions {
+			samples[i] = metrics.Sample{
+				Labels: []string{p.Type, strconv.Itoa(int(p.SessionID)), strconv.Itoa(int(p.StreamID)), p.Channel},
+				Value:  float64(p.Value),
+			}
+		}
+		return samples
+	})
+	r.GaugeFunc("aeron_driver_distinct_errors", "Distinct errors in the media driver error log.", nil, func() []metrics.Sample {
+		return []metrics.Sample{{Value: float64(len(f.Errors()))}}
+	})
+	r.GaugeFunc("aeron_driver_heartbeat_age_seconds", "Time since the media driver last updated its heartbeat.", nil, func() []metrics.Sample {
+		return []metrics.Sample{{Value: f.HeartbeatAge().Seconds()}}
+	})
+}
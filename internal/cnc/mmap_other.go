@@ -0,0 +1,15 @@
+//go:build !unix
+
+package cnc
+
+import "os"
+
+// mapFile reads path once where mmap is unavailable; values do not follow
+// the driver after that
+func mapFile(path string) ([]byte, func() error, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return nil }, nil
+}
@@ -0,0 +1,30 @@
+//go:build unix
+
+package cnc
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile maps path read-only and shared, so the driver's updates are visible
+func mapFile(path string) ([]byte, func() error, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.Size() < headerLength {
+		return nil, nil, ErrTruncated
+	}
+	data, err := syscall.Mmap(int(file.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
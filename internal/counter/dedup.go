@@ -0,0 +1,183 @@
+package counter
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// DedupConfig configures a Deduplicator
+type DedupConfig struct {
+	// Window is how long a request ID is remembered
+	Window time.Duration
+	// Buckets is the number of time buckets the window is split into;
+	// IDs expire one bucket at a time
+	Buckets int
+	// MaxEntries bounds memory: when exceeded, the oldest buckets are
+	// dropped before they expire (the newest bucket is always kept)
+	MaxEntries int
+}
+
+// DefaultDedupConfig remembers request IDs for ten minutes
+func DefaultDedupConfig() DedupConfig {
+	return DedupConfig{
+		Window:     10 * time.Minute,
+		Buckets:    10,
+		MaxEntries: 100_000,
+	}
+}
+
+// DedupStats reports deduplication counters
+type DedupStats struct {
+	Entries    int   `json:"entries"`
+	Duplicates int64 `json:"duplicates"`
+	Evicted    int64 `json:"evicted"`
+}
+
+// DedupEntry is one remembered request ID, as exported for snapshots
+type DedupEntry struct {
+	RequestID string    `json:"request_id"`
+	SeenAt    time.Time `json:"seen_at"`
+}
+
+type dedupBucket struct {
+	start time.Time
+	ids   map[string]struct{}
+}
+
+// Deduplicator remembers recently applied request IDs in a time-bucketed
+// set so replayed or retried messages are applied once
+type Deduplicator struct {
+	config DedupConfig
+	width  time.Duration
+	now    func() time.Time
+
+	mu         sync.Mutex
+	buckets    []*dedupBucket // oldest first
+	entries    int
+	duplicates int64
+	evicted    int64 // dropped early because of MaxEntries
+}
+
+// NewDeduplicator creates an empty deduplicator
+func NewDeduplicator(config DedupConfig) *Deduplicator {
+	if config.Buckets < 1 {
+		config.Buckets = 1
+	}
+	return &Deduplicator{
+		config: config,
+		width:  max(config.Window/time.Duration(config.Buckets), time.Millisecond),
+		now:    time.Now,
+	}
+}
+
+// Seen reports whether requestID was added within the window, counting
+// it as a duplicate if so
+func (d *Deduplicator) Seen(requestID string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.expire(d.now())
+	for _, b := range d.buckets {
+		if _, ok := b.ids[requestID]; ok {
+			d.duplicates++
+			return true
+		}
+	}
+	return false
+}
+
+// Add remembers requestID as applied
+func (d *Deduplicator) Add(requestID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.add(requestID, d.now())
+}
+
+// Stats returns the deduplication counters
+func (d *Deduplicator) Stats() DedupStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return DedupStats{
+		Entries:    d.entries,
+		Duplicates: d.duplicates,
+		Evicted:    d.evicted,
+	}
+}
+
+// Export returns the remembered request IDs, oldest first. SeenAt is the
+// start of the bucket holding the ID.
+func (d *Deduplicator) Export() []DedupEntry {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.expire(d.now())
+	entries := make([]DedupEntry, 0, d.entries)
+	for _, b := range d.buckets {
+		for id := range b.ids {
+			entries = append(entries, DedupEntry{RequestID: id, SeenAt: b.start})
+		}
+	}
+	return entries
+}
+
+// Restore replaces the remembered IDs with entries, skipping those that
+// have already left the window
+func (d *Deduplicator) Restore(entries []DedupEntry) {
+	sorted := make([]DedupEntry, len(entries))
+	copy(sorted, entries)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].SeenAt.Before(sorted[j].SeenAt) })
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.buckets = nil
+	d.entries = 0
+	cutoff := d.now().Add(-d.config.Window)
+	for _, e := range sorted {
+		if e.SeenAt.After(cutoff) {
+			d.add(e.RequestID, e.SeenAt)
+		}
+	}
+}
+
+// add and expire must be called with mu held. add expects at to be no
+// earlier than the newest bucket.
+func (d *Deduplicator) add(requestID string, at time.Time) {
+	d.expire(at)
+
+	if n := len(d.buckets); n == 0 || at.Sub(d.buckets[n-1].start) >= d.width {
+		d.buckets = append(d.buckets, &dedupBucket{
+			start: at.Truncate(d.width),
+			ids:   make(map[string]struct{}),
+		})
+	}
+
+	newest := d.buckets[len(d.buckets)-1]
+	if _, ok := newest.ids[requestID]; ok {
+		return
+	}
+	newest.ids[requestID] = struct{}{}
+	d.entries++
+
+	for d.config.MaxEntries > 0 && d.entries > d.config.MaxEntries && len(d.buckets) > 1 {
+		d.evicted += int64(len(d.buckets[0].ids))
+		d.drop()
+	}
+}
+
+// expire drops buckets that lie entirely outside the window ending at now
+func (d *Deduplicator) expire(now time.Time) {
+	cutoff := now.Add(-d.config.Window)
+	for len(d.buckets) > 0 && !d.buckets[0].start.Add(d.width).After(cutoff) {
+		d.drop()
+	}
+}
+
+func (d *Deduplicator) drop() {
+	d.entries -= len(d.buckets[0].ids)
+	d.buckets[0] = nil
+	d.buckets = d.buckets[1:]
+}
@@ -0,0 +1,149 @@
+package counter
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// dedupStart is minute-aligned, so with one-minute buckets IDs added at
+// dedupStart+k minutes each start a bucket
+var dedupStart = time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)
+
+// testDedupClock is the time returned to a test deduplicator
+type testDedupClock struct {
+	now time.Time
+}
+
+func (c *testDedupClock) set(offset time.Duration) {
+	c.now = dedupStart.Add(offset)
+}
+
+// newTestDeduplicator returns a deduplicator with ten one-minute buckets
+// and the clock it reads
+func newTestDeduplicator(maxEntries int) (*Deduplicator, *testDedupClock) {
+	clock := &testDedupClock{now: dedupStart}
+	d := NewDeduplicator(DedupConfig{Window: 10 * time.Minute, Buckets: 10, MaxEntries: maxEntries})
+	d.now = func() time.Time { return clock.now }
+	return d, clock
+}
+
+func addAt(d *Deduplicator, clock *testDedupClock, offset time.Duration, ids ...string) {
+	clock.set(offset)
+	for _, id := range ids {
+		d.Add(id)
+	}
+}
+
+func TestDeduplicatorExpiresBuckets(t *testing.T) {
+	d, clock := newTestDeduplicator(0)
+	addAt(d, clock, 0, "a")
+	addAt(d, clock, 30*time.Second, "b") // same bucket as a
+	addAt(d, clock, 5*time.Minute, "c")
+
+	tests := []struct {
+		at      time.Duration
+		seen    map[string]bool
+		entries int
+	}{
+		{at: 5 * time.Minute, seen: map[string]bool{"a": true, "b": true, "c": true}, entries: 3},
+		// The first bucket ends at 1m, so it is kept until 11m
+		{at: 10*time.Minute + 59*time.Second, seen: map[string]bool{"a": true, "b": true, "c": true}, entries: 3},
+		{at: 11 * time.Minute, seen: map[string]bool{"a": false, "b": false, "c": true}, entries: 1},
+		{at: 16 * time.Minute, seen: map[string]bool{"c": false}, entries: 0},
+	}
+	var duplicates int64
+	for _, tt := range tests {
+		clock.set(tt.at)
+		for id, want := range tt.seen {
+			if got := d.Seen(id); got != want {
+				t.Errorf("at %s: Seen(%q) = %v, want %v", tt.at, id, got, want)
+			}
+			if want {
+				duplicates++
+			}
+		}
+		if stats := d.Stats(); stats.Entries != tt.entries || stats.Duplicates != duplicates {
+			t.Errorf("at %s: stats = %+v, want %d entries and %d duplicates", tt.at, stats, tt.entries, duplicates)
+		}
+	}
+}
+
+func TestDeduplicatorEvictsPastMaxEntries(t *testing.T) {
+	d, clock := newTestDeduplicator(3)
+	addAt(d, clock, 0, "a", "b")
+	addAt(d, clock, time.Minute, "c")
+	addAt(d, clock, 2*time.Minute, "d") // a fourth entry drops the oldest bucket
+
+	for id, want := range map[string]bool{"a": false, "b": false, "c": true, "d": true} {
+		if got := d.Seen(id); got != want {
+			t.Errorf("Seen(%q) = %v, want %v", id, got, want)
+		}
+	}
+	if stats := d.Stats(); stats.Entries != 2 || stats.Evicted != 2 {
+		t.Errorf("stats = %+v, want 2 entries and 2 evicted", stats)
+	}
+
+	// The newest bucket is kept however full it gets
+	addAt(d, clock, 3*time.Minute, "e", "f", "g", "h")
+	if stats := d.Stats(); stats.Entries != 4 || stats.Evicted != 4 {
+		t.Errorf("stats = %+v, want the 4 entries of the newest bucket and 4 evicted", stats)
+	}
+	if !d.Seen("e") || d.Seen("d") {
+		t.Error("want the newest bucket kept and the older ones evicted")
+	}
+
+	// Adding an ID again does not count it twice
+	d.Add("h")
+	if stats := d.Stats(); stats.Entries != 4 {
+		t.Errorf("entries = %d after adding an ID again, want 4", stats.Entries)
+	}
+}
+
+func TestDeduplicatorExportRestore(t *testing.T) {
+	d, clock := newTestDeduplicator(0)
+	addAt(d, clock, 0, "a")
+	addAt(d, clock, 30*time.Second, "b")
+	addAt(d, clock, 3*time.Minute, "c")
+
+	entries := d.Export()
+	// IDs within a bucket come out in map order
+	sort.SliceStable(entries, func(i, j int) bool {
+		if !entries[i].SeenAt.Equal(entries[j].SeenAt) {
+			return entries[i].SeenAt.Before(entries[j].SeenAt)
+		}
+		return entries[i].RequestID < entries[j].RequestID
+	})
+	want := []DedupEntry{
+		{RequestID: "a", SeenAt: dedupStart},
+		{RequestID: "b", SeenAt: dedupStart}, // the start of its bucket
+		{RequestID: "c", SeenAt: dedupStart.Add(3 * time.Minute)},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Fatalf("Export = %+v, want %+v", entries, want)
+	}
+
+	// Restoring in any order rebuilds the same buckets
+	restored, restoredClock := newTestDeduplicator(0)
+	restoredClock.set(3 * time.Minute)
+	restored.Add("stale") // replaced by the restore
+	restored.Restore([]DedupEntry{entries[2], entries[0], entries[1]})
+	for id, want := range map[string]bool{"a": true, "b": true, "c": true, "stale": false} {
+		if got := restored.Seen(id); got != want {
+			t.Errorf("Seen(%q) after Restore = %v, want %v", id, got, want)
+		}
+	}
+	restoredClock.set(11 * time.Minute)
+	if restored.Seen("a") || !restored.Seen("c") {
+		t.Error("restored buckets did not expire like the originals")
+	}
+
+	// Entries that left the window while the process was down are skipped
+	late, lateClock := newTestDeduplicator(0)
+	lateClock.set(10*time.Minute + 30*time.Second)
+	late.Restore(entries)
+	if stats := late.Stats(); stats.Entries != 1 || !late.Seen("c") {
+		t.Errorf("stats = %+v after a late Restore, want only c", stats)
+	}
+}
@@ -0,0 +1,98 @@
+package counter
+
+import (
+	"github.com/k-omotani/aeron-sample/internal/message"
+	"github.com/k-omotani/aeron-sample/internal/metrics"
+)
+
+// RegisterMetrics exposes counter values, message results and
+// deduplication counters in r
+func (p *Processor) RegisterMetrics(r *metrics.Registry) {
+	r.GaugeFunc("counter_value", "Current value of each counter.", []string{"name"}, func() []metrics.Sample {
+		snapshots := p.state.Snapshots()
+		samples := make([]metrics.Sample, len(snapshots))
+		for i, s := range snapshots {
+			samples[i] = metrics.Sample{Labels: []string{s.Name}, Value: float64(s.Value)}
+		}
+		return samples
+	})
+	r.CounterFunc("counter_events_total", "Events applied to each counter.", []string{"name"}, func() []metrics.Sample {
+		snapshots := p.state.Snapshots()
+		samples := make([]metrics.Sample, len(snapshots))
+		for i, s := range snapshots {
+			samples[i] = metrics.Sample{Labels: []string{s.Name}, Value: float64(s.TotalEvents)}
+		}
+		return samples
+	})
+	r.CounterFunc("counter_duplicates_total", "Messages skipped as duplicates.", nil, func() []metrics.Sample {
+		return []metrics.Sample{{Value: float64(p.DedupStats().Duplicates)}}
+	})
+	r.GaugeFunc("counter_dedup_entries", "Request IDs remembered for deduplication.", nil, func() []metrics.Sample {
+		return []metrics.Sample{{Value: float64(p.DedupStats().Entries)}}
+	})
+
+	results := r.CounterVec("counter_results_total", "Handled messages by type and result.", "type", "status")
+	p.AddResultListener(func(msg *message.Message, result Result) {
+		results.With(result.Type.String(), result.Status.String()).Inc()
+	})
+}
+
+// RegisterMetrics exposes the per-source and per-session statistics in r
+func (s *Stats) RegisterMetrics(r *metrics.Registry) {
+	register := func(prefix, label string, entries func(StatsSnapshot) []SourceStats) {
+		r.CounterFunc(prefix+"_events_total", "Messages handled, excluding duplicates.", []string{label}, func() []metrics.Sample {
+			var samples []metrics.Sample
+			for _, e := range entries(s.Snapshot()) {
+				samples = append(samples, metrics.Sample{Labels: []string{e.Key}, Value: float64(e.Events)})
+			}
+			return samples
+		})
+		r.GaugeFunc(prefix+"_amount", "Sum of increment amounts.", []string{label}, func() []metrics.Sample {
+			var samples []metrics.Sample
+			for _, e := range entries(s.Snapshot()) {
+				samples = append(samples, metrics.Sample{Labels: []string{e.Key}, Value: float64(e.Total)})
+			}
+			return samples
+		})
+		r.GaugeFunc(prefix+"_event_rate", "Events per second, averaged over the window.", []string{label, "window"}, func() []metrics.Sample {
+			var samples []metrics.Sample
+			for _, e := range entries(s.Snapshot()) {
+				samples = append(samples,
+					metrics.Sample{Labels: []string{e.Key, "1m"}, Value: e.Rate1m},
+					metrics.Sample{Labels: []string{e.Key, "5m"}, Value: e.Rate5m},
+					metrics.Sample{Labels: []string{e.Key, "15m"}, Value: e.Rate15m},
+				)
+			}
+			return samples
+		})
+	}
+	register("counter_source", "source", func(snapshot StatsSnapshot) []SourceStats { return snapshot.Sources })
+	register("counter_session", "session", func(snapshot StatsSnapshot) []SourceStats { return snapshot.Sessions })
+}
+
+// RegisterMetrics exposes the watermark and dropped window events in r
+func (a *WindowAggregator) RegisterMetrics(r *metrics.Registry) {
+	r.GaugeFunc("counter_window_watermark_seconds", "Event time before which all windows are closed, as a Unix timestamp.", nil, func() []metrics.Sample {
+		watermark := a.Watermark()
+		if watermark.IsZero() {
+			return nil
+		}
+		return []metrics.Sample{{Value: float64(watermark.UnixNano()) / 1e9}}
+	})
+	r.CounterFunc("counter_window_late_events_total", "Events dropped because their window had closed.", []string{"size"}, func() []metrics.Sample {
+		var samples []metrics.Sample
+		for _, size := range a.Sizes() {
+			series, err := a.Series(size, 1)
+			if err != nil {
+				continue
+			}
+			samples = append(samples, metrics.Sample{Labels: []string{size.String()}, Value: float64(series.Late)})
+		}
+		return samples
+	})
+	r.CounterFunc("counter_window_skewed_events_total", "Events dropped for being too far in the future.", nil, func() []metrics.Sample {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		return []metrics.Sample{{Value: float64(a.skewed)}}
+	})
+}
@@ -1,64 +1,428 @@
 package counter
 
 import (
+	"errors"
+	"fmt"
 	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/k-omotani/aeron-sample/internal/message"
 )
 
-// Processor handles incoming messages and updates counter state
+// ErrUnknownMessageType is returned for message types the processor does
+// not handle, such as ones added by a newer publisher
+var ErrUnknownMessageType = errors.New("unknown message type")
+
+// Processor handles incoming messages and updates counter state.
+// Messages are applied under a read lock, so messages for different
+// counters can be applied in parallel, while Checkpoint takes the write
+// lock to see the state, positions, and dedup window of the same message
+// boundary.
 type Processor struct {
 	state  *State
+	dedup  *Deduplicator
 	logger *slog.Logger
+
+	mu        sync.RWMutex
+	updates   atomic.Uint64 // messages handled, to detect changes between checkpoints
+	listeners []ResultListener
+
+	positionsMu sync.Mutex
+	positions   map[int32]int64 // last handled stream position per publisher session
 }
 
-// NewProcessor creates a new message processor
-func NewProcessor(state *State, logger *slog.Logger) *Processor {
+// Checkpoint is the processor state persisted in snapshots
+type Checkpoint struct {
+	Counters  []CounterCheckpoint `json:"counters"`
+	Positions map[int32]int64     `json:"positions"`
+	Dedup     []DedupEntry        `json:"dedup,omitempty"`
+	CreatedAt time.Time           `json:"created_at"`
+
+	// Snapshots written before named counters held the single counter
+	// here; they are restored into DefaultName
+	Value         int64      `json:"value,omitempty"`
+	TotalEvents   int64      `json:"total_events,omitempty"`
+	LastUpdatedAt *time.Time `json:"last_updated_at,omitempty"`
+	LastRequestID string     `json:"last_request_id,omitempty"`
+}
+
+// CounterCheckpoint is one named counter in a Checkpoint
+type CounterCheckpoint struct {
+	Name          string    `json:"name"`
+	Value         int64     `json:"value"`
+	TotalEvents   int64     `json:"total_events"`
+	LastUpdatedAt time.Time `json:"last_updated_at"`
+	LastRequestID string    `json:"last_request_id"`
+}
+
+// NewProcessor creates a new message processor.
+// dedup may be nil, in which case every message is applied.
+func NewProcessor(state *State, dedup *Deduplicator, logger *slog.Logger) *Processor {
 	return &Processor{
-		state:  state,
-		logger: logger.With("component", "processor"),
+		state:     state,
+		dedup:     dedup,
+		logger:    logger.With("component", "processor"),
+		positions: make(map[int32]int64),
 	}
 }
 
-// Handle processes a message and returns an error if processing fails
+// Handle processes a message and returns an error if processing fails.
+// Messages whose RequestID was already applied within the dedup window
+// are skipped. Handle may be called concurrently for messages with
+// different PartitionKeys.
 func (p *Processor) Handle(msg *message.Message) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	p.updates.Add(1)
+	p.positionsMu.Lock()
+	if msg.Position > p.positions[msg.SessionID] {
+		p.positions[msg.SessionID] = msg.Position
+	}
+	p.positionsMu.Unlock()
+
+	dedup := p.dedup != nil && msg.RequestID != ""
+	if dedup && p.dedup.Seen(msg.RequestID) {
+		p.logger.Info("duplicate message skipped",
+			"type", msg.Type,
+			"requestID", msg.RequestID,
+			"duplicates", p.dedup.Stats().Duplicates,
+		)
+		p.notify(msg, p.duplicate(msg))
+		return nil
+	}
+
+	result, err := p.apply(msg)
+	if err != nil {
+		result = Result{Status: ResultFailed, Err: err}
+	} else if dedup {
+		p.dedup.Add(msg.RequestID)
+	}
+	p.notify(msg, result)
+	return err
+}
+
+// duplicate reports a skipped message with the current value of the
+// counter it would have changed, so a retried request still learns it
+func (p *Processor) duplicate(msg *message.Message) Result {
+	result := Result{Status: ResultDuplicate}
+	if name := PartitionKey(msg); name != "" {
+		snapshot, _ := p.state.Get(name)
+		result.Counter = snapshot.Name
+		result.Value = snapshot.Value
+	}
+	return result
+}
+
+// PartitionKey keys messages by the counter they change, so messages for
+// one counter are applied in order. Resets change every counter, and
+// unknown or malformed messages change none, so they return "" to be
+// ordered against all other messages. Keying by source instead would let
+// a set and an increment of the same counter race.
+func PartitionKey(msg *message.Message) string {
+	var name string
+	switch payload := msg.Payload.(type) {
+	case *message.IncrementPayload:
+		name = payload.Name
+	case *message.SetPayload:
+		name = payload.Name
+	case *message.CompareAndSetPayload:
+		name = payload.Name
+	case *message.BoundedIncrementPayload:
+		name = payload.Name
+	default:
+		return ""
+	}
+	if name == "" {
+		return DefaultName
+	}
+	return name
+}
+
+// AddResultListener registers l to receive the result of every message
+// handled from now on
+func (p *Processor) AddResultListener(l ResultListener) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.listeners = append(p.listeners, l)
+}
+
+// notify must be called with mu held for reading
+func (p *Processor) notify(msg *message.Message, result Result) {
+	result.RequestID = msg.RequestID
+	result.Type = msg.Type
+	for _, l := range p.listeners {
+		l(msg, result)
+	}
+}
+
+// DedupStats returns the deduplication counters
+func (p *Processor) DedupStats() DedupStats {
+	if p.dedup == nil {
+		return DedupStats{}
+	}
+	return p.dedup.Stats()
+}
+
+// Checkpoint captures the state for a snapshot, along with the number of
+// messages handled so far
+func (p *Processor) Checkpoint() (Checkpoint, uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	snapshots := p.state.Snapshots()
+	cp := Checkpoint{
+		Counters:  make([]CounterCheckpoint, len(snapshots)),
+		Positions: p.copyPositions(),
+		CreatedAt: time.Now(),
+	}
+	for i, s := range snapshots {
+		cp.Counters[i] = CounterCheckpoint{
+			Name:          s.Name,
+			Value:         s.Value,
+			TotalEvents:   s.TotalEvents,
+			LastUpdatedAt: s.LastUpdatedAt,
+			LastRequestID: s.LastRequestID,
+		}
+	}
+	if p.dedup != nil {
+		cp.Dedup = p.dedup.Export()
+	}
+	return cp, p.updates.Load()
+}
+
+// Restore replaces the state with a checkpoint loaded from a snapshot
+func (p *Processor) Restore(cp Checkpoint) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.state.Restore(cp.snapshots())
+	p.positionsMu.Lock()
+	p.positions = make(map[int32]int64, len(cp.Positions))
+	for session, position := range cp.Positions {
+		p.positions[session] = position
+	}
+	p.positionsMu.Unlock()
+	if p.dedup != nil {
+		p.dedup.Restore(cp.Dedup)
+	}
+}
+
+// snapshots returns the counters held in the checkpoint
+func (cp Checkpoint) snapshots() []Snapshot {
+	snapshots := make([]Snapshot, 0, len(cp.Counters)+1)
+	for _, c := range cp.Counters {
+		snapshots = append(snapshots, Snapshot{
+			Name:          c.Name,
+			Value:         c.Value,
+			TotalEvents:   c.TotalEvents,
+			LastUpdatedAt: c.LastUpdatedAt,
+			LastRequestID: c.LastRequestID,
+		})
+	}
+	if cp.Counters == nil && (cp.TotalEvents != 0 || cp.LastRequestID != "") {
+		legacy := Snapshot{
+			Name:          DefaultName,
+			Value:         cp.Value,
+			TotalEvents:   cp.TotalEvents,
+			LastRequestID: cp.LastRequestID,
+		}
+		if cp.LastUpdatedAt != nil {
+			legacy.LastUpdatedAt = *cp.LastUpdatedAt
+		}
+		snapshots = append(snapshots, legacy)
+	}
+	return snapshots
+}
+
+// totals returns the number of counters in the checkpoint and the sum of
+// their values
+func (cp Checkpoint) totals() (int, int64) {
+	snapshots := cp.snapshots()
+	var total int64
+	for _, s := range snapshots {
+		total += s.Value
+	}
+	return len(snapshots), total
+}
+
+// Positions returns the last handled stream position per publisher session.
+// While messages are handled in parallel, a session's position may be
+// ahead of messages still queued for other keys.
+func (p *Processor) Positions() map[int32]int64 {
+	return p.copyPositions()
+}
+
+func (p *Processor) copyPositions() map[int32]int64 {
+	p.positionsMu.Lock()
+	defer p.positionsMu.Unlock()
+	positions := make(map[int32]int64, len(p.positions))
+	for session, position := range p.positions {
+		positions[session] = position
+	}
+	return positions
+}
+
+func (p *Processor) apply(msg *message.Message) (Result, error) {
 	switch msg.Type {
 	case message.MessageTypeIncrement:
 		return p.handleIncrement(msg)
 	case message.MessageTypeReset:
 		return p.handleReset(msg)
+	case message.MessageTypeSet:
+		return p.handleSet(msg)
+	case message.MessageTypeCompareAndSet:
+		return p.handleCompareAndSet(msg)
+	case message.MessageTypeBoundedIncrement:
+		return p.handleBoundedIncrement(msg)
 	default:
 		p.logger.Warn("unknown message type", "type", msg.Type, "requestID", msg.RequestID)
-		return nil
+		return Result{}, fmt.Errorf("%w: %s", ErrUnknownMessageType, msg.Type)
 	}
 }
 
-func (p *Processor) handleIncrement(msg *message.Message) error {
+func (p *Processor) handleIncrement(msg *message.Message) (Result, error) {
 	payload, err := msg.DecodeIncrementPayload()
 	if err != nil {
 		p.logger.Error("failed to decode increment payload", "error", err, "requestID", msg.RequestID)
-		return err
+		return Result{}, err
 	}
 
-	newValue := p.state.Increment(payload.Amount)
+	c, err := p.state.Counter(payload.Name)
+	if err != nil {
+		p.logger.Warn("counter not created", "error", err, "counter", payload.Name, "requestID", msg.RequestID)
+		return Result{}, err
+	}
+	newValue := c.Increment(payload.Amount)
+	c.Touch(msg.RequestID)
 
 	p.logger.Info("counter incremented",
 		"requestID", msg.RequestID,
+		"counter", c.Name(),
 		"amount", payload.Amount,
 		"source", payload.Source,
 		"newValue", newValue,
-		"totalEvents", p.state.TotalEvents(),
+		"totalEvents", c.TotalEvents(),
 	)
 
-	return nil
+	return Result{Status: ResultApplied, Counter: c.Name(), Value: newValue}, nil
 }
 
-func (p *Processor) handleReset(msg *message.Message) error {
-	p.state.Reset()
+func (p *Processor) handleReset(msg *message.Message) (Result, error) {
+	// Resets from older publishers carry no payload
+	payload, err := msg.DecodeResetPayload()
+	if err != nil {
+		payload = &message.ResetPayload{}
+	}
+
+	p.state.Reset(msg.RequestID)
 
 	p.logger.Info("counter reset",
 		"requestID", msg.RequestID,
+		"reason", payload.Reason,
+		"requestedBy", payload.RequestedBy,
+	)
+
+	return Result{Status: ResultApplied}, nil
+}
+
+func (p *Processor) handleSet(msg *message.Message) (Result, error) {
+	payload, err := msg.DecodeSetPayload()
+	if err != nil {
+		p.logger.Error("failed to decode set payload", "error", err, "requestID", msg.RequestID)
+		return Result{}, err
+	}
+
+	c, err := p.state.Counter(payload.Name)
+	if err != nil {
+		p.logger.Warn("counter not created", "error", err, "counter", payload.Name, "requestID", msg.RequestID)
+		return Result{}, err
+	}
+	c.Set(payload.Value)
+	c.Touch(msg.RequestID)
+
+	p.logger.Info("counter set",
+		"requestID", msg.RequestID,
+		"counter", c.Name(),
+		"newValue", payload.Value,
+		"totalEvents", c.TotalEvents(),
 	)
 
-	return nil
+	return Result{Status: ResultApplied, Counter: c.Name(), Value: payload.Value}, nil
+}
+
+func (p *Processor) handleCompareAndSet(msg *message.Message) (Result, error) {
+	payload, err := msg.DecodeCompareAndSetPayload()
+	if err != nil {
+		p.logger.Error("failed to decode compare-and-set payload", "error", err, "requestID", msg.RequestID)
+		return Result{}, err
+	}
+
+	c, err := p.state.Counter(payload.Name)
+	if err != nil {
+		p.logger.Warn("counter not created", "error", err, "counter", payload.Name, "requestID", msg.RequestID)
+		return Result{}, err
+	}
+	value, ok := c.CompareAndSet(payload.Expected, payload.Value)
+	if !ok {
+		p.logger.Warn("compare-and-set rejected",
+			"requestID", msg.RequestID,
+			"counter", c.Name(),
+			"expected", payload.Expected,
+			"actual", value,
+		)
+		return Result{Status: ResultRejected, Counter: c.Name(), Value: value}, nil
+	}
+	c.Touch(msg.RequestID)
+
+	p.logger.Info("counter compare-and-set",
+		"requestID", msg.RequestID,
+		"counter", c.Name(),
+		"expected", payload.Expected,
+		"newValue", value,
+		"totalEvents", c.TotalEvents(),
+	)
+
+	return Result{Status: ResultApplied, Counter: c.Name(), Value: value}, nil
+}
+
+func (p *Processor) handleBoundedIncrement(msg *message.Message) (Result, error) {
+	payload, err := msg.DecodeBoundedIncrementPayload()
+	if err != nil {
+		p.logger.Error("failed to decode bounded increment payload", "error", err, "requestID", msg.RequestID)
+		return Result{}, err
+	}
+	if payload.Min > payload.Max {
+		err := fmt.Errorf("invalid bounds: min %d is greater than max %d", payload.Min, payload.Max)
+		p.logger.Error("invalid bounded increment", "error", err, "requestID", msg.RequestID)
+		return Result{}, err
+	}
+
+	c, err := p.state.Counter(payload.Name)
+	if err != nil {
+		p.logger.Warn("counter not created", "error", err, "counter", payload.Name, "requestID", msg.RequestID)
+		return Result{}, err
+	}
+	newValue, clamped := c.AddClamped(payload.Amount, payload.Min, payload.Max)
+	c.Touch(msg.RequestID)
+
+	p.logger.Info("counter incremented within bounds",
+		"requestID", msg.RequestID,
+		"counter", c.Name(),
+		"amount", payload.Amount,
+		"min", payload.Min,
+		"max", payload.Max,
+		"clamped", clamped,
+		"source", payload.Source,
+		"newValue", newValue,
+		"totalEvents", c.TotalEvents(),
+	)
+
+	status := ResultApplied
+	if clamped {
+		status = ResultClamped
+	}
+	return Result{Status: status, Counter: c.Name(), Value: newValue}, nil
 }
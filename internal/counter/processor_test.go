@@ -0,0 +1,188 @@
+package counter
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/k-omotani/aeron-sample/internal/message"
+	"github.com/k-omotani/aeron-sample/internal/metrics"
+)
+
+func newTestProcessor() *Processor {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewProcessor(NewState(), NewDeduplicator(DefaultDedupConfig()), logger)
+}
+
+func TestProcessorDuplicateReportsCurrentValue(t *testing.T) {
+	p := newTestProcessor()
+	var results []Result
+	p.AddResultListener(func(msg *message.Message, result Result) {
+		results = append(results, result)
+	})
+
+	increment := &message.Message{
+		Type:      message.MessageTypeIncrement,
+		RequestID: "req-1",
+		Payload:   &message.IncrementPayload{Amount: 5, Name: "page-views"},
+	}
+	reset := &message.Message{Type: message.MessageTypeReset, RequestID: "req-3", Payload: &message.ResetPayload{}}
+	for _, msg := range []*message.Message{
+		increment,
+		{Type: message.MessageTypeIncrement, RequestID: "req-2", Payload: &message.IncrementPayload{Amount: 2, Name: "page-views"}},
+		increment,
+		reset,
+		reset,
+	} {
+		if err := p.Handle(msg); err != nil {
+			t.Fatalf("Handle: %v", err)
+		}
+	}
+
+	want := []Result{
+		{RequestID: "req-1", Type: message.MessageTypeIncrement, Status: ResultApplied, Counter: "page-views", Value: 5},
+		{RequestID: "req-2", Type: message.MessageTypeIncrement, Status: ResultApplied, Counter: "page-views", Value: 7},
+		{RequestID: "req-1", Type: message.MessageTypeIncrement, Status: ResultDuplicate, Counter: "page-views", Value: 7},
+		{RequestID: "req-3", Type: message.MessageTypeReset, Status: ResultApplied},
+		{RequestID: "req-3", Type: message.MessageTypeReset, Status: ResultDuplicate},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(results), len(want))
+	}
+	for i := range want {
+		if results[i] != want[i] {
+			t.Errorf("result %d = %+v, want %+v", i, results[i], want[i])
+		}
+	}
+}
+
+func TestProcessorRejectsCountersPastMax(t *testing.T) {
+	p := newTestProcessor()
+	p.state.SetMaxCounters(2)
+	var results []Result
+	p.AddResultListener(func(msg *message.Message, result Result) {
+		results = append(results, result)
+	})
+
+	for i, name := range []string{"a", "", "c", "a"} {
+		msg := &message.Message{
+			Type:      message.MessageTypeIncrement,
+			RequestID: fmt.Sprintf("req-%d", i),
+			Payload:   &message.IncrementPayload{Amount: 1, Name: name},
+		}
+		err := p.Handle(msg)
+		if want := name == "c"; errors.Is(err, ErrTooManyCounters) != want {
+			t.Errorf("Handle(%q) = %v", name, err)
+		}
+	}
+
+	statuses := make([]ResultStatus, len(results))
+	for i, result := range results {
+		statuses[i] = result.Status
+	}
+	want := []ResultStatus{ResultApplied, ResultApplied, ResultFailed, ResultApplied}
+	if fmt.Sprint(statuses) != fmt.Sprint(want) {
+		t.Errorf("statuses = %v, want %v", statuses, want)
+	}
+	if _, ok := p.state.Get("c"); ok {
+		t.Error("counter c was created past the maximum")
+	}
+
+	// Restored counters are kept even past the maximum
+	p.state.Restore([]Snapshot{{Name: "a"}, {Name: "b"}, {Name: "c"}})
+	if n := len(p.state.Snapshots()); n != 3 {
+		t.Errorf("restored %d counters, want 3", n)
+	}
+	if _, err := p.state.Counter("c"); err != nil {
+		t.Errorf("Counter of a restored name = %v", err)
+	}
+}
+
+func TestCheckpointTotals(t *testing.T) {
+	tests := []struct {
+		name     string
+		cp       Checkpoint
+		counters int
+		total    int64
+	}{
+		{"empty", Checkpoint{}, 0, 0},
+		{"named counters", Checkpoint{Counters: []CounterCheckpoint{{Name: "a", Value: 3}, {Name: "b", Value: -1}}}, 2, 2},
+		{"legacy single counter", Checkpoint{Value: 9, TotalEvents: 4}, 1, 9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counters, total := tt.cp.totals()
+			if counters != tt.counters || total != tt.total {
+				t.Errorf("totals = %d, %d, want %d, %d", counters, total, tt.counters, tt.total)
+			}
+		})
+	}
+}
+
+// TestProcessorListenersConcurrent handles different counters in parallel,
+// as the subscriber's dispatcher does, with every built-in listener
+// registered; run it with -race
+func TestProcessorListenersConcurrent(t *testing.T) {
+	const (
+		workers  = 4
+		messages = 500
+	)
+	p := newTestProcessor()
+	p.RegisterMetrics(metrics.NewRegistry())
+	stats := NewStats()
+	p.AddResultListener(stats.Record)
+	windows := NewWindowAggregator(DefaultWindowConfig())
+	p.AddResultListener(windows.Record)
+	replies := make(chan *message.Message, workers*messages)
+	p.AddResultListener(ReplyListener(func(channel string, streamID int32, reply *message.Message) bool {
+		replies <- reply
+		return true
+	}))
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			name := fmt.Sprintf("counter-%d", w)
+			for i := 0; i < messages; i++ {
+				p.Handle(&message.Message{
+					Type:         message.MessageTypeIncrement,
+					SessionID:    int32(w),
+					Timestamp:    time.Now().UnixNano(),
+					ReplyChannel: "aeron:udp?endpoint=publisher:40124",
+					Payload:      &message.IncrementPayload{Amount: 1, Source: name, Name: name},
+				})
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := len(replies); got != workers*messages {
+		t.Errorf("sent %d replies, want %d", got, workers*messages)
+	}
+	snapshot := stats.Snapshot()
+	if len(snapshot.Sources) != workers {
+		t.Fatalf("stats has %d sources, want %d", len(snapshot.Sources), workers)
+	}
+	for _, source := range snapshot.Sources {
+		if source.Events != messages || source.Total != messages {
+			t.Errorf("source %s: %d events totalling %d, want %d", source.Key, source.Events, source.Total, messages)
+		}
+	}
+	series, err := windows.Series(time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events int64
+	for _, w := range append(series.Open, series.Closed...) {
+		events += w.Events
+	}
+	if events+series.Late != workers*messages {
+		t.Errorf("windows counted %d events and %d late, want %d in all", events, series.Late, workers*messages)
+	}
+}
@@ -0,0 +1,81 @@
+package counter
+
+import "github.com/k-omotani/aeron-sample/internal/message"
+
+// ResultStatus is the outcome of handling one message
+type ResultStatus uint8
+
+const (
+	// ResultApplied means the message changed the state as requested
+	ResultApplied ResultStatus = iota
+	// ResultClamped means a bounded increment hit its min or max
+	ResultClamped
+	// ResultRejected means a compare-and-set found a different value
+	ResultRejected
+	// ResultDuplicate means the request ID was already applied
+	ResultDuplicate
+	// ResultFailed means the message could not be applied
+	ResultFailed
+)
+
+func (s ResultStatus) String() string {
+	switch s {
+	case ResultApplied:
+		return "applied"
+	case ResultClamped:
+		return "clamped"
+	case ResultRejected:
+		return "rejected"
+	case ResultDuplicate:
+		return "duplicate"
+	case ResultFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// Result reports how the processor handled one message
+type Result struct {
+	RequestID string
+	Type      message.MessageType
+	Status    ResultStatus
+	Counter   string // empty for resets, which touch every counter
+	Value     int64  // counter value after the message, or its current value for duplicates
+	Err       error  // set when Status is ResultFailed
+}
+
+// ResultListener is called with every handled message and its result.
+// Messages for different counters may be handled in parallel, so listeners
+// are called concurrently and in stream order per PartitionKey only; a
+// reset is ordered against every other message. It is called while the
+// processor holds its read lock and must not block.
+type ResultListener func(msg *message.Message, result Result)
+
+// Reply converts the result into the payload sent back to the publisher
+func (r Result) Reply() *message.ReplyPayload {
+	reply := &message.ReplyPayload{
+		Status:  r.Status.String(),
+		Counter: r.Counter,
+		Value:   r.Value,
+	}
+	if r.Err != nil {
+		reply.Error = r.Err.Error()
+	}
+	return reply
+}
+
+// ReplyListener returns a ResultListener that answers every message
+// carrying a reply channel by passing a reply to send
+func ReplyListener(send func(channel string, streamID int32, reply *message.Message) bool) ResultListener {
+	return func(msg *message.Message, result Result) {
+		if msg.ReplyChannel == "" {
+			return
+		}
+		reply, err := message.NewReplyMessage(msg.RequestID, result.Reply())
+		if err != nil {
+			return
+		}
+		send(msg.ReplyChannel, msg.ReplyStreamID, reply)
+	}
+}
@@ -0,0 +1,121 @@
+package counter
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/k-omotani/aeron-sample/internal/snapshot"
+)
+
+// Snapshotter periodically persists the processor's checkpoint and
+// restores it at startup
+type Snapshotter struct {
+	processor *Processor
+	store     *snapshot.Store
+	interval  time.Duration
+	logger    *slog.Logger
+
+	barrier func(fn func()) // runs fn at a point where the checkpoint is consistent
+	saved   uint64          // processor updates covered by the last snapshot
+	stopped chan struct{}
+}
+
+// NewSnapshotter creates a snapshotter writing to store every interval
+func NewSnapshotter(processor *Processor, store *snapshot.Store, interval time.Duration, logger *slog.Logger) *Snapshotter {
+	return &Snapshotter{
+		processor: processor,
+		store:     store,
+		interval:  interval,
+		logger:    logger.With("component", "snapshotter"),
+		barrier:   func(fn func()) { fn() },
+		stopped:   make(chan struct{}),
+	}
+}
+
+// SetBarrier makes checkpoints run inside barrier, such as
+// aeron.Dispatcher.Quiesce, so that no message handled before the
+// checkpoint's positions is still waiting to be applied. It must be called
+// before Start.
+func (s *Snapshotter) SetBarrier(barrier func(fn func())) {
+	s.barrier = barrier
+}
+
+// Restore loads the latest snapshot into the processor.
+// A missing snapshot is not an error; a corrupt one is.
+func (s *Snapshotter) Restore() (Checkpoint, error) {
+	var cp Checkpoint
+	err := s.store.Load(&cp)
+	if errors.Is(err, snapshot.ErrNotFound) {
+		s.logger.Info("no snapshot found, starting empty", "path", s.store.Path())
+		return Checkpoint{}, nil
+	}
+	if err != nil {
+		return Checkpoint{}, err
+	}
+
+	s.processor.Restore(cp)
+	counters, total := cp.totals()
+	s.logger.Info("snapshot restored",
+		"path", s.store.Path(),
+		"counters", counters,
+		"total", total,
+		"sessions", len(cp.Positions),
+		"dedupEntries", len(cp.Dedup),
+		"createdAt", cp.CreatedAt,
+	)
+	return cp, nil
+}
+
+// Start writes a snapshot every interval until ctx is done
+func (s *Snapshotter) Start(ctx context.Context) {
+	go s.run(ctx)
+}
+
+// Close waits for the snapshot loop to stop and writes a final snapshot
+func (s *Snapshotter) Close() error {
+	<-s.stopped
+	return s.Save()
+}
+
+// Save writes a snapshot if anything was handled since the last one
+func (s *Snapshotter) Save() error {
+	var cp Checkpoint
+	var updates uint64
+	s.barrier(func() { cp, updates = s.processor.Checkpoint() })
+	if updates == s.saved {
+		return nil
+	}
+
+	start := time.Now()
+	if err := s.store.Save(cp); err != nil {
+		return err
+	}
+	s.saved = updates
+	counters, total := cp.totals()
+	s.logger.Debug("snapshot written",
+		"counters", counters,
+		"total", total,
+		"duration", time.Since(start),
+	)
+	return nil
+}
+
+func (s *Snapshotter) run(ctx context.Context) {
+	defer close(s.stopped)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Save(); err != nil {
+				s.logger.Error("failed to write snapshot", "error", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -1,38 +1,250 @@
 package counter
 
 import (
+	"errors"
+	"sort"
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
-// State holds the thread-safe counter value
+// DefaultName is the counter updated by messages that carry no name
+const DefaultName = "default"
+
+// DefaultMaxCounters is the default limit on the number of counters
+const DefaultMaxCounters = 1000
+
+// ErrTooManyCounters is returned when creating a counter would exceed the
+// configured maximum
+var ErrTooManyCounters = errors.New("too many counters")
+
+// State holds the thread-safe named counters.
+// Counters are created on first use and live until the process exits, up to
+// the maximum set with SetMaxCounters.
 type State struct {
+	mu          sync.RWMutex
+	counters    map[string]*Counter
+	maxCounters int
+}
+
+// Counter holds one named counter value
+type Counter struct {
+	name        string
 	value       int64
 	totalEvents int64
+	last        atomic.Pointer[lastUpdate]
+}
+
+// lastUpdate records the message that last changed a counter
+type lastUpdate struct {
+	requestID string
+	at        time.Time
+}
+
+// Snapshot is a point-in-time copy of one counter
+type Snapshot struct {
+	Name          string
+	Value         int64
+	TotalEvents   int64
+	LastUpdatedAt time.Time // zero before the first update
+	LastRequestID string
 }
 
 // NewState creates a new counter state
 func NewState() *State {
-	return &State{}
+	return &State{counters: make(map[string]*Counter)}
+}
+
+// SetMaxCounters limits how many counters Counter creates; 0 means no
+// limit. Restored counters count towards it but are never dropped.
+// It must be called before the state is shared.
+func (s *State) SetMaxCounters(n int) {
+	s.maxCounters = n
+}
+
+// Counter returns the counter called name, creating it if needed.
+// An empty name refers to DefaultName. It returns ErrTooManyCounters if
+// name is new and the maximum number of counters already exists.
+func (s *State) Counter(name string) (*Counter, error) {
+	if name == "" {
+		name = DefaultName
+	}
+
+	s.mu.RLock()
+	c, ok := s.counters[name]
+	s.mu.RUnlock()
+	if ok {
+		return c, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.counters[name]; ok {
+		return c, nil
+	}
+	if s.maxCounters > 0 && len(s.counters) >= s.maxCounters {
+		return nil, ErrTooManyCounters
+	}
+	c = &Counter{name: name}
+	s.counters[name] = c
+	return c, nil
+}
+
+// Get returns a snapshot of the counter called name, and false if it has
+// never been updated
+func (s *State) Get(name string) (Snapshot, bool) {
+	if name == "" {
+		name = DefaultName
+	}
+
+	s.mu.RLock()
+	c, ok := s.counters[name]
+	s.mu.RUnlock()
+	if !ok {
+		return Snapshot{Name: name}, false
+	}
+	return c.Snapshot(), true
+}
+
+// Snapshots returns every counter, sorted by name
+func (s *State) Snapshots() []Snapshot {
+	s.mu.RLock()
+	snapshots := make([]Snapshot, 0, len(s.counters))
+	for _, c := range s.counters {
+		snapshots = append(snapshots, c.Snapshot())
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Name < snapshots[j].Name })
+	return snapshots
+}
+
+// Reset sets every counter back to zero and records requestID as the
+// message that changed them
+func (s *State) Reset(requestID string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, c := range s.counters {
+		c.reset()
+		c.Touch(requestID)
+	}
+}
+
+// Restore replaces all counters with snapshots
+func (s *State) Restore(snapshots []Snapshot) {
+	counters := make(map[string]*Counter, len(snapshots))
+	for _, snapshot := range snapshots {
+		name := snapshot.Name
+		if name == "" {
+			name = DefaultName
+		}
+		c := &Counter{name: name}
+		c.restore(snapshot)
+		counters[name] = c
+	}
+
+	s.mu.Lock()
+	s.counters = counters
+	s.mu.Unlock()
+}
+
+// Name returns the counter name
+func (c *Counter) Name() string {
+	return c.name
 }
 
 // Increment adds the given amount to the counter
-func (s *State) Increment(amount int64) int64 {
-	atomic.AddInt64(&s.totalEvents, 1)
-	return atomic.AddInt64(&s.value, amount)
+func (c *Counter) Increment(amount int64) int64 {
+	atomic.AddInt64(&c.totalEvents, 1)
+	return atomic.AddInt64(&c.value, amount)
+}
+
+// Set overwrites the counter value
+func (c *Counter) Set(value int64) {
+	atomic.AddInt64(&c.totalEvents, 1)
+	atomic.StoreInt64(&c.value, value)
+}
+
+// CompareAndSet sets the counter to value if it currently holds expected.
+// It returns the value after the call and whether it was set.
+func (c *Counter) CompareAndSet(expected, value int64) (int64, bool) {
+	if !atomic.CompareAndSwapInt64(&c.value, expected, value) {
+		return atomic.LoadInt64(&c.value), false
+	}
+	atomic.AddInt64(&c.totalEvents, 1)
+	return value, true
+}
+
+// AddClamped adds amount to the counter and clamps the result to [min, max].
+// It returns the new value and whether it was clamped.
+func (c *Counter) AddClamped(amount, min, max int64) (int64, bool) {
+	for {
+		current := atomic.LoadInt64(&c.value)
+		next, clamped := clamp(current, amount, min, max)
+		if atomic.CompareAndSwapInt64(&c.value, current, next) {
+			atomic.AddInt64(&c.totalEvents, 1)
+			return next, clamped
+		}
+	}
+}
+
+// clamp returns current+amount limited to [min, max], saturating on overflow
+func clamp(current, amount, min, max int64) (int64, bool) {
+	next := current + amount
+	switch {
+	case amount > 0 && next < current:
+		return max, true
+	case amount < 0 && next > current:
+		return min, true
+	case next > max:
+		return max, true
+	case next < min:
+		return min, true
+	}
+	return next, false
 }
 
 // Value returns the current counter value
-func (s *State) Value() int64 {
-	return atomic.LoadInt64(&s.value)
+func (c *Counter) Value() int64 {
+	return atomic.LoadInt64(&c.value)
+}
+
+// TotalEvents returns the total number of events applied to the counter
+func (c *Counter) TotalEvents() int64 {
+	return atomic.LoadInt64(&c.totalEvents)
+}
+
+// Touch records requestID as the message that last changed the counter
+func (c *Counter) Touch(requestID string) {
+	c.last.Store(&lastUpdate{requestID: requestID, at: time.Now()})
+}
+
+// Snapshot returns the current counter state
+func (c *Counter) Snapshot() Snapshot {
+	snapshot := Snapshot{
+		Name:        c.name,
+		Value:       c.Value(),
+		TotalEvents: c.TotalEvents(),
+	}
+	if last := c.last.Load(); last != nil {
+		snapshot.LastUpdatedAt = last.at
+		snapshot.LastRequestID = last.requestID
+	}
+	return snapshot
 }
 
-// TotalEvents returns the total number of events processed
-func (s *State) TotalEvents() int64 {
-	return atomic.LoadInt64(&s.totalEvents)
+func (c *Counter) reset() {
+	atomic.StoreInt64(&c.value, 0)
+	atomic.StoreInt64(&c.totalEvents, 0)
 }
 
-// Reset sets the counter back to zero
-func (s *State) Reset() {
-	atomic.StoreInt64(&s.value, 0)
-	atomic.StoreInt64(&s.totalEvents, 0)
+func (c *Counter) restore(snapshot Snapshot) {
+	atomic.StoreInt64(&c.value, snapshot.Value)
+	atomic.StoreInt64(&c.totalEvents, snapshot.TotalEvents)
+	if snapshot.LastUpdatedAt.IsZero() && snapshot.LastRequestID == "" {
+		c.last.Store(nil)
+		return
+	}
+	c.last.Store(&lastUpdate{requestID: snapshot.LastRequestID, at: snapshot.LastUpdatedAt})
 }
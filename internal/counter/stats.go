@@ -0,0 +1,239 @@
+package counter
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/k-omotani/aeron-sample/internal/message"
+)
+
+// rateTick is how often the rolling rates are updated
+const rateTick = 5 * time.Second
+
+// rateWindows are the periods the rolling rates average over
+var rateWindows = [3]time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute}
+
+// SourceStats reports what one source or publisher session contributed
+type SourceStats struct {
+	Key      string    `json:"key"`
+	Events   int64     `json:"events"`    // messages handled, excluding duplicates
+	Total    int64     `json:"total"`     // sum of increment amounts
+	LastSeen time.Time `json:"last_seen"` // when the last message was handled
+	Rate1m   float64   `json:"rate_1m"`   // events per second, averaged over 1 minute
+	Rate5m   float64   `json:"rate_5m"`
+	Rate15m  float64   `json:"rate_15m"`
+}
+
+// StatsSnapshot is a point-in-time copy of the statistics, sorted by key
+type StatsSnapshot struct {
+	Sources  []SourceStats `json:"sources"`
+	Sessions []SourceStats `json:"sessions"`
+}
+
+// Stats aggregates handled messages by payload source and by publisher
+// session. Register Record as a ResultListener on the Processor.
+type Stats struct {
+	now func() time.Time
+
+	mu       sync.Mutex
+	sources  map[string]*sourceEntry
+	sessions map[int32]*sourceEntry
+}
+
+type sourceEntry struct {
+	events   int64
+	total    int64
+	lastSeen time.Time
+	rate     meter
+}
+
+// NewStats creates empty statistics
+func NewStats() *Stats {
+	return &Stats{
+		now:      time.Now,
+		sources:  make(map[string]*sourceEntry),
+		sessions: make(map[int32]*sourceEntry),
+	}
+}
+
+// Record adds a handled message to the statistics. Duplicates are ignored.
+// Messages without a source, such as resets, count only towards their session.
+func (s *Stats) Record(msg *message.Message, result Result) {
+	if result.Status == ResultDuplicate {
+		return
+	}
+	source, amount := sourceOf(msg)
+	if result.Status != ResultApplied && result.Status != ResultClamped {
+		amount = 0
+	}
+
+	// Read the clock under the lock so concurrent records do not move
+	// lastSeen or the meters back
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+
+	session, ok := s.sessions[msg.SessionID]
+	if !ok {
+		session = &sourceEntry{rate: newMeter(now)}
+		s.sessions[msg.SessionID] = session
+	}
+	session.record(now, amount)
+
+	if source == "" {
+		return
+	}
+	entry, ok := s.sources[source]
+	if !ok {
+		entry = &sourceEntry{rate: newMeter(now)}
+		s.sources[source] = entry
+	}
+	entry.record(now, amount)
+}
+
+// Forget drops the statistics of a publisher session that has gone away.
+// Its contributions stay in the per-source statistics.
+func (s *Stats) Forget(sessionID int32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, sessionID)
+}
+
+// Source returns the statistics of one source, and false if it has not been seen
+func (s *Stats) Source(source string) (SourceStats, bool) {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.sources[source]
+	if !ok {
+		return SourceStats{Key: source}, false
+	}
+	return entry.stats(source, now), true
+}
+
+// Snapshot returns the statistics of every source and session
+func (s *Stats) Snapshot() StatsSnapshot {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := StatsSnapshot{
+		Sources:  make([]SourceStats, 0, len(s.sources)),
+		Sessions: make([]SourceStats, 0, len(s.sessions)),
+	}
+	for source, entry := range s.sources {
+		snapshot.Sources = append(snapshot.Sources, entry.stats(source, now))
+	}
+	sort.Slice(snapshot.Sources, func(i, j int) bool { return snapshot.Sources[i].Key < snapshot.Sources[j].Key })
+
+	sessions := make([]int32, 0, len(s.sessions))
+	for session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i] < sessions[j] })
+	for _, session := range sessions {
+		snapshot.Sessions = append(snapshot.Sessions, s.sessions[session].stats(sessionKey(session), now))
+	}
+	return snapshot
+}
+
+// sourceOf returns the source and increment amount carried by msg
+func sourceOf(msg *message.Message) (string, int64) {
+	switch payload := msg.Payload.(type) {
+	case *message.IncrementPayload:
+		return payload.Source, payload.Amount
+	case *message.BoundedIncrementPayload:
+		return payload.Source, payload.Amount
+	default:
+		return "", 0
+	}
+}
+
+// sessionKey formats an Aeron session ID as a stats key
+func sessionKey(session int32) string {
+	return strconv.FormatInt(int64(session), 10)
+}
+
+func (e *sourceEntry) record(now time.Time, amount int64) {
+	e.events++
+	e.total += amount
+	e.lastSeen = now
+	e.rate.mark(now)
+}
+
+func (e *sourceEntry) stats(key string, now time.Time) SourceStats {
+	rates := e.rate.rates(now)
+	return SourceStats{
+		Key:      key,
+		Events:   e.events,
+		Total:    e.total,
+		LastSeen: e.lastSeen,
+		Rate1m:   rates[0],
+		Rate5m:   rates[1],
+		Rate15m:  rates[2],
+	}
+}
+
+// meter keeps exponentially weighted moving averages of an event rate,
+// updated every rateTick like Unix load averages. It is not safe for
+// concurrent use.
+type meter struct {
+	uncounted   int64
+	avg         [len(rateWindows)]float64
+	initialized bool
+	lastTick    time.Time
+}
+
+func newMeter(now time.Time) meter {
+	return meter{lastTick: now}
+}
+
+func (m *meter) mark(now time.Time) {
+	m.tickIfNecessary(now)
+	m.uncounted++
+}
+
+// rates returns the averaged rates, in events per second
+func (m *meter) rates(now time.Time) [len(rateWindows)]float64 {
+	m.tickIfNecessary(now)
+	return m.avg
+}
+
+// maxCatchUpTicks bounds the ticks replayed after a long idle period;
+// by then every average has decayed to nothing
+const maxCatchUpTicks = 1000
+
+func (m *meter) tickIfNecessary(now time.Time) {
+	ticks := int64(now.Sub(m.lastTick) / rateTick)
+	if ticks <= 0 {
+		return
+	}
+	m.lastTick = m.lastTick.Add(time.Duration(ticks) * rateTick)
+	if ticks > maxCatchUpTicks {
+		m.avg = [len(rateWindows)]float64{}
+		m.uncounted = 0
+		m.initialized = true
+		return
+	}
+	for range ticks {
+		m.tick()
+	}
+}
+
+func (m *meter) tick() {
+	instant := float64(m.uncounted) / rateTick.Seconds()
+	m.uncounted = 0
+	for i, window := range rateWindows {
+		if !m.initialized {
+			m.avg[i] = instant
+			continue
+		}
+		alpha := 1 - math.Exp(-rateTick.Seconds()/window.Seconds())
+		m.avg[i] += alpha * (instant - m.avg[i])
+	}
+	m.initialized = true
+}
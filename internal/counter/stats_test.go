@@ -0,0 +1,29 @@
+package counter
+
+import (
+	"testing"
+
+	"github.com/k-omotani/aeron-sample/internal/message"
+)
+
+func TestStatsForget(t *testing.T) {
+	s := NewStats()
+	for _, session := range []int32{1, 2} {
+		s.Record(&message.Message{
+			Type:      message.MessageTypeIncrement,
+			SessionID: session,
+			Payload:   &message.IncrementPayload{Amount: 2, Source: "publisher-a"},
+		}, Result{Status: ResultApplied})
+	}
+
+	s.Forget(1)
+	s.Forget(3) // unknown sessions are ignored
+
+	snapshot := s.Snapshot()
+	if len(snapshot.Sessions) != 1 || snapshot.Sessions[0].Key != "2" {
+		t.Errorf("sessions = %+v, want only session 2", snapshot.Sessions)
+	}
+	if source, ok := s.Source("publisher-a"); !ok || source.Events != 2 || source.Total != 4 {
+		t.Errorf("source = %+v, %v, want both messages kept", source, ok)
+	}
+}
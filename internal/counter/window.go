@@ -0,0 +1,319 @@
+package counter
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/k-omotani/aeron-sample/internal/message"
+)
+
+var (
+	ErrUnknownWindowSize = errors.New("unknown window size")
+	ErrInvalidLength     = errors.New("invalid sliding window length")
+)
+
+// WindowConfig configures a WindowAggregator
+type WindowConfig struct {
+	// Sizes are the tumbling window lengths to aggregate, e.g. 1s, 1m and 1h
+	Sizes []time.Duration
+	// Retain is how many closed windows are kept per size
+	Retain int
+	// AllowedLateness is how far behind the watermark trails the slowest
+	// publisher's event time, so slightly late events still land in their window
+	AllowedLateness time.Duration
+	// MaxClockSkew bounds how far ahead of the subscriber's clock an event
+	// timestamp may be; events further ahead are counted as skewed and dropped
+	MaxClockSkew time.Duration
+	// IdleTimeout is how long a publisher session may go quiet before it
+	// stops holding back the watermark
+	IdleTimeout time.Duration
+}
+
+// DefaultWindowConfig aggregates per second, minute and hour
+func DefaultWindowConfig() WindowConfig {
+	return WindowConfig{
+		Sizes:           []time.Duration{time.Second, time.Minute, time.Hour},
+		Retain:          60,
+		AllowedLateness: 2 * time.Second,
+		MaxClockSkew:    time.Minute,
+		IdleTimeout:     5 * time.Minute,
+	}
+}
+
+// Window is the aggregate of the events whose timestamps fall in [Start, End)
+type Window struct {
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Events int64     `json:"events"`
+	Total  int64     `json:"total"` // sum of increment amounts
+}
+
+// WindowSeries is a snapshot of the windows of one size
+type WindowSeries struct {
+	Size      string    `json:"size"`
+	Watermark time.Time `json:"watermark"`
+	Open      []Window  `json:"open"`   // still accepting events, oldest first
+	Closed    []Window  `json:"closed"` // oldest first
+	Late      int64     `json:"late"`   // events dropped because their window had closed
+	Skewed    int64     `json:"skewed"` // events dropped for being too far in the future
+}
+
+// SlidingWindow is the aggregate over the most recent closed windows
+type SlidingWindow struct {
+	Window
+	Complete bool `json:"complete"` // false when the retained windows do not reach back to Start
+}
+
+// WindowAggregator counts events per tumbling window of event time
+// (Message.Timestamp). Register Record as a ResultListener on the Processor.
+//
+// Windows close when the watermark passes their end. The watermark follows
+// the slowest active publisher session: each session's event clock is its
+// last timestamp advanced by the time since it arrived, so a publisher
+// whose clock runs behind holds windows open for its events while an idle
+// one does not stall them. Events behind the watermark are late and dropped.
+type WindowAggregator struct {
+	config WindowConfig
+	now    func() time.Time
+
+	mu         sync.Mutex
+	series     []*windowSeries
+	sessions   map[int32]sessionClock
+	watermark  time.Time
+	advancedAt time.Time // when the watermark was last computed
+	skewed     int64
+}
+
+// sessionClock is the last event time seen from a publisher session and
+// when it arrived
+type sessionClock struct {
+	eventTime time.Time
+	seenAt    time.Time
+}
+
+type windowSeries struct {
+	size   time.Duration
+	open   map[int64]*Window // keyed by start, unix nanos
+	closed []Window          // oldest first
+	late   int64
+	// from is the event time since which closed holds every window that
+	// had events: the first whole window after startup, then the end of
+	// the last window dropped beyond Retain
+	from time.Time
+}
+
+// NewWindowAggregator creates an aggregator with no events
+func NewWindowAggregator(config WindowConfig) *WindowAggregator {
+	a := &WindowAggregator{
+		config:   config,
+		now:      time.Now,
+		sessions: make(map[int32]sessionClock),
+	}
+	for _, size := range config.Sizes {
+		a.series = append(a.series, &windowSeries{size: size, open: make(map[int64]*Window)})
+	}
+	return a
+}
+
+// Record adds an applied message to the window its timestamp falls in.
+// Duplicates, rejections and failures are ignored.
+func (a *WindowAggregator) Record(msg *message.Message, result Result) {
+	if result.Status != ResultApplied && result.Status != ResultClamped {
+		return
+	}
+	_, amount := sourceOf(msg)
+
+	// Records arrive concurrently from the processor's workers; reading the
+	// clock under the lock keeps seenAt and advancedAt from moving back
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.now()
+	eventTime := now
+	if msg.Timestamp != 0 {
+		eventTime = time.Unix(0, msg.Timestamp)
+	}
+
+	if eventTime.After(now.Add(a.config.MaxClockSkew)) {
+		a.skewed++
+		return
+	}
+	// An out-of-order event does not move the clock back, but it does show
+	// the session is still active
+	clock := a.sessions[msg.SessionID]
+	if eventTime.After(clock.eventTime) {
+		clock.eventTime = eventTime
+	}
+	clock.seenAt = now
+	a.sessions[msg.SessionID] = clock
+
+	for _, s := range a.series {
+		start := eventTime.Truncate(s.size)
+		if !start.Add(s.size).After(a.watermark) {
+			s.late++
+			continue
+		}
+		w, ok := s.open[start.UnixNano()]
+		if !ok {
+			w = &Window{Start: start, End: start.Add(s.size)}
+			s.open[start.UnixNano()] = w
+		}
+		w.Events++
+		w.Total += amount
+	}
+
+	a.advance(now)
+}
+
+// Watermark returns the event time before which all windows are closed
+func (a *WindowAggregator) Watermark() time.Time {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.advance(a.now())
+	return a.watermark
+}
+
+// Sizes returns the configured window sizes
+func (a *WindowAggregator) Sizes() []time.Duration {
+	return a.config.Sizes
+}
+
+// Series returns the open windows and the last limit closed windows of the
+// given size; limit <= 0 returns every retained window
+func (a *WindowAggregator) Series(size time.Duration, limit int) (WindowSeries, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	s := a.find(size)
+	if s == nil {
+		return WindowSeries{}, fmt.Errorf("%w: %s", ErrUnknownWindowSize, size)
+	}
+	a.advance(a.now())
+
+	closed := s.closed
+	if limit > 0 && len(closed) > limit {
+		closed = closed[len(closed)-limit:]
+	}
+	series := WindowSeries{
+		Size:      size.String(),
+		Watermark: a.watermark,
+		Open:      make([]Window, 0, len(s.open)),
+		Closed:    append([]Window(nil), closed...),
+		Late:      s.late,
+		Skewed:    a.skewed,
+	}
+	for _, w := range s.open {
+		series.Open = append(series.Open, *w)
+	}
+	sort.Slice(series.Open, func(i, j int) bool { return series.Open[i].Start.Before(series.Open[j].Start) })
+	return series, nil
+}
+
+// Sliding sums the closed windows of the given size that make up the most
+// recent length of event time. length must be a multiple of size.
+func (a *WindowAggregator) Sliding(size, length time.Duration) (SlidingWindow, error) {
+	if length <= 0 || length%size != 0 {
+		return SlidingWindow{}, fmt.Errorf("%w: %s is not a multiple of %s", ErrInvalidLength, length, size)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	s := a.find(size)
+	if s == nil {
+		return SlidingWindow{}, fmt.Errorf("%w: %s", ErrUnknownWindowSize, size)
+	}
+	a.advance(a.now())
+
+	// The sliding window ends at the last closed window boundary
+	end := a.watermark.Truncate(size)
+	sliding := SlidingWindow{Window: Window{Start: end.Add(-length), End: end}}
+	for _, w := range s.closed {
+		if !w.Start.Before(sliding.Start) && !w.End.After(end) {
+			sliding.Events += w.Events
+			sliding.Total += w.Total
+		}
+	}
+	sliding.Complete = !s.from.IsZero() && !sliding.Start.Before(s.from)
+	return sliding, nil
+}
+
+func (a *WindowAggregator) find(size time.Duration) *windowSeries {
+	for _, s := range a.series {
+		if s.size == size {
+			return s
+		}
+	}
+	return nil
+}
+
+// advance moves the watermark up to the slowest active session's clock,
+// minus the allowed lateness, and closes the windows it passes. Once every
+// session has gone idle the watermark keeps pace with the local clock.
+// It must be called with mu held.
+func (a *WindowAggregator) advance(now time.Time) {
+	elapsed := now.Sub(a.advancedAt)
+	a.advancedAt = now
+
+	var slowest time.Time
+	for session, clock := range a.sessions {
+		idle := now.Sub(clock.seenAt)
+		if idle > a.config.IdleTimeout {
+			delete(a.sessions, session)
+			continue
+		}
+		current := clock.eventTime.Add(idle)
+		if slowest.IsZero() || current.Before(slowest) {
+			slowest = current
+		}
+	}
+	switch {
+	case !slowest.IsZero():
+		if a.watermark.IsZero() {
+			a.start(slowest.Add(-a.config.AllowedLateness))
+		}
+		if watermark := slowest.Add(-a.config.AllowedLateness); watermark.After(a.watermark) {
+			a.watermark = watermark
+		}
+	case a.watermark.IsZero():
+		return
+	case elapsed > 0:
+		a.watermark = a.watermark.Add(elapsed)
+	}
+
+	for _, s := range a.series {
+		var closing []Window
+		for start, w := range s.open {
+			if !w.End.After(a.watermark) {
+				closing = append(closing, *w)
+				delete(s.open, start)
+			}
+		}
+		if len(closing) == 0 {
+			continue
+		}
+		sort.Slice(closing, func(i, j int) bool { return closing[i].Start.Before(closing[j].Start) })
+		s.closed = append(s.closed, closing...)
+		if excess := len(s.closed) - a.config.Retain; excess > 0 {
+			if end := s.closed[excess-1].End; end.After(s.from) {
+				s.from = end
+			}
+			s.closed = append(s.closed[:0], s.closed[excess:]...)
+		}
+	}
+}
+
+// start records where the first watermark falls: events before it were
+// never counted, so each series is complete from its next window boundary.
+// It must be called with mu held.
+func (a *WindowAggregator) start(watermark time.Time) {
+	for _, s := range a.series {
+		s.from = watermark.Truncate(s.size)
+		if s.from.Before(watermark) {
+			s.from = s.from.Add(s.size)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package counter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/k-omotani/aeron-sample/internal/message"
+)
+
+// testWindows returns an aggregator of 1s windows whose clock is set with
+// the returned function
+func testWindows(config WindowConfig) (*WindowAggregator, func(time.Time)) {
+	a := NewWindowAggregator(config)
+	var now time.Time
+	a.now = func() time.Time { return now }
+	return a, func(t time.Time) { now = t }
+}
+
+func recordAt(a *WindowAggregator, session int32, eventTime time.Time) {
+	a.Record(&message.Message{
+		Type:      message.MessageTypeIncrement,
+		Timestamp: eventTime.UnixNano(),
+		SessionID: session,
+		Payload:   &message.IncrementPayload{Amount: 1},
+	}, Result{Status: ResultApplied})
+}
+
+func TestWindowSessionStaysActiveWithoutNewerEvents(t *testing.T) {
+	a, setNow := testWindows(WindowConfig{
+		Sizes:        []time.Duration{time.Second},
+		Retain:       60,
+		MaxClockSkew: time.Hour,
+		IdleTimeout:  5 * time.Second,
+	})
+	t0 := time.Unix(1_700_000_000, 0)
+
+	// Session 1 keeps sending events stamped with the same time, as a
+	// publisher with a stalled clock or a replayed batch would; session 2
+	// is up to date
+	for i := 0; i <= 10; i++ {
+		now := t0.Add(time.Duration(i) * time.Second)
+		setNow(now)
+		recordAt(a, 1, t0)
+		recordAt(a, 2, now)
+	}
+
+	if watermark := a.Watermark(); watermark.After(t0) {
+		t.Errorf("watermark %s passed the clock of an active session at %s", watermark, t0)
+	}
+
+	// Once it stops sending for longer than IdleTimeout it is idle
+	setNow(t0.Add(16 * time.Second))
+	recordAt(a, 2, t0.Add(16*time.Second))
+	if watermark := a.Watermark(); !watermark.Equal(t0.Add(16 * time.Second)) {
+		t.Errorf("watermark = %s after session 1 went idle, want %s", watermark, t0.Add(16*time.Second))
+	}
+}
+
+func TestSlidingComplete(t *testing.T) {
+	a, setNow := testWindows(WindowConfig{
+		Sizes:        []time.Duration{time.Second},
+		Retain:       5,
+		MaxClockSkew: time.Hour,
+		IdleTimeout:  time.Hour,
+	})
+	t0 := time.Unix(1_700_000_000, 0)
+	tick := func(k int) {
+		now := t0.Add(time.Duration(k)*time.Second + 500*time.Millisecond)
+		setNow(now)
+		recordAt(a, 1, now)
+	}
+	check := func(length time.Duration, complete bool, events int64) {
+		t.Helper()
+		sliding, err := a.Sliding(time.Second, length)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sliding.Complete != complete || sliding.Events != events {
+			t.Errorf("Sliding(%s) = complete %v with %d events, want %v with %d", length, sliding.Complete, sliding.Events, complete, events)
+		}
+	}
+
+	// Windows from before the first watermark were never counted in full
+	for k := 0; k <= 4; k++ {
+		tick(k)
+	}
+	check(3*time.Second, true, 3)
+	check(4*time.Second, false, 4)
+
+	// Windows dropped beyond Retain are no longer covered
+	for k := 5; k <= 10; k++ {
+		tick(k)
+	}
+	check(5*time.Second, true, 5)
+	check(6*time.Second, false, 5)
+
+	// Quiet windows are never created, but are still covered
+	setNow(t0.Add(14*time.Second + 500*time.Millisecond))
+	check(5*time.Second, true, 2)
+}
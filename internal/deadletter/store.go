@@ -0,0 +1,321 @@
+package deadletter
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrNotFound = errors.New("dead letter not found")
+
+// Stages at which a message can fail
+const (
+	StageDecode = "decode" // the frame could not be decoded
+	StageHandle = "handle" // the handler returned an error
+)
+
+// Letter is a message the subscriber could not decode or handle, kept
+// with enough context to inspect it and publish it again
+type Letter struct {
+	ID        uint64    `json:"id"` // assigned by the store, increasing
+	Time      time.Time `json:"time"`
+	SessionID int32     `json:"session_id"`
+	Position  int64     `json:"position"`
+	Stage     string    `json:"stage"`
+	Error     string    `json:"error"`
+	Frame     []byte    `json:"frame"` // codec ID and body, as received
+}
+
+// Sink receives dead letters
+type Sink interface {
+	Write(letter Letter) error
+}
+
+// FileConfig configures a FileStore
+type FileConfig struct {
+	// Dir holds the dead-letter files
+	Dir string
+	// MaxFileSize is the size, in bytes, past which a new file is started
+	MaxFileSize int64
+	// MaxFiles is how many files are kept; the oldest is deleted when a
+	// new one would exceed it
+	MaxFiles int
+}
+
+// DefaultFileConfig returns the default rotation limits
+func DefaultFileConfig() FileConfig {
+	return FileConfig{
+		MaxFileSize: 16 << 20,
+		MaxFiles:    8,
+	}
+}
+
+const (
+	filePrefix = "dead-letters-"
+	fileSuffix = ".jsonl"
+)
+
+// FileStore is an append-only Sink that writes one JSON line per letter
+// and rotates files by size. Each write is synced before it returns.
+// A line cut short by a crash is skipped when reading.
+type FileStore struct {
+	config FileConfig
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	index  int    // number of the file being written
+	nextID uint64 // ID of the next letter
+}
+
+// OpenFileStore opens the store in config.Dir, creating it if needed, and
+// continues numbering after the letters already there
+func OpenFileStore(config FileConfig) (*FileStore, error) {
+	if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &FileStore{config: config, nextID: 1}
+
+	indexes, err := s.indexes()
+	if err != nil {
+		return nil, err
+	}
+	if len(indexes) == 0 {
+		return s, s.rotate()
+	}
+
+	// The newest letter may be in an older file if the last one is empty
+	for i := len(indexes) - 1; i >= 0; i-- {
+		letters, err := readFile(filePath(config.Dir, indexes[i]))
+		if err != nil {
+			return nil, err
+		}
+		if len(letters) > 0 {
+			s.nextID = letters[len(letters)-1].ID + 1
+			break
+		}
+	}
+
+	s.index = indexes[len(indexes)-1]
+	if err := s.reopen(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// reopen opens the last file for appending. A line cut short by a crash
+// is ended first, so the next letter starts on a line of its own.
+func (s *FileStore) reopen() error {
+	file, err := os.OpenFile(s.path(s.index), os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	s.file = file
+	s.size = info.Size()
+	if s.size == 0 {
+		return nil
+	}
+
+	last := make([]byte, 1)
+	if _, err := file.ReadAt(last, s.size-1); err != nil {
+		file.Close()
+		return err
+	}
+	if last[0] != '\n' {
+		n, err := file.Write([]byte{'\n'})
+		s.size += int64(n)
+		if err != nil {
+			file.Close()
+			return err
+		}
+	}
+	return nil
+}
+
+// Write appends letter, assigning its ID
+func (s *FileStore) Write(letter Letter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return os.ErrClosed
+	}
+	letter.ID = s.nextID
+	line, err := json.Marshal(letter)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	if s.size > 0 && s.size+int64(len(line)) > s.config.MaxFileSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	s.nextID++
+	return nil
+}
+
+// List returns every stored letter, oldest first
+func (s *FileStore) List() ([]Letter, error) {
+	return List(s.config.Dir)
+}
+
+// Get returns the letter with the given ID
+func (s *FileStore) Get(id uint64) (Letter, error) {
+	return Get(s.config.Dir, id)
+}
+
+// Close closes the file being written
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// rotate starts the next file and deletes the oldest ones past MaxFiles.
+// It must be called with mu held, or before the store is shared.
+func (s *FileStore) rotate() error {
+	if s.file != nil {
+		if err := s.file.Close(); err != nil {
+			return err
+		}
+	}
+	s.index++
+	file, err := os.OpenFile(s.path(s.index), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		s.file = nil
+		return err
+	}
+	s.file = file
+	s.size = 0
+
+	indexes, err := s.indexes()
+	if err != nil {
+		return err
+	}
+	for len(indexes) > max(s.config.MaxFiles, 1) {
+		if err := os.Remove(s.path(indexes[0])); err != nil {
+			return err
+		}
+		indexes = indexes[1:]
+	}
+	return nil
+}
+
+func (s *FileStore) path(index int) string {
+	return filePath(s.config.Dir, index)
+}
+
+func filePath(dir string, index int) string {
+	return filepath.Join(dir, fmt.Sprintf("%s%06d%s", filePrefix, index, fileSuffix))
+}
+
+func (s *FileStore) indexes() ([]int, error) {
+	return fileIndexes(s.config.Dir)
+}
+
+// List reads every letter stored in dir, oldest first, without opening
+// the store for writing
+func List(dir string) ([]Letter, error) {
+	indexes, err := fileIndexes(dir)
+	if err != nil {
+		return nil, err
+	}
+	var letters []Letter
+	for _, index := range indexes {
+		fileLetters, err := readFile(filePath(dir, index))
+		if errors.Is(err, os.ErrNotExist) {
+			continue // rotated away while listing
+		}
+		if err != nil {
+			return nil, err
+		}
+		letters = append(letters, fileLetters...)
+	}
+	return letters, nil
+}
+
+// Get reads the letter with the given ID from dir
+func Get(dir string, id uint64) (Letter, error) {
+	letters, err := List(dir)
+	if err != nil {
+		return Letter{}, err
+	}
+	for _, letter := range letters {
+		if letter.ID == id {
+			return letter, nil
+		}
+	}
+	return Letter{}, fmt.Errorf("%w: %d", ErrNotFound, id)
+}
+
+// fileIndexes returns the numbers of the dead-letter files in dir, in order
+func fileIndexes(dir string) ([]int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var indexes []int
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, filePrefix) || !strings.HasSuffix(name, fileSuffix) {
+			continue
+		}
+		index, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, filePrefix), fileSuffix))
+		if err != nil {
+			continue
+		}
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	return indexes, nil
+}
+
+// readFile decodes the letters of one file, skipping lines that do not
+// parse, such as one cut short by a crash
+func readFile(path string) ([]Letter, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var letters []Letter
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64<<10), 64<<20)
+	for scanner.Scan() {
+		var letter Letter
+		if err := json.Unmarshal(scanner.Bytes(), &letter); err != nil {
+			continue
+		}
+		letters = append(letters, letter)
+	}
+	return letters, scanner.Err()
+}
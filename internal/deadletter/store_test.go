@@ -0,0 +1,262 @@
+package deadletter
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func openTestStore(t *testing.T, config FileConfig) *FileStore {
+	t.Helper()
+	store, err := OpenFileStore(config)
+	if err != nil {
+		t.Fatalf("OpenFileStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func testConfig(t *testing.T) FileConfig {
+	t.Helper()
+	config := DefaultFileConfig()
+	config.Dir = t.TempDir()
+	return config
+}
+
+func testLetter(position int64) Letter {
+	return Letter{
+		Time:      time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		SessionID: 7,
+		Position:  position,
+		Stage:     StageDecode,
+		Error:     "unknown codec: id 9",
+		Frame:     []byte{9, 1, 2, 3},
+	}
+}
+
+func write(t *testing.T, s *FileStore, letters ...Letter) {
+	t.Helper()
+	for _, letter := range letters {
+		if err := s.Write(letter); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+}
+
+// ids returns the IDs of the letters stored in dir
+func ids(t *testing.T, dir string) []uint64 {
+	t.Helper()
+	letters, err := List(dir)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	ids := make([]uint64, len(letters))
+	for i, letter := range letters {
+		ids[i] = letter.ID
+	}
+	return ids
+}
+
+func TestFileStoreWriteList(t *testing.T) {
+	config := testConfig(t)
+	store := openTestStore(t, config)
+	write(t, store, testLetter(64), testLetter(128), testLetter(192))
+
+	letters, err := store.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(letters) != 3 {
+		t.Fatalf("listed %d letters, want 3", len(letters))
+	}
+	for i, letter := range letters {
+		want := testLetter(int64(64 * (i + 1)))
+		want.ID = uint64(i + 1)
+		if !reflect.DeepEqual(letter, want) {
+			t.Errorf("letter %d = %+v, want %+v", i, letter, want)
+		}
+	}
+
+	if letter, err := store.Get(2); err != nil || letter.Position != 128 {
+		t.Errorf("Get(2) = %+v, %v", letter, err)
+	}
+	if _, err := store.Get(9); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(9) = %v, want ErrNotFound", err)
+	}
+
+	store.Close()
+	if err := store.Write(testLetter(256)); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("Write after Close = %v, want os.ErrClosed", err)
+	}
+}
+
+func TestFileStoreReopenContinuesIDs(t *testing.T) {
+	config := testConfig(t)
+	store := openTestStore(t, config)
+	write(t, store, testLetter(64), testLetter(128))
+	store.Close()
+
+	store = openTestStore(t, config)
+	write(t, store, testLetter(192))
+	if got, want := ids(t, config.Dir), []uint64{1, 2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("IDs = %v, want %v", got, want)
+	}
+}
+
+func TestFileStoreReopenAfterEmptyNewestFile(t *testing.T) {
+	// A crash right after rotating leaves the newest file empty; numbering
+	// continues from the letters in the file before it
+	config := testConfig(t)
+	store := openTestStore(t, config)
+	write(t, store, testLetter(64), testLetter(128))
+	store.Close()
+	if err := os.WriteFile(filePath(config.Dir, 2), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	store = openTestStore(t, config)
+	write(t, store, testLetter(192))
+	if got, want := ids(t, config.Dir), []uint64{1, 2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("IDs = %v, want %v", got, want)
+	}
+	letters, err := readFile(filePath(config.Dir, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 1 || letters[0].ID != 3 {
+		t.Errorf("newest file holds %+v, want letter 3", letters)
+	}
+}
+
+func TestFileStoreReopenEndsTornLine(t *testing.T) {
+	config := testConfig(t)
+	store := openTestStore(t, config)
+	write(t, store, testLetter(64), testLetter(128))
+	store.Close()
+
+	// A crash in the middle of the third write
+	path := filePath(config.Dir, 1)
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteString(`{"id":3,"time":"2026-01-02T03:04`); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	store = openTestStore(t, config)
+	write(t, store, testLetter(192))
+	if got, want := ids(t, config.Dir), []uint64{1, 2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("IDs = %v, want %v", got, want)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.Split(bytes.TrimSuffix(data, []byte{'\n'}), []byte{'\n'})
+	if len(lines) != 4 {
+		t.Fatalf("file has %d lines, want 2 letters, the torn line and the new letter", len(lines))
+	}
+	if !bytes.HasPrefix(lines[3], []byte(`{"id":3,`)) {
+		t.Errorf("new letter shares a line: %q", lines[3])
+	}
+}
+
+func TestFileStoreRotation(t *testing.T) {
+	config := testConfig(t)
+	config.MaxFileSize = 1 // one letter per file
+	config.MaxFiles = 3
+	store := openTestStore(t, config)
+	for position := int64(1); position <= 5; position++ {
+		write(t, store, testLetter(position))
+	}
+
+	indexes, err := fileIndexes(config.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{3, 4, 5}; !reflect.DeepEqual(indexes, want) {
+		t.Errorf("files %v, want %v", indexes, want)
+	}
+	if got, want := ids(t, config.Dir), []uint64{3, 4, 5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("IDs = %v, want %v", got, want)
+	}
+
+	// Numbering and rotation carry on after a restart
+	store.Close()
+	store = openTestStore(t, config)
+	write(t, store, testLetter(6))
+	if got, want := ids(t, config.Dir), []uint64{4, 5, 6}; !reflect.DeepEqual(got, want) {
+		t.Errorf("IDs after reopen = %v, want %v", got, want)
+	}
+}
+
+func TestFileStoreRotatesBySize(t *testing.T) {
+	config := testConfig(t)
+	store := openTestStore(t, config)
+	write(t, store, testLetter(1))
+	info, err := os.Stat(filePath(config.Dir, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	// Room for two letters per file
+	config.MaxFileSize = 2*info.Size() + 1
+	store = openTestStore(t, config)
+	write(t, store, testLetter(2), testLetter(3))
+
+	for index, want := range map[int]int{1: 2, 2: 1} {
+		letters, err := readFile(filePath(config.Dir, index))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(letters) != want {
+			t.Errorf("file %d holds %d letters, want %d", index, len(letters), want)
+		}
+	}
+}
+
+func TestReadFileSkipsPartialLines(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "letters.jsonl")
+	data := `{"id":1,"stage":"decode"}
+{"id":2,"sta
+not json
+{"id":3,"stage":"handle"}
+{"id":4,"stage":"han`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	letters, err := readFile(path)
+	if err != nil {
+		t.Fatalf("readFile: %v", err)
+	}
+	if len(letters) != 2 || letters[0].ID != 1 || letters[1].ID != 3 {
+		t.Errorf("read %+v, want letters 1 and 3", letters)
+	}
+	if _, err := readFile(filepath.Join(dir, "missing.jsonl")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("readFile of a missing file = %v, want os.ErrNotExist", err)
+	}
+}
+
+func TestListIgnoresOtherFiles(t *testing.T) {
+	config := testConfig(t)
+	store := openTestStore(t, config)
+	write(t, store, testLetter(64))
+	for _, name := range []string{"notes.txt", filePrefix + "x" + fileSuffix, filePrefix + "000002.jsonl.tmp"} {
+		if err := os.WriteFile(filepath.Join(config.Dir, name), []byte(`{"id":99}`+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := ids(t, config.Dir), []uint64{1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("IDs = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// AdminAuth guards destructive endpoints with a shared bearer token
+type AdminAuth struct {
+	token  []byte
+	logger *slog.Logger
+}
+
+// NewAdminAuth creates an admin guard. With an empty token every guarded
+// request is refused.
+func NewAdminAuth(token string, logger *slog.Logger) *AdminAuth {
+	return &AdminAuth{
+		token:  []byte(token),
+		logger: logger.With("handler", "admin-auth"),
+	}
+}
+
+// Require wraps next so it only runs for requests carrying
+// "Authorization: Bearer <token>"
+func (a *AdminAuth) Require(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(a.token) == 0 {
+			http.Error(w, "admin endpoints disabled", http.StatusForbidden)
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), a.token) != 1 {
+			a.logger.Warn("unauthorized admin request", "path", r.URL.Path, "remoteAddr", r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
+	}
+}
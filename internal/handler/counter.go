@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/k-omotani/aeron-sample/internal/counter"
+)
+
+// CounterHandler serves the subscriber's counter state via HTTP API
+type CounterHandler struct {
+	state     *counter.State
+	processor *counter.Processor
+	logger    *slog.Logger
+}
+
+// NewCounterHandler creates a new counter handler
+func NewCounterHandler(state *counter.State, processor *counter.Processor, logger *slog.Logger) *CounterHandler {
+	return &CounterHandler{
+		state:     state,
+		processor: processor,
+		logger:    logger.With("handler", "counter"),
+	}
+}
+
+// CounterResponse is the response for counter queries
+type CounterResponse struct {
+	Name          string              `json:"name"`
+	Value         int64               `json:"value"`
+	TotalEvents   int64               `json:"total_events"`
+	LastUpdatedAt *time.Time          `json:"last_updated_at,omitempty"`
+	LastRequestID string              `json:"last_request_id,omitempty"`
+	Dedup         *counter.DedupStats `json:"dedup,omitempty"`
+}
+
+// CounterListResponse is the response for listing counters
+type CounterListResponse struct {
+	Counters []CounterResponse  `json:"counters"`
+	Dedup    counter.DedupStats `json:"dedup"`
+}
+
+// Get handles GET /api/counter, which reports the default counter
+func (h *CounterHandler) Get(w http.ResponseWriter, r *http.Request) {
+	snapshot, _ := h.state.Get(counter.DefaultName)
+
+	resp := counterResponse(snapshot)
+	dedup := h.processor.DedupStats()
+	resp.Dedup = &dedup
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// GetNamed handles GET /api/counters/{name}.
+// It responds 404 for a counter that has never been updated.
+func (h *CounterHandler) GetNamed(w http.ResponseWriter, r *http.Request) {
+	snapshot, ok := h.state.Get(r.PathValue("name"))
+	if !ok {
+		http.Error(w, "counter not found", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, counterResponse(snapshot))
+}
+
+// List handles GET /api/counters
+func (h *CounterHandler) List(w http.ResponseWriter, r *http.Request) {
+	snapshots := h.state.Snapshots()
+
+	resp := CounterListResponse{
+		Counters: make([]CounterResponse, len(snapshots)),
+		Dedup:    h.processor.DedupStats(),
+	}
+	for i, snapshot := range snapshots {
+		resp.Counters[i] = counterResponse(snapshot)
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func counterResponse(snapshot counter.Snapshot) CounterResponse {
+	resp := CounterResponse{
+		Name:          snapshot.Name,
+		Value:         snapshot.Value,
+		TotalEvents:   snapshot.TotalEvents,
+		LastRequestID: snapshot.LastRequestID,
+	}
+	if !snapshot.LastUpdatedAt.IsZero() {
+		resp.LastUpdatedAt = &snapshot.LastUpdatedAt
+	}
+	return resp
+}
+
+// writeJSON writes v as a JSON response with the given status
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -3,37 +3,204 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
+	"sync"
+	"time"
+
+	"github.com/k-omotani/aeron-sample/internal/aeron"
 )
 
-// HealthHandler handles health check requests
-type HealthHandler struct{}
+// CheckResult is the outcome of one health check
+type CheckResult struct {
+	Ready   bool           `json:"ready"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// Check reports whether one component is healthy
+type Check func() CheckResult
+
+// checkSet is an ordered set of named checks
+type checkSet struct {
+	names  []string
+	checks map[string]Check
+}
+
+func (s *checkSet) add(name string, check Check) {
+	if s.checks == nil {
+		s.checks = make(map[string]Check)
+	}
+	if _, ok := s.checks[name]; !ok {
+		s.names = append(s.names, name)
+	}
+	s.checks[name] = check
+}
+
+// run evaluates every check and reports whether all of them passed
+func (s *checkSet) run() (map[string]CheckResult, bool) {
+	if len(s.names) == 0 {
+		return nil, true
+	}
+	results := make(map[string]CheckResult, len(s.names))
+	ok := true
+	for _, name := range s.names {
+		result := s.checks[name]()
+		results[name] = result
+		ok = ok && result.Ready
+	}
+	return results, ok
+}
+
+// HealthHandler handles health check requests.
+// /health runs the liveness checks and /ready the readiness checks; either
+// responds 503 when one of its checks fails.
+type HealthHandler struct {
+	mu        sync.RWMutex
+	liveness  checkSet
+	readiness checkSet
+}
 
 // NewHealthHandler creates a new health handler
 func NewHealthHandler() *HealthHandler {
 	return &HealthHandler{}
 }
 
+// AddLivenessCheck registers a check reported by /health under name.
+// A failing liveness check means the process should be restarted.
+func (h *HealthHandler) AddLivenessCheck(name string, check Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.liveness.add(name, check)
+}
+
+// AddReadinessCheck registers a check reported by /ready under name.
+// A failing readiness check means the process cannot serve traffic right now.
+func (h *HealthHandler) AddReadinessCheck(name string, check Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.readiness.add(name, check)
+}
+
 // HealthResponse is the response for health checks
 type HealthResponse struct {
-	Status string `json:"status"`
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
 }
 
 // Health handles GET /health
 func (h *HealthHandler) Health(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	checks, ok := h.liveness.run()
+	h.mu.RUnlock()
+
 	resp := HealthResponse{
 		Status: "ok",
+		Checks: checks,
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(resp)
+	if !ok {
+		resp.Status = "unhealthy"
+	}
+	writeHealth(w, resp, ok)
 }
 
 // Ready handles GET /ready
 func (h *HealthHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	checks, ok := h.readiness.run()
+	h.mu.RUnlock()
+
 	resp := HealthResponse{
 		Status: "ready",
+		Checks: checks,
 	}
+	if !ok {
+		resp.Status = "not ready"
+	}
+	writeHealth(w, resp, ok)
+}
 
+func writeHealth(w http.ResponseWriter, resp HealthResponse, ok bool) {
 	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
 	json.NewEncoder(w).Encode(resp)
 }
+
+// ClientCheck fails once the Aeron client has shut down
+func ClientCheck(monitor *aeron.DriverMonitor) Check {
+	return func() CheckResult {
+		closed := monitor.ClientClosed()
+		return CheckResult{
+			Ready:   !closed,
+			Details: map[string]any{"clientClosed": closed},
+		}
+	}
+}
+
+// DriverCheck fails when the media driver heartbeat is older than the
+// driver timeout or the client has shut down. It also reports the driver
+// process and how many distinct errors it has logged.
+func DriverCheck(monitor *aeron.DriverMonitor) Check {
+	return func() CheckResult {
+		cnc := monitor.CnC()
+		return CheckResult{
+			Ready: monitor.Alive(),
+			Details: map[string]any{
+				"heartbeatAgeMs": monitor.HeartbeatAge().Milliseconds(),
+				"timeoutMs":      monitor.Timeout().Milliseconds(),
+				"clientClosed":   monitor.ClientClosed(),
+				"pid":            cnc.PID(),
+				"startedAt":      cnc.StartTime(),
+				"distinctErrors": len(cnc.Errors()),
+			},
+		}
+	}
+}
+
+// PublicationCheck fails while no subscriber is connected to the publication
+func PublicationCheck(publisher *aeron.Publisher) Check {
+	return func() CheckResult {
+		connected := publisher.IsConnected()
+		return CheckResult{
+			Ready:   connected,
+			Details: map[string]any{"connected": connected},
+		}
+	}
+}
+
+// CircuitCheck reports the publisher's circuit breaker; it is not ready
+// while the circuit is open
+func CircuitCheck(publisher *aeron.Publisher) Check {
+	return func() CheckResult {
+		status := publisher.CircuitStatus()
+		details := map[string]any{
+			"state":               status.State.String(),
+			"consecutiveFailures": status.ConsecutiveFailures,
+		}
+		if status.State == aeron.CircuitOpen {
+			details["openedAt"] = status.OpenedAt
+			details["retryAfterMs"] = status.RetryAfter.Milliseconds()
+		}
+		return CheckResult{
+			Ready:   status.State != aeron.CircuitOpen,
+			Details: details,
+		}
+	}
+}
+
+// SubscriptionCheck fails while no publisher image is connected, and
+// reports how long ago the last message arrived
+func SubscriptionCheck(subscriber *aeron.Subscriber) Check {
+	return func() CheckResult {
+		details := map[string]any{
+			"images": subscriber.ImageCount(),
+		}
+		if last := subscriber.LastMessageTime(); !last.IsZero() {
+			details["lastMessageAt"] = last
+			details["lastMessageAgeMs"] = time.Since(last).Milliseconds()
+		}
+		return CheckResult{
+			Ready:   subscriber.HasImages(),
+			Details: details,
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/k-omotani/aeron-sample/internal/metrics"
+)
+
+// HTTPMetrics counts and times the requests served by a ServeMux
+type HTTPMetrics struct {
+	requests *metrics.CounterVec
+	duration *metrics.HistogramVec
+}
+
+// NewHTTPMetrics registers the HTTP request metrics in r
+func NewHTTPMetrics(r *metrics.Registry) *HTTPMetrics {
+	return &HTTPMetrics{
+		requests: r.CounterVec("http_requests_total", "HTTP requests by method, route and status code.", "method", "route", "code"),
+		duration: r.HistogramVec("http_request_duration_seconds", "HTTP request latency by method and route.", nil, "method", "route"),
+	}
+}
+
+// Wrap instruments next. Requests are labelled with the ServeMux pattern
+// they matched rather than the raw path, so path values do not create
+// new series.
+func (m *HTTPMetrics) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		route := "unmatched"
+		if r.Pattern != "" {
+			_, path, found := strings.Cut(r.Pattern, " ")
+			if !found {
+				path = r.Pattern
+			}
+			route = path
+		}
+		m.requests.With(r.Method, route, strconv.Itoa(recorder.status)).Inc()
+		m.duration.With(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// statusRecorder remembers the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
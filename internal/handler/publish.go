@@ -3,50 +3,150 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
+	"math"
 	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 
 	"github.com/k-omotani/aeron-sample/internal/aeron"
+	"github.com/k-omotani/aeron-sample/internal/counter"
 	"github.com/k-omotani/aeron-sample/internal/message"
 )
 
 // PublishHandler handles publishing messages via HTTP API
 type PublishHandler struct {
 	publisher *aeron.Publisher
+	async     *aeron.AsyncPublisher
+	replies   *aeron.ReplyReceiver
+	source    string
 	logger    *slog.Logger
+
+	namesMu     sync.Mutex
+	names       map[string]struct{} // counter names published to
+	maxCounters int
 }
 
-// NewPublishHandler creates a new publish handler
-func NewPublishHandler(publisher *aeron.Publisher, logger *slog.Logger) *PublishHandler {
+// NewPublishHandler creates a new publish handler.
+// async may be nil, in which case ?mode=async requests are published synchronously.
+// replies may be nil, in which case ?wait=applied requests are rejected.
+// source identifies this publisher instance in the messages it sends.
+func NewPublishHandler(publisher *aeron.Publisher, async *aeron.AsyncPublisher, replies *aeron.ReplyReceiver, source string, logger *slog.Logger) *PublishHandler {
 	return &PublishHandler{
 		publisher: publisher,
+		async:     async,
+		replies:   replies,
+		source:    source,
+		names:     make(map[string]struct{}),
 		logger:    logger.With("handler", "publish"),
 	}
 }
 
+// SetMaxCounters limits how many distinct counter names this handler
+// publishes to; requests that would add another are rejected with 422.
+// 0 means no limit. It should match the subscriber's --max-counters and
+// must be called before the handler serves requests.
+func (h *PublishHandler) SetMaxCounters(n int) {
+	h.maxCounters = n
+}
+
 // PublishRequest is the request body for publishing
 type PublishRequest struct {
 	Amount int64 `json:"amount"`
 }
 
-// PublishResponse is the response for publish operations
+// PublishResponse is the response for publish operations.
+// Counter, Value and Error are only set with ?wait=applied.
 type PublishResponse struct {
 	RequestID string `json:"request_id"`
 	Status    string `json:"status"`
+	Counter   string `json:"counter,omitempty"`
+	Value     *int64 `json:"value,omitempty"`
+	Error     string `json:"error,omitempty"`
 }
 
-// Increment handles POST /api/counter/increment
+// WaitApplied is the ?wait= value that waits for the subscriber's reply
+const WaitApplied = "applied"
+
+const (
+	defaultWaitTimeout = 5 * time.Second
+	maxWaitTimeout     = 20 * time.Second
+)
+
+// IdempotencyKeyHeader lets clients retry a request without it being applied twice
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyLength bounds the header value accepted from clients
+const maxIdempotencyKeyLength = 255
+
+// idempotencyNamespace derives request IDs from idempotency keys that are not UUIDs
+var idempotencyNamespace = uuid.MustParse("6f2c4f1e-9a57-4c1b-8d0e-3b7a5e2d9c41")
+
+// requestIDFor returns the request ID for r: the Idempotency-Key header when
+// it is a UUID, a name-based UUID derived from it otherwise, or a new random
+// UUID when the header is absent. The same key always yields the same ID, so
+// the subscriber applies retried requests once.
+func requestIDFor(r *http.Request) (string, error) {
+	key := r.Header.Get(IdempotencyKeyHeader)
+	if key == "" {
+		return uuid.New().String(), nil
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		return "", errors.New("idempotency key too long")
+	}
+	if id, err := uuid.Parse(key); err == nil {
+		return id.String(), nil
+	}
+	return uuid.NewSHA1(idempotencyNamespace, []byte(key)).String(), nil
+}
+
+// counterNamePattern restricts counter names to a single URL path segment
+var counterNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// Increment handles POST /api/counter/increment, which updates the default counter.
+// With ?mode=async the message is queued and 202 is returned once it is enqueued.
+// With ?wait=applied it waits (up to ?timeout=, default 5s) for the subscriber
+// to apply the message and returns the new value, or 504 on timeout.
+// While the publisher's circuit is open it responds 503 with Retry-After at once.
+// Requests that share an Idempotency-Key header are applied once.
 func (h *PublishHandler) Increment(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
-	defer cancel()
+	h.increment(w, r, "", 1)
+}
 
+// IncrementNamed handles POST /api/counters/{name}/increment and behaves
+// like Increment for the named counter
+func (h *PublishHandler) IncrementNamed(w http.ResponseWriter, r *http.Request) {
+	name, ok := counterName(w, r)
+	if !ok {
+		return
+	}
+	h.increment(w, r, name, 1)
+}
+
+// Decrement handles POST /api/counters/{name}/decrement: an increment by
+// the negated amount
+func (h *PublishHandler) Decrement(w http.ResponseWriter, r *http.Request) {
+	name, ok := counterName(w, r)
+	if !ok {
+		return
+	}
+	h.increment(w, r, name, -1)
+}
+
+func (h *PublishHandler) increment(w http.ResponseWriter, r *http.Request, name string, sign int64) {
 	var req PublishRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.logger.Error("failed to decode request", "error", err)
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+	requestID, ok := h.begin(w, r, &req)
+	if !ok {
+		return
+	}
+	if !h.admit(w, name) {
 		return
 	}
 
@@ -54,31 +154,388 @@ func (h *PublishHandler) Increment(w http.ResponseWriter, r *http.Request) {
 		req.Amount = 1 // Default increment
 	}
 
-	requestID := uuid.New().String()
+	msg, err := message.NewIncrementMessage(requestID, name, sign*req.Amount, h.source)
+	if err != nil {
+		h.logger.Error("failed to create message", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	h.submit(w, r, msg, "counter", name, "amount", sign*req.Amount)
+}
+
+// SetRequest is the request body for setting a counter
+type SetRequest struct {
+	Value int64 `json:"value"`
+}
 
-	msg, err := message.NewIncrementMessage(requestID, req.Amount, "http")
+// Set handles POST /api/counters/{name}/set
+func (h *PublishHandler) Set(w http.ResponseWriter, r *http.Request) {
+	name, ok := counterName(w, r)
+	if !ok {
+		return
+	}
+	var req SetRequest
+	requestID, ok := h.begin(w, r, &req)
+	if !ok {
+		return
+	}
+	if !h.admit(w, name) {
+		return
+	}
+
+	msg, err := message.NewSetMessage(requestID, name, req.Value)
+	if err != nil {
+		h.logger.Error("failed to create message", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	h.submit(w, r, msg, "counter", name, "value", req.Value)
+}
+
+// CompareAndSetRequest is the request body for a conditional set
+type CompareAndSetRequest struct {
+	Expected int64 `json:"expected"`
+	Value    int64 `json:"value"`
+}
+
+// CompareAndSet handles POST /api/counters/{name}/compare-and-set.
+// The subscriber applies it only if the counter holds expected at that
+// point in the stream; a rejection is logged and reported to its result
+// listeners.
+func (h *PublishHandler) CompareAndSet(w http.ResponseWriter, r *http.Request) {
+	name, ok := counterName(w, r)
+	if !ok {
+		return
+	}
+	var req CompareAndSetRequest
+	requestID, ok := h.begin(w, r, &req)
+	if !ok {
+		return
+	}
+	if !h.admit(w, name) {
+		return
+	}
+
+	msg, err := message.NewCompareAndSetMessage(requestID, name, req.Expected, req.Value)
 	if err != nil {
 		h.logger.Error("failed to create message", "error", err)
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
 
-	if err := h.publisher.Publish(ctx, msg); err != nil {
-		h.logger.Error("failed to publish message", "error", err)
-		http.Error(w, "failed to publish", http.StatusInternalServerError)
+	h.submit(w, r, msg, "counter", name, "expected", req.Expected, "value", req.Value)
+}
+
+// BoundedIncrementRequest is the request body for an increment clamped to [min, max]
+type BoundedIncrementRequest struct {
+	Amount int64 `json:"amount"`
+	Min    int64 `json:"min"`
+	Max    int64 `json:"max"`
+}
+
+// BoundedIncrement handles POST /api/counters/{name}/bounded-increment
+func (h *PublishHandler) BoundedIncrement(w http.ResponseWriter, r *http.Request) {
+	name, ok := counterName(w, r)
+	if !ok {
+		return
+	}
+	var req BoundedIncrementRequest
+	requestID, ok := h.begin(w, r, &req)
+	if !ok {
+		return
+	}
+	if !h.admit(w, name) {
+		return
+	}
+
+	if req.Amount == 0 {
+		req.Amount = 1 // Default increment
+	}
+
+	msg, err := message.NewBoundedIncrementMessage(requestID, name, req.Amount, req.Min, req.Max, h.source)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	h.logger.Info("increment message published",
-		"requestID", requestID,
-		"amount", req.Amount,
+	h.submit(w, r, msg, "counter", name, "amount", req.Amount, "min", req.Min, "max", req.Max)
+}
+
+// counterName validates the {name} path value, writing 400 if it is invalid
+func counterName(w http.ResponseWriter, r *http.Request) (string, bool) {
+	name := r.PathValue("name")
+	if !counterNamePattern.MatchString(name) {
+		http.Error(w, "invalid counter name", http.StatusBadRequest)
+		return "", false
+	}
+	return name, true
+}
+
+// admit records name as a counter this handler publishes to, writing 422
+// if it is new and the maximum number of counters has been reached
+func (h *PublishHandler) admit(w http.ResponseWriter, name string) bool {
+	if name == "" {
+		name = counter.DefaultName
+	}
+
+	h.namesMu.Lock()
+	defer h.namesMu.Unlock()
+	if _, ok := h.names[name]; ok {
+		return true
+	}
+	if h.maxCounters > 0 && len(h.names) >= h.maxCounters {
+		h.logger.Warn("counter rejected", "counter", name, "maxCounters", h.maxCounters)
+		http.Error(w, counter.ErrTooManyCounters.Error(), http.StatusUnprocessableEntity)
+		return false
+	}
+	h.names[name] = struct{}{}
+	return true
+}
+
+// begin rejects the request while the circuit is open, decodes the JSON
+// body into req, and returns the request ID. It writes the error response
+// and returns false if any step fails.
+func (h *PublishHandler) begin(w http.ResponseWriter, r *http.Request, req any) (string, bool) {
+	if err := h.publisher.CheckCircuit(); err != nil {
+		h.unavailable(w, err)
+		return "", false
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		h.logger.Error("failed to decode request", "error", err)
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return "", false
+	}
+
+	requestID, err := requestIDFor(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", false
+	}
+	return requestID, true
+}
+
+// submit publishes msg, or queues it with ?mode=async, and writes the
+// response. attrs are added to the log entry.
+func (h *PublishHandler) submit(w http.ResponseWriter, r *http.Request, msg *message.Message, attrs ...any) {
+	query := r.URL.Query()
+	async := query.Get("mode") == "async" && h.async != nil
+
+	var replies <-chan *message.ReplyPayload
+	var timeout time.Duration
+	if wait := query.Get("wait"); wait != "" {
+		var err error
+		if timeout, err = h.waitTimeout(wait, query.Get("timeout"), async); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var cancel func()
+		replies, cancel = h.replies.Expect(msg.RequestID)
+		defer cancel()
+		msg.ReplyChannel, msg.ReplyStreamID = h.replies.Channel()
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if async {
+		h.enqueue(ctx, w, msg)
+		return
+	}
+
+	if !h.publish(ctx, w, msg) {
+		return
+	}
+
+	h.logger.Info(msg.Type.String()+" message published",
+		append([]any{"requestID", msg.RequestID}, attrs...)...,
 	)
 
+	if replies != nil {
+		h.await(w, r, msg.RequestID, replies, timeout)
+		return
+	}
+
 	resp := PublishResponse{
-		RequestID: requestID,
+		RequestID: msg.RequestID,
 		Status:    "published",
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
+
+// waitTimeout validates the ?wait= and ?timeout= parameters
+func (h *PublishHandler) waitTimeout(wait, timeout string, async bool) (time.Duration, error) {
+	switch {
+	case wait != WaitApplied:
+		return 0, fmt.Errorf("unsupported wait %q", wait)
+	case async:
+		return 0, errors.New("wait cannot be combined with mode=async")
+	case h.replies == nil:
+		return 0, errors.New("replies are not enabled on this publisher")
+	case timeout == "":
+		return defaultWaitTimeout, nil
+	}
+	d, err := time.ParseDuration(timeout)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid timeout %q", timeout)
+	}
+	return min(d, maxWaitTimeout), nil
+}
+
+// await writes the subscriber's reply to requestID, or 504 if none arrives
+// within timeout
+func (h *PublishHandler) await(w http.ResponseWriter, r *http.Request, requestID string, replies <-chan *message.ReplyPayload, timeout time.Duration) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	resp := PublishResponse{RequestID: requestID}
+	select {
+	case reply := <-replies:
+		resp.Status = reply.Status
+		resp.Counter = reply.Counter
+		// A duplicate reset has no counter whose value could be reported
+		if reply.Counter != "" || reply.Status != "duplicate" {
+			resp.Value = &reply.Value
+		}
+		resp.Error = reply.Error
+		writeJSON(w, replyStatus(reply.Status), resp)
+	case <-timer.C:
+		h.logger.Warn("timed out waiting for reply", "requestID", requestID, "timeout", timeout)
+		resp.Status = "timeout"
+		writeJSON(w, http.StatusGatewayTimeout, resp)
+	case <-r.Context().Done():
+	}
+}
+
+// replyStatus maps a reply status to an HTTP status code
+func replyStatus(status string) int {
+	switch status {
+	case "rejected":
+		return http.StatusConflict
+	case "failed":
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusOK
+	}
+}
+
+// ResetRequest is the request body for resetting the counters
+type ResetRequest struct {
+	Reason      string `json:"reason"`
+	RequestedBy string `json:"requested_by"`
+}
+
+// Reset handles POST /api/counter/reset, which resets every counter.
+// The body is optional; requested_by defaults to the client address.
+func (h *PublishHandler) Reset(w http.ResponseWriter, r *http.Request) {
+	if err := h.publisher.CheckCircuit(); err != nil {
+		h.unavailable(w, err)
+		return
+	}
+
+	var req ResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		h.logger.Error("failed to decode request", "error", err)
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.RequestedBy == "" {
+		req.RequestedBy = r.RemoteAddr
+	}
+
+	requestID, err := requestIDFor(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	msg, err := message.NewResetMessage(requestID, req.Reason, req.RequestedBy)
+	if err != nil {
+		h.logger.Error("failed to create message", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	h.submit(w, r, msg, "reason", req.Reason, "requestedBy", req.RequestedBy)
+}
+
+// publish sends msg synchronously and writes the error response if it fails
+func (h *PublishHandler) publish(ctx context.Context, w http.ResponseWriter, msg *message.Message) bool {
+	err := h.publisher.Publish(ctx, msg)
+	if err == nil {
+		return true
+	}
+	if errors.Is(err, aeron.ErrCircuitOpen) {
+		h.unavailable(w, err)
+		return false
+	}
+	h.logger.Error("failed to publish message", "error", err, "requestID", msg.RequestID)
+	http.Error(w, "failed to publish", publishErrorStatus(err))
+	return false
+}
+
+// enqueue hands msg to the async publisher and responds 202 Accepted
+func (h *PublishHandler) enqueue(ctx context.Context, w http.ResponseWriter, msg *message.Message) {
+	requestID := msg.RequestID
+	future, err := h.async.PublishAsync(ctx, msg, func(err error) {
+		if err != nil {
+			h.logger.Error("async publish failed", "requestID", requestID, "error", err)
+			return
+		}
+		h.logger.Debug("async message published", "requestID", requestID)
+	})
+	if err == nil {
+		select {
+		case <-future.Done():
+			// Only an overflow drop completes the future this early
+			err = future.Err()
+		default:
+		}
+	}
+	if err != nil {
+		h.logger.Warn("failed to enqueue message", "requestID", requestID, "error", err)
+		http.Error(w, "publish queue unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	h.logger.Info(msg.Type.String()+" message enqueued", "requestID", requestID)
+
+	resp := PublishResponse{
+		RequestID: requestID,
+		Status:    "accepted",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// unavailable responds 503 to a request rejected by the circuit breaker
+func (h *PublishHandler) unavailable(w http.ResponseWriter, err error) {
+	retryAfter := time.Second
+	var openErr *aeron.CircuitOpenError
+	if errors.As(err, &openErr) && openErr.RetryAfter > retryAfter {
+		retryAfter = openErr.RetryAfter
+	}
+
+	h.logger.Warn("publish rejected", "error", err)
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	http.Error(w, "publisher unavailable", http.StatusServiceUnavailable)
+}
+
+// publishErrorStatus maps a publish error to an HTTP status code
+func publishErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, aeron.ErrNotConnected), errors.Is(err, aeron.ErrBackPressured):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
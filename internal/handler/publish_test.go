@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/k-omotani/aeron-sample/internal/message"
+)
+
+func TestPublishAwaitReply(t *testing.T) {
+	tests := []struct {
+		name   string
+		reply  message.ReplyPayload
+		code   int
+		fields map[string]any
+	}{
+		{
+			name:   "applied",
+			reply:  message.ReplyPayload{Status: "applied", Counter: "page-views", Value: 53},
+			code:   http.StatusOK,
+			fields: map[string]any{"status": "applied", "counter": "page-views", "value": 53.0},
+		},
+		{
+			name:   "duplicate increment",
+			reply:  message.ReplyPayload{Status: "duplicate", Counter: "page-views", Value: 53},
+			code:   http.StatusOK,
+			fields: map[string]any{"status": "duplicate", "counter": "page-views", "value": 53.0},
+		},
+		{
+			name:   "duplicate reset",
+			reply:  message.ReplyPayload{Status: "duplicate"},
+			code:   http.StatusOK,
+			fields: map[string]any{"status": "duplicate"},
+		},
+		{
+			name:   "rejected",
+			reply:  message.ReplyPayload{Status: "rejected", Counter: "stock", Value: 0},
+			code:   http.StatusConflict,
+			fields: map[string]any{"status": "rejected", "counter": "stock", "value": 0.0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &PublishHandler{logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+			replies := make(chan *message.ReplyPayload, 1)
+			replies <- &tt.reply
+
+			w := httptest.NewRecorder()
+			h.await(w, httptest.NewRequest(http.MethodPost, "/", nil), "req-1", replies, time.Second)
+
+			if w.Code != tt.code {
+				t.Errorf("status code = %d, want %d", w.Code, tt.code)
+			}
+			var body map[string]any
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decoding %q: %v", w.Body, err)
+			}
+			delete(body, "request_id")
+			if len(body) != len(tt.fields) {
+				t.Errorf("body = %v, want %v", body, tt.fields)
+			}
+			for k, v := range tt.fields {
+				if body[k] != v {
+					t.Errorf("%s = %v, want %v", k, body[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestPublishAdmitCounters(t *testing.T) {
+	h := NewPublishHandler(nil, nil, nil, "test", slog.New(slog.NewTextHandler(io.Discard, nil)))
+	h.SetMaxCounters(2)
+
+	for _, tt := range []struct {
+		name string
+		want bool
+	}{
+		{"page-views", true},
+		{"", true}, // the default counter
+		{"stock", false},
+		{"page-views", true},
+		{"default", true},
+	} {
+		w := httptest.NewRecorder()
+		if got := h.admit(w, tt.name); got != tt.want {
+			t.Errorf("admit(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+		if !tt.want && w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("admit(%q) status code = %d, want %d", tt.name, w.Code, http.StatusUnprocessableEntity)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/k-omotani/aeron-sample/internal/aeron"
+)
+
+// PublishersHandler lists the publishers connected to the subscriber and
+// the gaps detected in their streams
+type PublishersHandler struct {
+	subscriber *aeron.Subscriber
+	logger     *slog.Logger
+}
+
+// PublisherListResponse is the response of GET /api/publishers
+type PublisherListResponse struct {
+	Publishers []aeron.PublisherInfo `json:"publishers"`
+	Stats      aeron.ImageStats      `json:"stats"`
+}
+
+// NewPublishersHandler creates a new publishers handler
+func NewPublishersHandler(subscriber *aeron.Subscriber, logger *slog.Logger) *PublishersHandler {
+	return &PublishersHandler{
+		subscriber: subscriber,
+		logger:     logger.With("handler", "publishers"),
+	}
+}
+
+// List handles GET /api/publishers
+func (h *PublishersHandler) List(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, PublisherListResponse{
+		Publishers: h.subscriber.Publishers(),
+		Stats:      h.subscriber.ImageStats(),
+	})
+}
+
+// Gaps handles GET /api/gaps
+func (h *PublishersHandler) Gaps(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.subscriber.GapStats())
+}
@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/k-omotani/aeron-sample/internal/counter"
+)
+
+// StatsHandler serves per-source and per-session statistics via HTTP API
+type StatsHandler struct {
+	stats  *counter.Stats
+	logger *slog.Logger
+}
+
+// NewStatsHandler creates a new stats handler
+func NewStatsHandler(stats *counter.Stats, logger *slog.Logger) *StatsHandler {
+	return &StatsHandler{
+		stats:  stats,
+		logger: logger.With("handler", "stats"),
+	}
+}
+
+// Get handles GET /api/stats
+func (h *StatsHandler) Get(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.stats.Snapshot())
+}
+
+// GetSource handles GET /api/stats/sources/{source}.
+// It responds 404 for a source that has not been seen.
+func (h *StatsHandler) GetSource(w http.ResponseWriter, r *http.Request) {
+	stats, ok := h.stats.Source(r.PathValue("source"))
+	if !ok {
+		http.Error(w, "source not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/k-omotani/aeron-sample/internal/counter"
+)
+
+// WindowHandler serves time-windowed counts via HTTP API
+type WindowHandler struct {
+	windows *counter.WindowAggregator
+	logger  *slog.Logger
+}
+
+// WindowListResponse lists the available window sizes
+type WindowListResponse struct {
+	Sizes     []string  `json:"sizes"`
+	Watermark time.Time `json:"watermark"`
+}
+
+// NewWindowHandler creates a new window handler
+func NewWindowHandler(windows *counter.WindowAggregator, logger *slog.Logger) *WindowHandler {
+	return &WindowHandler{
+		windows: windows,
+		logger:  logger.With("handler", "window"),
+	}
+}
+
+// List handles GET /api/windows
+func (h *WindowHandler) List(w http.ResponseWriter, r *http.Request) {
+	resp := WindowListResponse{Watermark: h.windows.Watermark()}
+	for _, size := range h.windows.Sizes() {
+		resp.Sizes = append(resp.Sizes, size.String())
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// Get handles GET /api/windows/{size}, e.g. /api/windows/1m?limit=10.
+// limit bounds the closed windows returned, newest last.
+func (h *WindowHandler) Get(w http.ResponseWriter, r *http.Request) {
+	size, ok := windowSize(w, r)
+	if !ok {
+		return
+	}
+	limit := 0
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	series, err := h.windows.Series(size, limit)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, series)
+}
+
+// Sliding handles GET /api/windows/{size}/sliding?length=5m, summing the
+// closed windows of size that cover the last length of event time
+func (h *WindowHandler) Sliding(w http.ResponseWriter, r *http.Request) {
+	size, ok := windowSize(w, r)
+	if !ok {
+		return
+	}
+	length, err := time.ParseDuration(r.URL.Query().Get("length"))
+	if err != nil {
+		http.Error(w, "invalid length", http.StatusBadRequest)
+		return
+	}
+
+	sliding, err := h.windows.Sliding(size, length)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, sliding)
+}
+
+func (h *WindowHandler) writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, counter.ErrUnknownWindowSize):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, counter.ErrInvalidLength):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		h.logger.Error("failed to query windows", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}
+}
+
+// windowSize parses the {size} path value as a duration, writing 400 if invalid
+func windowSize(w http.ResponseWriter, r *http.Request) (time.Duration, bool) {
+	size, err := time.ParseDuration(r.PathValue("size"))
+	if err != nil || size <= 0 {
+		http.Error(w, "invalid window size", http.StatusBadRequest)
+		return 0, false
+	}
+	return size, true
+}
@@ -0,0 +1,101 @@
+package message
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/lirm/aeron-go/aeron/atomic"
+)
+
+var ErrMalformedBatch = errors.New("malformed batch frame")
+
+// BatchFrameID marks a frame that packs several frames together. It shares
+// the first byte with codec IDs, so no codec may be registered under it.
+const BatchFrameID CodecID = 0xFE
+
+// Batch frame layout (little-endian):
+//
+//	0  uint8   BatchFrameID
+//	1  uint16  frame count
+//	3  repeated: int32 frame length, then the frame (codec ID + body)
+const (
+	batchCountOffset  int32 = 1
+	batchHeaderLength int32 = 3
+	batchEntryHeader  int32 = 4
+)
+
+// Marshal encodes msg as a standalone frame: codec ID followed by the codec body
+func Marshal(codec Codec, msg *Message) ([]byte, error) {
+	if enc, ok := codec.(BufferEncoder); ok {
+		frame := make([]byte, FrameHeaderLength+enc.EncodedLength(msg))
+		frame[0] = byte(codec.ID())
+		if _, err := enc.EncodeTo(atomic.MakeBuffer(frame), FrameHeaderLength, msg); err != nil {
+			return nil, err
+		}
+		return frame, nil
+	}
+
+	body, err := codec.Encode(msg)
+	if err != nil {
+		return nil, err
+	}
+	frame := make([]byte, int(FrameHeaderLength)+len(body))
+	frame[0] = byte(codec.ID())
+	copy(frame[FrameHeaderLength:], body)
+	return frame, nil
+}
+
+// BatchLength returns the size of a batch frame holding frames of the given lengths
+func BatchLength(frameLengths ...int) int32 {
+	length := batchHeaderLength
+	for _, n := range frameLengths {
+		length += batchEntryHeader + int32(n)
+	}
+	return length
+}
+
+// BatchEntryLength is the number of bytes a frame of length n adds to a batch
+func BatchEntryLength(n int) int32 {
+	return batchEntryHeader + int32(n)
+}
+
+// AppendBatch packs frames (as produced by Marshal) into a single batch frame
+func AppendBatch(dst []byte, frames ...[]byte) []byte {
+	dst = append(dst, byte(BatchFrameID))
+	dst = binary.LittleEndian.AppendUint16(dst, uint16(len(frames)))
+	for _, frame := range frames {
+		dst = binary.LittleEndian.AppendUint32(dst, uint32(len(frame)))
+		dst = append(dst, frame...)
+	}
+	return dst
+}
+
+// IsBatch reports whether the frame at offset is a batch frame
+func IsBatch(buffer *atomic.Buffer, offset, length int32) bool {
+	return length >= batchHeaderLength && CodecID(buffer.GetUInt8(offset)) == BatchFrameID
+}
+
+// ForEachBatchFrame calls fn with the bounds of every frame inside a batch
+// frame. It validates each entry against the batch length before calling fn.
+func ForEachBatchFrame(buffer *atomic.Buffer, offset, length int32, fn func(offset, length int32)) error {
+	if !IsBatch(buffer, offset, length) {
+		return ErrMalformedBatch
+	}
+
+	limit := offset + length
+	count := int(buffer.GetUInt16(offset + batchCountOffset))
+	pos := offset + batchHeaderLength
+	for i := 0; i < count; i++ {
+		if pos+batchEntryHeader > limit {
+			return ErrMalformedBatch
+		}
+		frameLength := buffer.GetInt32(pos)
+		pos += batchEntryHeader
+		if frameLength < 0 || pos+frameLength > limit {
+			return ErrMalformedBatch
+		}
+		fn(pos, frameLength)
+		pos += frameLength
+	}
+	return nil
+}
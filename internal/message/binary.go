@@ -0,0 +1,289 @@
+package message
+
+import (
+	"errors"
+	"math"
+
+	"github.com/google/uuid"
+	"github.com/lirm/aeron-go/aeron/atomic"
+)
+
+var (
+	ErrShortBuffer         = errors.New("buffer too short for message")
+	ErrUnsupportedVersion  = errors.New("unsupported binary message version")
+	ErrInvalidRequestID    = errors.New("request ID is not a UUID")
+	ErrPayloadLengthExceed = errors.New("payload length exceeds message length")
+)
+
+// BinaryVersion is the version of the binary envelope layout written by this package.
+// Version 1 envelopes, which have no reply fields, and version 2 envelopes,
+// which have no sequence number, are still decoded.
+const BinaryVersion uint8 = 3
+
+// Binary envelope layout (little-endian):
+//
+//	0   uint8     type
+//	1   uint8     version
+//	2   uint16    reserved
+//	4   int32     payload length
+//	8   int64     timestamp (unix nanos)
+//	16  [16]byte  request ID (UUID, zero when empty)
+//	32  uint64    sequence                   (version 3)
+//	40  int32     reply stream ID            (version 2 at 32)
+//	44  string    reply channel              (version 2 at 36, uint16 length + bytes)
+//	    payload block
+const (
+	binaryTypeOffset          int32 = 0
+	binaryVersionOffset       int32 = 1
+	binaryReservedOffset      int32 = 2
+	binaryPayloadLengthOffset int32 = 4
+	binaryTimestampOffset     int32 = 8
+	binaryRequestIDOffset     int32 = 16
+	binaryRequestIDLength     int32 = 16
+	binarySequenceOffset      int32 = 32
+	binaryReplyStreamIDOffset int32 = 40
+	binaryReplyChannelOffset  int32 = 44
+
+	// version 2 had no sequence number
+	binaryV2ReplyStreamIDOffset int32 = 32
+	binaryV2ReplyChannelOffset  int32 = 36
+
+	// BinaryHeaderLength is the size of the fixed part of the binary
+	// envelope header, which is all of a version 1 header
+	BinaryHeaderLength int32 = 32
+)
+
+// binaryCodec is the fixed-layout codec. It encodes straight into Aeron
+// buffers and decodes in place from the fragment buffer.
+type binaryCodec struct{}
+
+// NewBinaryCodec creates the fixed-layout binary codec
+func NewBinaryCodec() Codec {
+	return binaryCodec{}
+}
+
+func (binaryCodec) ID() CodecID  { return CodecIDBinary }
+func (binaryCodec) Name() string { return "binary" }
+
+func (binaryCodec) Encode(msg *Message) ([]byte, error) {
+	data := make([]byte, binaryLength(msg))
+	if _, err := encodeBinary(atomic.MakeBuffer(data), 0, msg); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (binaryCodec) Decode(buffer *atomic.Buffer, offset, length int32) (*Message, error) {
+	return decodeBinary(buffer, offset, length)
+}
+
+func (binaryCodec) EncodedLength(msg *Message) int32 {
+	return binaryLength(msg)
+}
+
+func (binaryCodec) EncodeTo(buffer *atomic.Buffer, offset int32, msg *Message) (int32, error) {
+	return encodeBinary(buffer, offset, msg)
+}
+
+// binaryLength returns the number of bytes encodeBinary writes for msg
+func binaryLength(msg *Message) int32 {
+	length := binaryHeaderLength(msg)
+	if msg.Payload != nil {
+		length += msg.Payload.binaryLength()
+	}
+	return length
+}
+
+// binaryHeaderLength returns the size of the envelope header for msg,
+// including its reply channel
+func binaryHeaderLength(msg *Message) int32 {
+	return binaryReplyChannelOffset + stringLength(msg.ReplyChannel)
+}
+
+// encodeBinary writes msg into buffer at offset. The caller must ensure the
+// buffer has at least binaryLength(msg) bytes available from offset.
+func encodeBinary(buffer *atomic.Buffer, offset int32, msg *Message) (int32, error) {
+	var requestID uuid.UUID
+	if msg.RequestID != "" {
+		parsed, err := uuid.Parse(msg.RequestID)
+		if err != nil {
+			return 0, ErrInvalidRequestID
+		}
+		requestID = parsed
+	}
+
+	var payloadLength int32
+	if msg.Payload != nil {
+		payloadLength = msg.Payload.binaryLength()
+	}
+
+	buffer.PutUInt8(offset+binaryTypeOffset, uint8(msg.Type))
+	buffer.PutUInt8(offset+binaryVersionOffset, BinaryVersion)
+	buffer.PutUInt16(offset+binaryReservedOffset, 0)
+	buffer.PutInt32(offset+binaryPayloadLengthOffset, payloadLength)
+	buffer.PutInt64(offset+binaryTimestampOffset, msg.Timestamp)
+	for i, b := range requestID {
+		buffer.PutUInt8(offset+binaryRequestIDOffset+int32(i), b)
+	}
+	buffer.PutInt64(offset+binarySequenceOffset, int64(msg.Sequence))
+	buffer.PutInt32(offset+binaryReplyStreamIDOffset, msg.ReplyStreamID)
+	putString(buffer, offset+binaryReplyChannelOffset, msg.ReplyChannel)
+
+	headerLength := binaryHeaderLength(msg)
+	if msg.Payload != nil {
+		msg.Payload.putBinary(buffer, offset+headerLength)
+	}
+
+	return headerLength + payloadLength, nil
+}
+
+// decodeBinary reads a message directly from buffer[offset:offset+length]
+// without copying the frame first.
+func decodeBinary(buffer *atomic.Buffer, offset, length int32) (*Message, error) {
+	if length < BinaryHeaderLength || offset+length > buffer.Capacity() {
+		return nil, ErrShortBuffer
+	}
+
+	msg := &Message{
+		Type:      MessageType(buffer.GetUInt8(offset + binaryTypeOffset)),
+		Timestamp: buffer.GetInt64(offset + binaryTimestampOffset),
+	}
+
+	headerLength := BinaryHeaderLength
+	switch buffer.GetUInt8(offset + binaryVersionOffset) {
+	case 1:
+	case 2:
+		end, err := decodeBinaryReply(msg, buffer, offset, length, binaryV2ReplyStreamIDOffset, binaryV2ReplyChannelOffset)
+		if err != nil {
+			return nil, err
+		}
+		headerLength = end - offset
+	case 3:
+		end, err := decodeBinaryReply(msg, buffer, offset, length, binaryReplyStreamIDOffset, binaryReplyChannelOffset)
+		if err != nil {
+			return nil, err
+		}
+		msg.Sequence = uint64(buffer.GetInt64(offset + binarySequenceOffset))
+		headerLength = end - offset
+	default:
+		return nil, ErrUnsupportedVersion
+	}
+
+	payloadLength := buffer.GetInt32(offset + binaryPayloadLengthOffset)
+	if payloadLength < 0 || payloadLength > length-headerLength {
+		return nil, ErrPayloadLengthExceed
+	}
+
+	var requestID uuid.UUID
+	buffer.GetBytes(offset+binaryRequestIDOffset, requestID[:])
+	if requestID != uuid.Nil {
+		msg.RequestID = requestID.String()
+	}
+
+	if payload := newPayload(msg.Type); payload != nil {
+		if err := payload.getBinary(buffer, offset+headerLength, payloadLength); err != nil {
+			return nil, err
+		}
+		msg.Payload = payload
+	}
+
+	return msg, nil
+}
+
+// decodeBinaryReply reads the reply fields of a version 2 or 3 header into
+// msg and returns the offset just after the header
+func decodeBinaryReply(msg *Message, buffer *atomic.Buffer, offset, length, streamIDOffset, channelOffset int32) (int32, error) {
+	if length < channelOffset {
+		return 0, ErrShortBuffer
+	}
+	msg.ReplyStreamID = buffer.GetInt32(offset + streamIDOffset)
+	channel, end, err := getString(buffer, offset+channelOffset, offset+length)
+	if err != nil {
+		return 0, err
+	}
+	msg.ReplyChannel = channel
+	return end, nil
+}
+
+// clampString truncates s to what a uint16 length prefix can describe
+func clampString(s string) string {
+	if len(s) > math.MaxUint16 {
+		return s[:math.MaxUint16]
+	}
+	return s
+}
+
+// payloadBytes encodes a payload block on its own, for codecs that embed
+// the binary payload layout as an opaque field.
+func payloadBytes(payload Payload) []byte {
+	if payload == nil {
+		return nil
+	}
+	length := payload.binaryLength()
+	if length == 0 {
+		return []byte{}
+	}
+	data := make([]byte, length)
+	payload.putBinary(atomic.MakeBuffer(data), 0)
+	return data
+}
+
+// decodePayloadBytes is the inverse of payloadBytes
+func decodePayloadBytes(t MessageType, data []byte) (Payload, error) {
+	payload := newPayload(t)
+	if payload == nil {
+		return nil, nil
+	}
+	length := int32(len(data))
+	if length == 0 {
+		// atomic.MakeBuffer cannot wrap an empty slice
+		data = []byte{0}
+	}
+	if err := payload.getBinary(atomic.MakeBuffer(data), 0, length); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// stringLength returns the encoded size of s: a uint16 length prefix plus the bytes
+func stringLength(s string) int32 {
+	return 2 + int32(len(clampString(s)))
+}
+
+// putStringCopyThreshold is the length above which putString copies through
+// a temporary slice instead of writing byte by byte
+const putStringCopyThreshold = 64
+
+func putString(buffer *atomic.Buffer, offset int32, s string) {
+	s = clampString(s)
+	buffer.PutUInt16(offset, uint16(len(s)))
+	offset += 2
+	if len(s) > putStringCopyThreshold {
+		b := []byte(s)
+		buffer.PutBytesArray(offset, &b, 0, int32(len(b)))
+		return
+	}
+	// Short strings are written in place so encoding allocates nothing
+	for i := 0; i < len(s); i++ {
+		buffer.PutUInt8(offset+int32(i), s[i])
+	}
+}
+
+// getString reads a length-prefixed string starting at offset, never reading
+// past limit. It returns the string and the offset just after it.
+func getString(buffer *atomic.Buffer, offset, limit int32) (string, int32, error) {
+	if offset+2 > limit {
+		return "", offset, ErrShortBuffer
+	}
+	n := int32(buffer.GetUInt16(offset))
+	offset += 2
+	if offset+n > limit {
+		return "", offset, ErrShortBuffer
+	}
+	if n == 0 {
+		return "", offset, nil
+	}
+	b := make([]byte, n)
+	buffer.GetBytes(offset, b)
+	return string(b), offset + n, nil
+}
@@ -0,0 +1,139 @@
+package message
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/lirm/aeron-go/aeron/atomic"
+)
+
+func TestBinaryTruncatedBodies(t *testing.T) {
+	for name, msg := range testMessages() {
+		t.Run(name, func(t *testing.T) {
+			truncatedBodiesFail(t, NewBinaryCodec(), msg)
+		})
+	}
+}
+
+// oldBinaryFrame hand-writes a version 1 or 2 envelope for msg
+func oldBinaryFrame(t *testing.T, version uint8, msg *Message) []byte {
+	t.Helper()
+	payload := payloadBytes(msg.Payload)
+	header := BinaryHeaderLength
+	if version == 2 {
+		header = binaryV2ReplyChannelOffset + stringLength(msg.ReplyChannel)
+	}
+	data := make([]byte, header+int32(len(payload)))
+	buffer := atomic.MakeBuffer(data)
+
+	buffer.PutUInt8(binaryTypeOffset, uint8(msg.Type))
+	buffer.PutUInt8(binaryVersionOffset, version)
+	buffer.PutInt32(binaryPayloadLengthOffset, int32(len(payload)))
+	buffer.PutInt64(binaryTimestampOffset, msg.Timestamp)
+	id := uuid.MustParse(msg.RequestID)
+	copy(data[binaryRequestIDOffset:], id[:])
+	if version == 2 {
+		buffer.PutInt32(binaryV2ReplyStreamIDOffset, msg.ReplyStreamID)
+		putString(buffer, binaryV2ReplyChannelOffset, msg.ReplyChannel)
+	}
+	copy(data[header:], payload)
+	return data
+}
+
+func TestBinaryDecodeOldVersions(t *testing.T) {
+	msg := testMessages()["increment"]
+
+	tests := []struct {
+		name    string
+		version uint8
+		want    func(m Message) Message
+	}{
+		{"version 1", 1, func(m Message) Message {
+			m.Sequence, m.ReplyChannel, m.ReplyStreamID = 0, "", 0
+			return m
+		}},
+		{"version 2", 2, func(m Message) Message {
+			m.Sequence = 0
+			return m
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := oldBinaryFrame(t, tt.version, msg)
+			got, err := NewBinaryCodec().Decode(atomic.MakeBuffer(data), 0, int32(len(data)))
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			want := tt.want(*msg)
+			if !reflect.DeepEqual(*got, want) {
+				t.Errorf("decoded %+v, want %+v", *got, want)
+			}
+		})
+	}
+}
+
+func TestBinaryDecodeRejects(t *testing.T) {
+	valid, err := NewBinaryCodec().Encode(testMessages()["set"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupt := func(fn func(b *atomic.Buffer)) []byte {
+		data := append([]byte(nil), valid...)
+		fn(atomic.MakeBuffer(data))
+		return data
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"unsupported version", corrupt(func(b *atomic.Buffer) { b.PutUInt8(binaryVersionOffset, 9) }), ErrUnsupportedVersion},
+		{"negative payload length", corrupt(func(b *atomic.Buffer) { b.PutInt32(binaryPayloadLengthOffset, -1) }), ErrPayloadLengthExceed},
+		{"payload past frame", corrupt(func(b *atomic.Buffer) { b.PutInt32(binaryPayloadLengthOffset, 1<<20) }), ErrPayloadLengthExceed},
+		{"reply channel past frame", corrupt(func(b *atomic.Buffer) { b.PutUInt16(binaryReplyChannelOffset, 0xffff) }), ErrShortBuffer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewBinaryCodec().Decode(atomic.MakeBuffer(tt.data), 0, int32(len(tt.data)))
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Decode = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestBinaryEncodeRejectsNonUUIDRequestID(t *testing.T) {
+	msg := *testMessages()["set"]
+	msg.RequestID = "not-a-uuid"
+	if _, err := NewBinaryCodec().Encode(&msg); !errors.Is(err, ErrInvalidRequestID) {
+		t.Errorf("Encode = %v, want ErrInvalidRequestID", err)
+	}
+}
+
+func TestBinaryEncodeToMatchesEncode(t *testing.T) {
+	codec := NewBinaryCodec()
+	enc := codec.(BufferEncoder)
+	for name, msg := range testMessages() {
+		t.Run(name, func(t *testing.T) {
+			want, err := codec.Encode(msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := enc.EncodedLength(msg); n != int32(len(want)) {
+				t.Fatalf("EncodedLength = %d, want %d", n, len(want))
+			}
+			// Encode in place at an offset, as into a claimed buffer
+			data := make([]byte, 16+len(want))
+			n, err := enc.EncodeTo(atomic.MakeBuffer(data), 16, msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(data[16:16+n], want) {
+				t.Errorf("EncodeTo wrote %x, want %x", data[16:16+n], want)
+			}
+		})
+	}
+}
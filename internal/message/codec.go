@@ -1,42 +1,202 @@
 package message
 
 import (
-	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
 
 	"github.com/lirm/aeron-go/aeron/atomic"
 )
 
-// Codec handles message serialization for Aeron
-type Codec struct{}
+var (
+	ErrEmptyFrame     = errors.New("empty frame")
+	ErrUnknownCodec   = errors.New("unknown codec")
+	ErrCodecMismatch  = errors.New("frame codec does not match configured codec")
+	ErrDuplicateCodec = errors.New("codec already registered")
+)
+
+// CodecID identifies the codec of a frame. It is written as the first byte
+// of every frame so subscribers can pick the decoder per message.
+type CodecID uint8
+
+const (
+	CodecIDJSON     CodecID = 1
+	CodecIDBinary   CodecID = 2
+	CodecIDMsgPack  CodecID = 3
+	CodecIDProtobuf CodecID = 4
+
+	// legacyJSONMarker is the first byte of frames written before codec IDs
+	// existed: a bare JSON envelope always starts with '{'.
+	legacyJSONMarker = '{'
+)
+
+// FrameHeaderLength is the number of bytes in front of the codec body
+const FrameHeaderLength int32 = 1
+
+// MaxSequenceGrowth is the most a frame of any codec grows by when a
+// message with a nonzero Sequence is renumbered: a one-digit JSON
+// sequence that becomes twenty digits wide.
+const MaxSequenceGrowth int32 = 19
 
-// NewCodec creates a new Codec instance
-func NewCodec() *Codec {
-	return &Codec{}
+// Codec encodes and decodes the body of a frame.
+// The codec ID prefix is handled by ToBuffer and Registry.Decode, not by
+// the codec itself.
+type Codec interface {
+	// ID returns the one-byte identifier written in front of every frame
+	ID() CodecID
+	// Name returns the name used in configuration and flags
+	Name() string
+	// Encode serializes a Message to bytes
+	Encode(msg *Message) ([]byte, error)
+	// Decode deserializes a Message from buffer[offset:offset+length]
+	Decode(buffer *atomic.Buffer, offset, length int32) (*Message, error)
 }
 
-// Encode serializes a Message to bytes for Aeron
-func (c *Codec) Encode(msg *Message) ([]byte, error) {
-	return json.Marshal(msg)
+// BufferEncoder is implemented by codecs that can write straight into an
+// Aeron buffer without an intermediate []byte.
+type BufferEncoder interface {
+	// EncodedLength returns the number of bytes EncodeTo writes for msg
+	EncodedLength(msg *Message) int32
+	// EncodeTo writes msg into buffer at offset and returns the bytes written
+	EncodeTo(buffer *atomic.Buffer, offset int32, msg *Message) (int32, error)
 }
 
-// Decode deserializes bytes from Aeron to a Message
-func (c *Codec) Decode(buffer *atomic.Buffer, offset, length int32) (*Message, error) {
-	data := make([]byte, length)
-	buffer.GetBytes(offset, data)
+// ToBuffer encodes msg as a frame (codec ID followed by the codec body)
+// in a new Aeron buffer.
+func ToBuffer(codec Codec, msg *Message) (*atomic.Buffer, int32, error) {
+	frame, err := Marshal(codec, msg)
+	if err != nil {
+		return nil, 0, err
+	}
+	return atomic.MakeBuffer(frame), int32(len(frame)), nil
+}
+
+// Registry maps codec IDs and names to codecs
+type Registry struct {
+	mu     sync.RWMutex
+	byID   map[CodecID]Codec
+	byName map[string]Codec
+}
+
+// NewRegistry creates a registry holding the given codecs
+func NewRegistry(codecs ...Codec) *Registry {
+	r := &Registry{
+		byID:   make(map[CodecID]Codec),
+		byName: make(map[string]Codec),
+	}
+	for _, c := range codecs {
+		if err := r.Register(c); err != nil {
+			panic(err)
+		}
+	}
+	return r
+}
+
+// DefaultRegistry returns a registry with every built-in codec
+func DefaultRegistry() *Registry {
+	return NewRegistry(
+		NewJSONCodec(),
+		NewBinaryCodec(),
+		NewMsgPackCodec(),
+		NewProtobufCodec(),
+	)
+}
+
+// Register adds a codec, failing if its ID or name is already taken
+func (r *Registry) Register(c Codec) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if c.ID() == legacyJSONMarker || c.ID() == BatchFrameID {
+		return fmt.Errorf("%w: id %d is reserved", ErrDuplicateCodec, c.ID())
+	}
+	if _, ok := r.byID[c.ID()]; ok {
+		return fmt.Errorf("%w: id %d", ErrDuplicateCodec, c.ID())
+	}
+	if _, ok := r.byName[c.Name()]; ok {
+		return fmt.Errorf("%w: name %q", ErrDuplicateCodec, c.Name())
+	}
+	r.byID[c.ID()] = c
+	r.byName[c.Name()] = c
+	return nil
+}
 
-	var msg Message
-	if err := json.Unmarshal(data, &msg); err != nil {
+// Lookup returns the codec registered under name
+func (r *Registry) Lookup(name string) (Codec, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c, ok := r.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownCodec, name)
+	}
+	return c, nil
+}
+
+// ByID returns the codec registered under id
+func (r *Registry) ByID(id CodecID) (Codec, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c, ok := r.byID[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: id %d", ErrUnknownCodec, id)
+	}
+	return c, nil
+}
+
+// Names returns the registered codec names in sorted order
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.byName))
+	for name := range r.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Decode reads the codec ID at the front of the frame and decodes the body
+// with the matching codec. Frames from publishers that predate codec IDs
+// (a bare JSON envelope) are decoded as JSON.
+func (r *Registry) Decode(buffer *atomic.Buffer, offset, length int32) (*Message, error) {
+	codec, offset, length, err := r.frameCodec(buffer, offset, length)
+	if err != nil {
 		return nil, err
 	}
-	return &msg, nil
+	return codec.Decode(buffer, offset, length)
 }
 
-// ToBuffer converts encoded message to Aeron buffer
-func (c *Codec) ToBuffer(msg *Message) (*atomic.Buffer, int32, error) {
-	data, err := c.Encode(msg)
+// DecodeWith decodes a frame only if it was written by codec
+func (r *Registry) DecodeWith(codec Codec, buffer *atomic.Buffer, offset, length int32) (*Message, error) {
+	frameCodec, offset, length, err := r.frameCodec(buffer, offset, length)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
+	}
+	if frameCodec.ID() != codec.ID() {
+		return nil, fmt.Errorf("%w: got %s, want %s", ErrCodecMismatch, frameCodec.Name(), codec.Name())
+	}
+	return codec.Decode(buffer, offset, length)
+}
+
+// frameCodec resolves the codec of a frame and returns the body bounds
+func (r *Registry) frameCodec(buffer *atomic.Buffer, offset, length int32) (Codec, int32, int32, error) {
+	if length < FrameHeaderLength {
+		return nil, 0, 0, ErrEmptyFrame
+	}
+
+	id := CodecID(buffer.GetUInt8(offset))
+	if id == legacyJSONMarker {
+		codec, err := r.ByID(CodecIDJSON)
+		return codec, offset, length, err
+	}
+
+	codec, err := r.ByID(id)
+	if err != nil {
+		return nil, 0, 0, err
 	}
-	buffer := atomic.MakeBuffer(data)
-	return buffer, int32(len(data)), nil
+	return codec, offset + FrameHeaderLength, length - FrameHeaderLength, nil
 }
@@ -0,0 +1,244 @@
+package message
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/lirm/aeron-go/aeron/atomic"
+)
+
+const testRequestID = "6f1c2a3e-8d4b-4c5a-9e7f-0a1b2c3d4e5f"
+
+// testMessages returns one message of every type, plus one of a type this
+// build does not know, with every envelope field set
+func testMessages() map[string]*Message {
+	envelope := func(t MessageType, payload Payload) *Message {
+		return &Message{
+			Type:          t,
+			Timestamp:     1_700_000_000_123_456_789,
+			RequestID:     testRequestID,
+			Payload:       payload,
+			Sequence:      300, // wider than one varint byte
+			ReplyChannel:  "aeron:udp?endpoint=publisher-a-driver:40124",
+			ReplyStreamID: 1003,
+		}
+	}
+	return map[string]*Message{
+		"increment":         envelope(MessageTypeIncrement, &IncrementPayload{Amount: -5, Source: "publisher-a", Name: "page-views"}),
+		"increment default": envelope(MessageTypeIncrement, &IncrementPayload{Amount: 1, Source: "publisher-b"}),
+		"reset":             envelope(MessageTypeReset, &ResetPayload{Reason: "maintenance", RequestedBy: "ops"}),
+		"set":               envelope(MessageTypeSet, &SetPayload{Name: "page-views", Value: 42}),
+		"compare and set":   envelope(MessageTypeCompareAndSet, &CompareAndSetPayload{Name: "page-views", Expected: 42, Value: 43}),
+		"bounded increment": envelope(MessageTypeBoundedIncrement, &BoundedIncrementPayload{Name: "stock", Amount: 10, Min: 0, Max: 100, Source: "publisher-a"}),
+		"reply":             envelope(MessageTypeReply, &ReplyPayload{Status: "failed", Counter: "stock", Value: 7, Error: "invalid bounds"}),
+		"unknown type":      envelope(MessageType(42), &RawPayload{Data: []byte(`{"future":true}`)}),
+		"no reply":          {Type: MessageTypeSet, Timestamp: 1, RequestID: testRequestID, Payload: &SetPayload{Value: -1}},
+	}
+}
+
+func testCodecs() []Codec {
+	return []Codec{NewJSONCodec(), NewBinaryCodec(), NewMsgPackCodec(), NewProtobufCodec()}
+}
+
+func TestRegistryRoundTrip(t *testing.T) {
+	registry := DefaultRegistry()
+	for _, codec := range testCodecs() {
+		for name, msg := range testMessages() {
+			t.Run(codec.Name()+"/"+name, func(t *testing.T) {
+				frame, err := Marshal(codec, msg)
+				if err != nil {
+					t.Fatalf("Marshal: %v", err)
+				}
+				if CodecID(frame[0]) != codec.ID() {
+					t.Fatalf("frame starts with %d, want codec ID %d", frame[0], codec.ID())
+				}
+
+				got, err := registry.Decode(atomic.MakeBuffer(frame), 0, int32(len(frame)))
+				if err != nil {
+					t.Fatalf("Decode: %v", err)
+				}
+				if !reflect.DeepEqual(got, msg) {
+					t.Errorf("decoded %+v (payload %+v), want %+v (payload %+v)", got, got.Payload, msg, msg.Payload)
+				}
+
+				got, err = registry.DecodeWith(codec, atomic.MakeBuffer(frame), 0, int32(len(frame)))
+				if err != nil {
+					t.Fatalf("DecodeWith: %v", err)
+				}
+				if !reflect.DeepEqual(got, msg) {
+					t.Errorf("DecodeWith decoded %+v, want %+v", got, msg)
+				}
+			})
+		}
+	}
+}
+
+func TestRegistryDecodeAtOffset(t *testing.T) {
+	msg := testMessages()["increment"]
+	for _, codec := range testCodecs() {
+		t.Run(codec.Name(), func(t *testing.T) {
+			frame, err := Marshal(codec, msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Frames sit at an offset inside the term buffer
+			data := append([]byte("padding-"), frame...)
+			got, err := DefaultRegistry().Decode(atomic.MakeBuffer(data), 8, int32(len(frame)))
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if !reflect.DeepEqual(got, msg) {
+				t.Errorf("decoded %+v, want %+v", got, msg)
+			}
+		})
+	}
+}
+
+func TestRegistryDecodeLegacyJSON(t *testing.T) {
+	msg := testMessages()["increment"]
+	// Publishers that predate codec IDs sent the bare JSON envelope
+	body, err := NewJSONCodec().Encode(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body[0] != legacyJSONMarker {
+		t.Fatalf("JSON envelope starts with %q", body[0])
+	}
+
+	registry := DefaultRegistry()
+	got, err := registry.Decode(atomic.MakeBuffer(body), 0, int32(len(body)))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if !reflect.DeepEqual(got, msg) {
+		t.Errorf("decoded %+v, want %+v", got, msg)
+	}
+
+	if _, err := registry.DecodeWith(NewJSONCodec(), atomic.MakeBuffer(body), 0, int32(len(body))); err != nil {
+		t.Errorf("DecodeWith(json): %v", err)
+	}
+	if _, err := registry.DecodeWith(NewBinaryCodec(), atomic.MakeBuffer(body), 0, int32(len(body))); !errors.Is(err, ErrCodecMismatch) {
+		t.Errorf("DecodeWith(binary) = %v, want ErrCodecMismatch", err)
+	}
+}
+
+func TestRegistryDecodeRejects(t *testing.T) {
+	frame, err := Marshal(NewBinaryCodec(), testMessages()["set"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknown := append([]byte{0x7F}, frame[1:]...)
+
+	tests := []struct {
+		name   string
+		frame  []byte
+		length int32
+		want   error
+	}{
+		{"empty frame", []byte{byte(CodecIDBinary)}, 0, ErrEmptyFrame},
+		{"unknown codec ID", unknown, int32(len(unknown)), ErrUnknownCodec},
+		{"unregistered zero ID", []byte{0, 1, 2, 3}, 4, ErrUnknownCodec},
+		{"codec ID only", []byte{byte(CodecIDBinary)}, 1, ErrShortBuffer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DefaultRegistry().Decode(atomic.MakeBuffer(tt.frame), 0, tt.length)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Decode = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistryDecodeWithMismatch(t *testing.T) {
+	frame, err := Marshal(NewMsgPackCodec(), testMessages()["set"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = DefaultRegistry().DecodeWith(NewProtobufCodec(), atomic.MakeBuffer(frame), 0, int32(len(frame)))
+	if !errors.Is(err, ErrCodecMismatch) {
+		t.Errorf("DecodeWith = %v, want ErrCodecMismatch", err)
+	}
+}
+
+// truncatedBodiesFail checks that every proper prefix of the codec body
+// of msg fails to decode, rather than panicking or yielding a message
+func truncatedBodiesFail(t *testing.T, codec Codec, msg *Message) {
+	t.Helper()
+	body, err := codec.Encode(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n := 0; n < len(body); n++ {
+		// Keep one spare byte so an empty prefix can still be wrapped
+		data := append(append([]byte(nil), body[:n]...), 0)
+		got, err := codec.Decode(atomic.MakeBuffer(data), 0, int32(n))
+		if err == nil {
+			t.Errorf("%s: decoding %d of %d bytes succeeded: %+v", codec.Name(), n, len(body), got)
+		}
+	}
+}
+
+func TestJSONTruncatedBodies(t *testing.T) {
+	for name, msg := range testMessages() {
+		t.Run(name, func(t *testing.T) {
+			truncatedBodiesFail(t, NewJSONCodec(), msg)
+		})
+	}
+}
+
+func TestRegisterReservedIDs(t *testing.T) {
+	tests := []struct {
+		name  string
+		codec Codec
+	}{
+		{"legacy JSON marker", stubCodec{id: legacyJSONMarker, name: "legacy"}},
+		{"batch frame ID", stubCodec{id: BatchFrameID, name: "batch"}},
+		{"duplicate ID", stubCodec{id: CodecIDBinary, name: "other"}},
+		{"duplicate name", stubCodec{id: 0x40, name: "binary"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := DefaultRegistry().Register(tt.codec); !errors.Is(err, ErrDuplicateCodec) {
+				t.Errorf("Register = %v, want ErrDuplicateCodec", err)
+			}
+		})
+	}
+}
+
+// stubCodec only has an ID and a name, for registry tests
+type stubCodec struct {
+	id   CodecID
+	name string
+}
+
+func (c stubCodec) ID() CodecID                   { return c.id }
+func (c stubCodec) Name() string                  { return c.name }
+func (stubCodec) Encode(*Message) ([]byte, error) { return nil, nil }
+func (stubCodec) Decode(*atomic.Buffer, int32, int32) (*Message, error) {
+	return nil, nil
+}
+
+func TestMaxSequenceGrowth(t *testing.T) {
+	for _, codec := range testCodecs() {
+		for name, msg := range testMessages() {
+			t.Run(codec.Name()+"/"+name, func(t *testing.T) {
+				narrow, wide := *msg, *msg
+				narrow.Sequence, wide.Sequence = 1, math.MaxUint64
+				before, err := Marshal(codec, &narrow)
+				if err != nil {
+					t.Fatal(err)
+				}
+				after, err := Marshal(codec, &wide)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if growth := int32(len(after) - len(before)); growth > MaxSequenceGrowth {
+					t.Errorf("frame grew by %d bytes, more than MaxSequenceGrowth", growth)
+				}
+			})
+		}
+	}
+}
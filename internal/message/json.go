@@ -0,0 +1,81 @@
+package message
+
+import (
+	"encoding/json"
+
+	"github.com/lirm/aeron-go/aeron/atomic"
+)
+
+// jsonMessage is the JSON wire envelope. The payload is itself JSON and
+// ends up base64-encoded inside the envelope.
+type jsonMessage struct {
+	Type      MessageType `json:"type"`
+	Timestamp int64       `json:"timestamp"`
+	RequestID string      `json:"request_id"`
+	Payload   []byte      `json:"payload,omitempty"`
+
+	ReplyChannel  string `json:"reply_channel,omitempty"`
+	ReplyStreamID int32  `json:"reply_stream_id,omitempty"`
+
+	Sequence uint64 `json:"sequence,omitempty"`
+}
+
+// jsonCodec is the original JSON envelope codec
+type jsonCodec struct{}
+
+// NewJSONCodec creates the JSON envelope codec
+func NewJSONCodec() Codec {
+	return jsonCodec{}
+}
+
+func (jsonCodec) ID() CodecID  { return CodecIDJSON }
+func (jsonCodec) Name() string { return "json" }
+
+func (jsonCodec) Encode(msg *Message) ([]byte, error) {
+	wire := jsonMessage{
+		Type:      msg.Type,
+		Timestamp: msg.Timestamp,
+		RequestID: msg.RequestID,
+
+		ReplyChannel:  msg.ReplyChannel,
+		ReplyStreamID: msg.ReplyStreamID,
+
+		Sequence: msg.Sequence,
+	}
+	if msg.Payload != nil {
+		payload, err := json.Marshal(msg.Payload)
+		if err != nil {
+			return nil, err
+		}
+		wire.Payload = payload
+	}
+	return json.Marshal(wire)
+}
+
+func (jsonCodec) Decode(buffer *atomic.Buffer, offset, length int32) (*Message, error) {
+	data := make([]byte, length)
+	buffer.GetBytes(offset, data)
+
+	var wire jsonMessage
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return nil, err
+	}
+
+	msg := &Message{
+		Type:      wire.Type,
+		Timestamp: wire.Timestamp,
+		RequestID: wire.RequestID,
+
+		ReplyChannel:  wire.ReplyChannel,
+		ReplyStreamID: wire.ReplyStreamID,
+
+		Sequence: wire.Sequence,
+	}
+	if payload := newPayload(wire.Type); payload != nil && len(wire.Payload) > 0 {
+		if err := json.Unmarshal(wire.Payload, payload); err != nil {
+			return nil, err
+		}
+		msg.Payload = payload
+	}
+	return msg, nil
+}
@@ -0,0 +1,329 @@
+package message
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/lirm/aeron-go/aeron/atomic"
+)
+
+var ErrMsgPack = errors.New("malformed msgpack")
+
+// msgpackCodec encodes the envelope as a MessagePack array:
+//
+//	[type uint, timestamp int, request_id str, payload bin|nil,
+//	 reply_channel str, reply_stream_id int, sequence uint]
+//
+// The payload is carried as the binary payload block. Decoders accept
+// arrays with extra trailing elements so the envelope can grow, and
+// envelopes written before the reply fields or the sequence existed.
+type msgpackCodec struct{}
+
+// NewMsgPackCodec creates the MessagePack codec
+func NewMsgPackCodec() Codec {
+	return msgpackCodec{}
+}
+
+func (msgpackCodec) ID() CodecID  { return CodecIDMsgPack }
+func (msgpackCodec) Name() string { return "msgpack" }
+
+const (
+	msgpackEnvelopeFields = 7
+	// msgpackReplyFields is the length of the envelope with reply fields
+	msgpackReplyFields = 6
+	// msgpackRequiredFields is the length of the original envelope
+	msgpackRequiredFields = 4
+)
+
+func (msgpackCodec) Encode(msg *Message) ([]byte, error) {
+	payload := payloadBytes(msg.Payload)
+
+	b := make([]byte, 0, 40+len(msg.RequestID)+len(msg.ReplyChannel)+len(payload))
+	b = append(b, 0x90|msgpackEnvelopeFields) // fixarray
+	b = mpAppendUint(b, uint64(msg.Type))
+	b = mpAppendInt(b, msg.Timestamp)
+	b = mpAppendString(b, msg.RequestID)
+	if payload == nil {
+		b = append(b, 0xc0) // nil
+	} else {
+		b = mpAppendBin(b, payload)
+	}
+	b = mpAppendString(b, msg.ReplyChannel)
+	b = mpAppendInt(b, int64(msg.ReplyStreamID))
+	b = mpAppendUint(b, msg.Sequence)
+	return b, nil
+}
+
+func (msgpackCodec) Decode(buffer *atomic.Buffer, offset, length int32) (*Message, error) {
+	data := make([]byte, length)
+	buffer.GetBytes(offset, data)
+	r := mpReader{data: data}
+
+	n, err := r.arrayHeader()
+	if err != nil {
+		return nil, err
+	}
+	if n < msgpackRequiredFields {
+		return nil, fmt.Errorf("%w: envelope has %d fields", ErrMsgPack, n)
+	}
+
+	msgType, err := r.int()
+	if err != nil {
+		return nil, err
+	}
+	timestamp, err := r.int()
+	if err != nil {
+		return nil, err
+	}
+	requestID, err := r.str()
+	if err != nil {
+		return nil, err
+	}
+	payload, err := r.binOrNil()
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &Message{
+		Type:      MessageType(msgType),
+		Timestamp: timestamp,
+		RequestID: requestID,
+	}
+	if n >= msgpackReplyFields {
+		if msg.ReplyChannel, err = r.str(); err != nil {
+			return nil, err
+		}
+		replyStreamID, err := r.int()
+		if err != nil {
+			return nil, err
+		}
+		msg.ReplyStreamID = int32(replyStreamID)
+	}
+	if n >= msgpackEnvelopeFields {
+		sequence, err := r.int()
+		if err != nil {
+			return nil, err
+		}
+		msg.Sequence = uint64(sequence)
+	}
+	if payload != nil {
+		if msg.Payload, err = decodePayloadBytes(msg.Type, payload); err != nil {
+			return nil, err
+		}
+	}
+	return msg, nil
+}
+
+func mpAppendUint(b []byte, v uint64) []byte {
+	switch {
+	case v <= 0x7f:
+		return append(b, byte(v))
+	case v <= math.MaxUint8:
+		return append(b, 0xcc, byte(v))
+	case v <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xcd), uint16(v))
+	case v <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, 0xce), uint32(v))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xcf), v)
+	}
+}
+
+func mpAppendInt(b []byte, v int64) []byte {
+	if v >= 0 {
+		return mpAppendUint(b, uint64(v))
+	}
+	if v >= -32 {
+		return append(b, byte(v))
+	}
+	return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(v))
+}
+
+func mpAppendString(b []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n <= 31:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xda), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xdb), uint32(n))
+	}
+	return append(b, s...)
+}
+
+func mpAppendBin(b []byte, data []byte) []byte {
+	n := len(data)
+	switch {
+	case n <= math.MaxUint8:
+		b = append(b, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xc5), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xc6), uint32(n))
+	}
+	return append(b, data...)
+}
+
+// mpReader decodes the subset of MessagePack written by msgpackCodec
+type mpReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *mpReader) next(n int) ([]byte, error) {
+	if n < 0 || r.pos+n > len(r.data) {
+		return nil, fmt.Errorf("%w: unexpected end of data", ErrMsgPack)
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *mpReader) byte() (byte, error) {
+	b, err := r.next(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// length reads a big-endian length of size bytes
+func (r *mpReader) length(size int) (int, error) {
+	b, err := r.next(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return int(b[0]), nil
+	case 2:
+		return int(binary.BigEndian.Uint16(b)), nil
+	default:
+		return int(binary.BigEndian.Uint32(b)), nil
+	}
+}
+
+func (r *mpReader) arrayHeader() (int, error) {
+	tag, err := r.byte()
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case tag&0xf0 == 0x90:
+		return int(tag & 0x0f), nil
+	case tag == 0xdc:
+		return r.length(2)
+	case tag == 0xdd:
+		return r.length(4)
+	default:
+		return 0, fmt.Errorf("%w: expected array, got 0x%02x", ErrMsgPack, tag)
+	}
+}
+
+func (r *mpReader) int() (int64, error) {
+	tag, err := r.byte()
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case tag <= 0x7f:
+		return int64(tag), nil
+	case tag >= 0xe0:
+		return int64(int8(tag)), nil
+	}
+
+	var size int
+	switch tag {
+	case 0xcc, 0xd0:
+		size = 1
+	case 0xcd, 0xd1:
+		size = 2
+	case 0xce, 0xd2:
+		size = 4
+	case 0xcf, 0xd3:
+		size = 8
+	default:
+		return 0, fmt.Errorf("%w: expected integer, got 0x%02x", ErrMsgPack, tag)
+	}
+	b, err := r.next(size)
+	if err != nil {
+		return 0, err
+	}
+	switch tag {
+	case 0xcc:
+		return int64(b[0]), nil
+	case 0xcd:
+		return int64(binary.BigEndian.Uint16(b)), nil
+	case 0xce:
+		return int64(binary.BigEndian.Uint32(b)), nil
+	case 0xcf:
+		return int64(binary.BigEndian.Uint64(b)), nil
+	case 0xd0:
+		return int64(int8(b[0])), nil
+	case 0xd1:
+		return int64(int16(binary.BigEndian.Uint16(b))), nil
+	case 0xd2:
+		return int64(int32(binary.BigEndian.Uint32(b))), nil
+	default:
+		return int64(binary.BigEndian.Uint64(b)), nil
+	}
+}
+
+func (r *mpReader) str() (string, error) {
+	tag, err := r.byte()
+	if err != nil {
+		return "", err
+	}
+	var n int
+	switch {
+	case tag&0xe0 == 0xa0:
+		n = int(tag & 0x1f)
+	case tag == 0xd9:
+		n, err = r.length(1)
+	case tag == 0xda:
+		n, err = r.length(2)
+	case tag == 0xdb:
+		n, err = r.length(4)
+	case tag == 0xc0:
+		return "", nil
+	default:
+		return "", fmt.Errorf("%w: expected string, got 0x%02x", ErrMsgPack, tag)
+	}
+	if err != nil {
+		return "", err
+	}
+	b, err := r.next(n)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (r *mpReader) binOrNil() ([]byte, error) {
+	tag, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	var n int
+	switch tag {
+	case 0xc0:
+		return nil, nil
+	case 0xc4:
+		n, err = r.length(1)
+	case 0xc5:
+		n, err = r.length(2)
+	case 0xc6:
+		n, err = r.length(4)
+	default:
+		return nil, fmt.Errorf("%w: expected bin, got 0x%02x", ErrMsgPack, tag)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.next(n)
+}
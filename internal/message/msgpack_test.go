@@ -0,0 +1,86 @@
+package message
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/lirm/aeron-go/aeron/atomic"
+)
+
+func TestMsgPackTruncatedBodies(t *testing.T) {
+	for name, msg := range testMessages() {
+		t.Run(name, func(t *testing.T) {
+			truncatedBodiesFail(t, NewMsgPackCodec(), msg)
+		})
+	}
+}
+
+func TestMsgPackEnvelopeLengths(t *testing.T) {
+	msg := testMessages()["increment"]
+	payload := payloadBytes(msg.Payload)
+	envelope := func(fields int, extra ...byte) []byte {
+		b := []byte{0x90 | byte(fields)}
+		b = mpAppendUint(b, uint64(msg.Type))
+		b = mpAppendInt(b, msg.Timestamp)
+		b = mpAppendString(b, msg.RequestID)
+		b = mpAppendBin(b, payload)
+		if fields >= msgpackReplyFields {
+			b = mpAppendString(b, msg.ReplyChannel)
+			b = mpAppendInt(b, int64(msg.ReplyStreamID))
+		}
+		if fields >= msgpackEnvelopeFields {
+			b = mpAppendUint(b, msg.Sequence)
+		}
+		return append(b, extra...)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want func(m Message) Message
+	}{
+		{"original envelope", envelope(msgpackRequiredFields), func(m Message) Message {
+			m.Sequence, m.ReplyChannel, m.ReplyStreamID = 0, "", 0
+			return m
+		}},
+		{"reply envelope", envelope(msgpackReplyFields), func(m Message) Message {
+			m.Sequence = 0
+			return m
+		}},
+		{"extra trailing field", envelope(msgpackEnvelopeFields+1, 0xc0), func(m Message) Message {
+			return m
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewMsgPackCodec().Decode(atomic.MakeBuffer(tt.data), 0, int32(len(tt.data)))
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			want := tt.want(*msg)
+			if !reflect.DeepEqual(*got, want) {
+				t.Errorf("decoded %+v, want %+v", *got, want)
+			}
+		})
+	}
+}
+
+func TestMsgPackDecodeRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"not an array", []byte{0xc0}},
+		{"too few fields", []byte{0x93, 0x01, 0x00, 0xa0}},
+		{"string where int expected", []byte{0x94, 0xa1, 'x', 0x00, 0xa0, 0xc0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewMsgPackCodec().Decode(atomic.MakeBuffer(tt.data), 0, int32(len(tt.data)))
+			if !errors.Is(err, ErrMsgPack) {
+				t.Errorf("Decode = %v, want ErrMsgPack", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package message
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/lirm/aeron-go/aeron/atomic"
+)
+
+var ErrProtobuf = errors.New("malformed protobuf")
+
+// protobufCodec encodes the envelope as the protobuf message
+//
+//	message Envelope {
+//	  uint32 type       = 1;
+//	  int64  timestamp  = 2;
+//	  string request_id = 3;
+//	  bytes  payload    = 4; // binary payload block
+//	  string reply_channel   = 5;
+//	  int32  reply_stream_id = 6;
+//	  uint64 sequence        = 7;
+//	}
+//
+// Unknown fields are skipped on decode, as protobuf requires.
+type protobufCodec struct{}
+
+// NewProtobufCodec creates the protobuf codec
+func NewProtobufCodec() Codec {
+	return protobufCodec{}
+}
+
+func (protobufCodec) ID() CodecID  { return CodecIDProtobuf }
+func (protobufCodec) Name() string { return "protobuf" }
+
+const (
+	pbWireVarint  = 0
+	pbWireFixed64 = 1
+	pbWireBytes   = 2
+	pbWireFixed32 = 5
+
+	pbFieldType      = 1
+	pbFieldTimestamp = 2
+	pbFieldRequestID = 3
+	pbFieldPayload   = 4
+
+	pbFieldReplyChannel  = 5
+	pbFieldReplyStreamID = 6
+	pbFieldSequence      = 7
+)
+
+func (protobufCodec) Encode(msg *Message) ([]byte, error) {
+	payload := payloadBytes(msg.Payload)
+
+	b := make([]byte, 0, 32+len(msg.RequestID)+len(payload))
+	if msg.Type != 0 {
+		b = pbAppendVarint(b, pbFieldType, uint64(msg.Type))
+	}
+	if msg.Timestamp != 0 {
+		b = pbAppendVarint(b, pbFieldTimestamp, uint64(msg.Timestamp))
+	}
+	if msg.RequestID != "" {
+		b = pbAppendBytes(b, pbFieldRequestID, []byte(msg.RequestID))
+	}
+	if payload != nil {
+		b = pbAppendBytes(b, pbFieldPayload, payload)
+	}
+	if msg.ReplyChannel != "" {
+		b = pbAppendBytes(b, pbFieldReplyChannel, []byte(msg.ReplyChannel))
+	}
+	if msg.ReplyStreamID != 0 {
+		// int32 fields encode negative values sign-extended to 64 bits
+		b = pbAppendVarint(b, pbFieldReplyStreamID, uint64(int64(msg.ReplyStreamID)))
+	}
+	if msg.Sequence != 0 {
+		b = pbAppendVarint(b, pbFieldSequence, msg.Sequence)
+	}
+	return b, nil
+}
+
+func (protobufCodec) Decode(buffer *atomic.Buffer, offset, length int32) (*Message, error) {
+	data := make([]byte, length)
+	buffer.GetBytes(offset, data)
+
+	msg := &Message{}
+	var payload []byte
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, fmt.Errorf("%w: bad field key", ErrProtobuf)
+		}
+		data = data[n:]
+		field, wire := key>>3, key&0x7
+
+		var value uint64
+		var bytes []byte
+		switch wire {
+		case pbWireVarint:
+			value, n = binary.Uvarint(data)
+			if n <= 0 {
+				return nil, fmt.Errorf("%w: bad varint in field %d", ErrProtobuf, field)
+			}
+			data = data[n:]
+		case pbWireBytes:
+			size, n := binary.Uvarint(data)
+			if n <= 0 || size > uint64(len(data)-n) {
+				return nil, fmt.Errorf("%w: bad length in field %d", ErrProtobuf, field)
+			}
+			bytes = data[n : n+int(size)]
+			data = data[n+int(size):]
+		case pbWireFixed64:
+			if len(data) < 8 {
+				return nil, fmt.Errorf("%w: short fixed64 in field %d", ErrProtobuf, field)
+			}
+			data = data[8:]
+		case pbWireFixed32:
+			if len(data) < 4 {
+				return nil, fmt.Errorf("%w: short fixed32 in field %d", ErrProtobuf, field)
+			}
+			data = data[4:]
+		default:
+			return nil, fmt.Errorf("%w: unsupported wire type %d", ErrProtobuf, wire)
+		}
+
+		switch {
+		case field == pbFieldType && wire == pbWireVarint:
+			msg.Type = MessageType(value)
+		case field == pbFieldTimestamp && wire == pbWireVarint:
+			msg.Timestamp = int64(value)
+		case field == pbFieldRequestID && wire == pbWireBytes:
+			msg.RequestID = string(bytes)
+		case field == pbFieldPayload && wire == pbWireBytes:
+			payload = bytes
+		case field == pbFieldReplyChannel && wire == pbWireBytes:
+			msg.ReplyChannel = string(bytes)
+		case field == pbFieldReplyStreamID && wire == pbWireVarint:
+			msg.ReplyStreamID = int32(value)
+		case field == pbFieldSequence && wire == pbWireVarint:
+			msg.Sequence = value
+		}
+	}
+
+	if payload != nil {
+		var err error
+		if msg.Payload, err = decodePayloadBytes(msg.Type, payload); err != nil {
+			return nil, err
+		}
+	}
+	return msg, nil
+}
+
+func pbAppendVarint(b []byte, field int, v uint64) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|pbWireVarint)
+	return binary.AppendUvarint(b, v)
+}
+
+func pbAppendBytes(b []byte, field int, data []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|pbWireBytes)
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
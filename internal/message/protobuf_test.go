@@ -0,0 +1,105 @@
+package message
+
+import (
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/lirm/aeron-go/aeron/atomic"
+)
+
+func TestProtobufTruncatedBodies(t *testing.T) {
+	// A protobuf message has no overall length, so a prefix that ends on a
+	// field boundary decodes as a message without the later fields. A
+	// prefix that cuts a field must fail, and none may yield the original.
+	codec := NewProtobufCodec()
+	for name, msg := range testMessages() {
+		t.Run(name, func(t *testing.T) {
+			body, err := codec.Encode(msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			boundaries := map[int]bool{0: true}
+			for data := body; len(data) > 0; {
+				data = data[pbFieldLength(t, data):]
+				boundaries[len(body)-len(data)] = true
+			}
+
+			for n := 0; n < len(body); n++ {
+				data := append(append([]byte(nil), body[:n]...), 0)
+				got, err := codec.Decode(atomic.MakeBuffer(data), 0, int32(n))
+				switch {
+				case boundaries[n] && err != nil:
+					// The payload field may end up without the fields it needs
+					if msg.Payload == nil || !errors.Is(err, ErrShortBuffer) {
+						t.Errorf("decoding %d of %d bytes, on a field boundary: %v", n, len(body), err)
+					}
+				case !boundaries[n] && !errors.Is(err, ErrProtobuf):
+					t.Errorf("decoding %d of %d bytes = %v, want ErrProtobuf", n, len(body), err)
+				case err == nil && reflect.DeepEqual(got, msg):
+					t.Errorf("decoding %d of %d bytes yielded the whole message", n, len(body))
+				}
+			}
+		})
+	}
+}
+
+// pbFieldLength returns the encoded length of the first field in data
+func pbFieldLength(t *testing.T, data []byte) int {
+	t.Helper()
+	key, n := binary.Uvarint(data)
+	switch key & 0x7 {
+	case pbWireVarint:
+		_, m := binary.Uvarint(data[n:])
+		return n + m
+	case pbWireBytes:
+		size, m := binary.Uvarint(data[n:])
+		return n + m + int(size)
+	default:
+		t.Fatalf("unexpected wire type %d", key&0x7)
+		return 0
+	}
+}
+
+func TestProtobufSkipsUnknownFields(t *testing.T) {
+	msg := testMessages()["set"]
+	body, err := NewProtobufCodec().Encode(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Fields a newer publisher might add, of every wire type
+	body = pbAppendVarint(body, 20, 12345)
+	body = pbAppendBytes(body, 21, []byte("future"))
+	body = append(binary.AppendUvarint(body, 22<<3|pbWireFixed64), 1, 2, 3, 4, 5, 6, 7, 8)
+	body = append(binary.AppendUvarint(body, 23<<3|pbWireFixed32), 1, 2, 3, 4)
+
+	got, err := NewProtobufCodec().Decode(atomic.MakeBuffer(body), 0, int32(len(body)))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if !reflect.DeepEqual(got, msg) {
+		t.Errorf("decoded %+v, want %+v", got, msg)
+	}
+}
+
+func TestProtobufDecodeRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"unsupported wire type", []byte{1<<3 | 3}},
+		{"short fixed64", []byte{14<<3 | pbWireFixed64, 1, 2}},
+		{"short fixed32", []byte{15<<3 | pbWireFixed32, 1}},
+		{"bytes past end", []byte{3<<3 | pbWireBytes, 10, 'a'}},
+		{"unterminated varint", []byte{2<<3 | pbWireVarint, 0x80, 0x80}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewProtobufCodec().Decode(atomic.MakeBuffer(tt.data), 0, int32(len(tt.data)))
+			if !errors.Is(err, ErrProtobuf) {
+				t.Errorf("Decode = %v, want ErrProtobuf", err)
+			}
+		})
+	}
+}
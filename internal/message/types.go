@@ -2,55 +2,544 @@ package message
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"time"
+
+	"github.com/lirm/aeron-go/aeron/atomic"
 )
 
 // MessageType identifies the type of message
 type MessageType uint8
 
 const (
-	MessageTypeUnknown   MessageType = 0
-	MessageTypeIncrement MessageType = 1
-	MessageTypeReset     MessageType = 2
+	MessageTypeUnknown          MessageType = 0
+	MessageTypeIncrement        MessageType = 1
+	MessageTypeReset            MessageType = 2
+	MessageTypeSet              MessageType = 3
+	MessageTypeCompareAndSet    MessageType = 4
+	MessageTypeBoundedIncrement MessageType = 5
+	MessageTypeReply            MessageType = 6
 )
 
+func (t MessageType) String() string {
+	switch t {
+	case MessageTypeIncrement:
+		return "increment"
+	case MessageTypeReset:
+		return "reset"
+	case MessageTypeSet:
+		return "set"
+	case MessageTypeCompareAndSet:
+		return "compare_and_set"
+	case MessageTypeBoundedIncrement:
+		return "bounded_increment"
+	case MessageTypeReply:
+		return "reply"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(t))
+	}
+}
+
+// ErrPayloadType is returned when a message carries a payload of an unexpected type
+var ErrPayloadType = errors.New("unexpected payload type")
+
 // Message represents the envelope for all Aeron messages
 type Message struct {
-	Type      MessageType `json:"type"`
-	Timestamp int64       `json:"timestamp"`
-	RequestID string      `json:"request_id"`
-	Payload   []byte      `json:"payload,omitempty"`
+	Type      MessageType
+	Timestamp int64
+	RequestID string
+	Payload   Payload
+
+	// Sequence numbers the messages of one publisher session, starting at
+	// 1, so the subscriber can detect missing or reordered messages.
+	// Zero means unsequenced.
+	Sequence uint64
+
+	// ReplyChannel and ReplyStreamID ask the subscriber to send a reply,
+	// correlated by RequestID, once the message is handled. An empty
+	// ReplyChannel means no reply is wanted.
+	ReplyChannel  string
+	ReplyStreamID int32
+
+	// Receive-side metadata filled in by the subscriber; never encoded
+	SessionID int32  // Aeron session of the publication the message arrived on
+	Position  int64  // stream position just after the frame that carried it
+	Frame     []byte // copy of the frame as received, kept for dead-lettering; nil when not kept
+}
+
+// Payload is the typed body carried by a Message.
+// Each payload knows its own layout in the binary codec; the JSON codec
+// uses the struct tags.
+type Payload interface {
+	// binaryLength returns the size of the payload block in bytes
+	binaryLength() int32
+	// putBinary writes the payload block at offset
+	putBinary(buffer *atomic.Buffer, offset int32)
+	// getBinary reads the payload block from buffer[offset:offset+length]
+	getBinary(buffer *atomic.Buffer, offset, length int32) error
 }
 
-// IncrementPayload contains increment-specific data
+// newPayload returns an empty payload for the given message type. Types
+// this build does not know get a RawPayload.
+func newPayload(t MessageType) Payload {
+	switch t {
+	case MessageTypeIncrement:
+		return &IncrementPayload{}
+	case MessageTypeReset:
+		return &ResetPayload{}
+	case MessageTypeSet:
+		return &SetPayload{}
+	case MessageTypeCompareAndSet:
+		return &CompareAndSetPayload{}
+	case MessageTypeBoundedIncrement:
+		return &BoundedIncrementPayload{}
+	case MessageTypeReply:
+		return &ReplyPayload{}
+	default:
+		return &RawPayload{}
+	}
+}
+
+// IncrementPayload contains increment-specific data.
+// Name selects the counter; empty means the default counter.
 type IncrementPayload struct {
 	Amount int64  `json:"amount"`
 	Source string `json:"source"`
+	Name   string `json:"name,omitempty"`
+}
+
+// Binary layout:
+//
+//	0  int64  amount
+//	8  string source (uint16 length + bytes)
+//	   string name   (uint16 length + bytes, omitted when empty)
+//
+// Increments sent before counters were named end after source.
+func (p *IncrementPayload) binaryLength() int32 {
+	length := 8 + stringLength(p.Source)
+	if p.Name != "" {
+		length += stringLength(p.Name)
+	}
+	return length
+}
+
+func (p *IncrementPayload) putBinary(buffer *atomic.Buffer, offset int32) {
+	buffer.PutInt64(offset, p.Amount)
+	putString(buffer, offset+8, p.Source)
+	if p.Name != "" {
+		putString(buffer, offset+8+stringLength(p.Source), p.Name)
+	}
 }
 
-// NewIncrementMessage creates a new increment message
-func NewIncrementMessage(requestID string, amount int64, source string) (*Message, error) {
-	payload := IncrementPayload{
-		Amount: amount,
-		Source: source,
+func (p *IncrementPayload) getBinary(buffer *atomic.Buffer, offset, length int32) error {
+	if length < 8 {
+		return ErrShortBuffer
 	}
-	payloadBytes, err := json.Marshal(payload)
+	limit := offset + length
+	p.Amount = buffer.GetInt64(offset)
+	source, offset, err := getString(buffer, offset+8, limit)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	p.Source = source
+	if offset == limit {
+		return nil
+	}
+	name, _, err := getString(buffer, offset, limit)
+	if err != nil {
+		return err
+	}
+	p.Name = name
+	return nil
+}
+
+// NewIncrementMessage creates a new increment message for the named counter
+func NewIncrementMessage(requestID, name string, amount int64, source string) (*Message, error) {
 	return &Message{
 		Type:      MessageTypeIncrement,
 		Timestamp: time.Now().UnixNano(),
 		RequestID: requestID,
-		Payload:   payloadBytes,
+		Payload: &IncrementPayload{
+			Amount: amount,
+			Source: source,
+			Name:   name,
+		},
 	}, nil
 }
 
 // DecodeIncrementPayload extracts IncrementPayload from a Message
 func (m *Message) DecodeIncrementPayload() (*IncrementPayload, error) {
-	var payload IncrementPayload
-	if err := json.Unmarshal(m.Payload, &payload); err != nil {
-		return nil, err
+	payload, ok := m.Payload.(*IncrementPayload)
+	if !ok {
+		return nil, fmt.Errorf("%w: want increment, got %T", ErrPayloadType, m.Payload)
+	}
+	return payload, nil
+}
+
+// ResetPayload records why a counter reset was requested and by whom
+type ResetPayload struct {
+	Reason      string `json:"reason"`
+	RequestedBy string `json:"requested_by"`
+}
+
+// Binary layout:
+//
+//	0  string reason       (uint16 length + bytes)
+//	   string requested_by (uint16 length + bytes)
+//
+// An empty block is accepted for resets sent before the payload existed.
+func (p *ResetPayload) binaryLength() int32 {
+	return stringLength(p.Reason) + stringLength(p.RequestedBy)
+}
+
+func (p *ResetPayload) putBinary(buffer *atomic.Buffer, offset int32) {
+	putString(buffer, offset, p.Reason)
+	putString(buffer, offset+stringLength(p.Reason), p.RequestedBy)
+}
+
+func (p *ResetPayload) getBinary(buffer *atomic.Buffer, offset, length int32) error {
+	if length == 0 {
+		return nil
+	}
+	limit := offset + length
+	reason, offset, err := getString(buffer, offset, limit)
+	if err != nil {
+		return err
+	}
+	requestedBy, _, err := getString(buffer, offset, limit)
+	if err != nil {
+		return err
+	}
+	p.Reason = reason
+	p.RequestedBy = requestedBy
+	return nil
+}
+
+// NewResetMessage creates a new reset message
+func NewResetMessage(requestID, reason, requestedBy string) (*Message, error) {
+	return &Message{
+		Type:      MessageTypeReset,
+		Timestamp: time.Now().UnixNano(),
+		RequestID: requestID,
+		Payload: &ResetPayload{
+			Reason:      reason,
+			RequestedBy: requestedBy,
+		},
+	}, nil
+}
+
+// DecodeResetPayload extracts ResetPayload from a Message
+func (m *Message) DecodeResetPayload() (*ResetPayload, error) {
+	payload, ok := m.Payload.(*ResetPayload)
+	if !ok {
+		return nil, fmt.Errorf("%w: want reset, got %T", ErrPayloadType, m.Payload)
+	}
+	return payload, nil
+}
+
+// SetPayload overwrites a counter value
+type SetPayload struct {
+	Name  string `json:"name,omitempty"`
+	Value int64  `json:"value"`
+}
+
+// Binary layout:
+//
+//	0  int64  value
+//	8  string name (uint16 length + bytes)
+func (p *SetPayload) binaryLength() int32 {
+	return 8 + stringLength(p.Name)
+}
+
+func (p *SetPayload) putBinary(buffer *atomic.Buffer, offset int32) {
+	buffer.PutInt64(offset, p.Value)
+	putString(buffer, offset+8, p.Name)
+}
+
+func (p *SetPayload) getBinary(buffer *atomic.Buffer, offset, length int32) error {
+	if length < 8 {
+		return ErrShortBuffer
+	}
+	p.Value = buffer.GetInt64(offset)
+	name, _, err := getString(buffer, offset+8, offset+length)
+	if err != nil {
+		return err
+	}
+	p.Name = name
+	return nil
+}
+
+// NewSetMessage creates a message that sets the named counter to value
+func NewSetMessage(requestID, name string, value int64) (*Message, error) {
+	return &Message{
+		Type:      MessageTypeSet,
+		Timestamp: time.Now().UnixNano(),
+		RequestID: requestID,
+		Payload: &SetPayload{
+			Name:  name,
+			Value: value,
+		},
+	}, nil
+}
+
+// DecodeSetPayload extracts SetPayload from a Message
+func (m *Message) DecodeSetPayload() (*SetPayload, error) {
+	payload, ok := m.Payload.(*SetPayload)
+	if !ok {
+		return nil, fmt.Errorf("%w: want set, got %T", ErrPayloadType, m.Payload)
+	}
+	return payload, nil
+}
+
+// CompareAndSetPayload sets a counter to Value only if it currently holds Expected
+type CompareAndSetPayload struct {
+	Name     string `json:"name,omitempty"`
+	Expected int64  `json:"expected"`
+	Value    int64  `json:"value"`
+}
+
+// Binary layout:
+//
+//	0   int64  expected
+//	8   int64  value
+//	16  string name (uint16 length + bytes)
+func (p *CompareAndSetPayload) binaryLength() int32 {
+	return 16 + stringLength(p.Name)
+}
+
+func (p *CompareAndSetPayload) putBinary(buffer *atomic.Buffer, offset int32) {
+	buffer.PutInt64(offset, p.Expected)
+	buffer.PutInt64(offset+8, p.Value)
+	putString(buffer, offset+16, p.Name)
+}
+
+func (p *CompareAndSetPayload) getBinary(buffer *atomic.Buffer, offset, length int32) error {
+	if length < 16 {
+		return ErrShortBuffer
 	}
-	return &payload, nil
+	p.Expected = buffer.GetInt64(offset)
+	p.Value = buffer.GetInt64(offset + 8)
+	name, _, err := getString(buffer, offset+16, offset+length)
+	if err != nil {
+		return err
+	}
+	p.Name = name
+	return nil
+}
+
+// NewCompareAndSetMessage creates a message that sets the named counter to
+// value if it currently holds expected
+func NewCompareAndSetMessage(requestID, name string, expected, value int64) (*Message, error) {
+	return &Message{
+		Type:      MessageTypeCompareAndSet,
+		Timestamp: time.Now().UnixNano(),
+		RequestID: requestID,
+		Payload: &CompareAndSetPayload{
+			Name:     name,
+			Expected: expected,
+			Value:    value,
+		},
+	}, nil
+}
+
+// DecodeCompareAndSetPayload extracts CompareAndSetPayload from a Message
+func (m *Message) DecodeCompareAndSetPayload() (*CompareAndSetPayload, error) {
+	payload, ok := m.Payload.(*CompareAndSetPayload)
+	if !ok {
+		return nil, fmt.Errorf("%w: want compare-and-set, got %T", ErrPayloadType, m.Payload)
+	}
+	return payload, nil
+}
+
+// BoundedIncrementPayload adds Amount to a counter, clamping the result to [Min, Max]
+type BoundedIncrementPayload struct {
+	Name   string `json:"name,omitempty"`
+	Amount int64  `json:"amount"`
+	Min    int64  `json:"min"`
+	Max    int64  `json:"max"`
+	Source string `json:"source"`
+}
+
+// Binary layout:
+//
+//	0   int64  amount
+//	8   int64  min
+//	16  int64  max
+//	24  string name   (uint16 length + bytes)
+//	    string source (uint16 length + bytes)
+func (p *BoundedIncrementPayload) binaryLength() int32 {
+	return 24 + stringLength(p.Name) + stringLength(p.Source)
+}
+
+func (p *BoundedIncrementPayload) putBinary(buffer *atomic.Buffer, offset int32) {
+	buffer.PutInt64(offset, p.Amount)
+	buffer.PutInt64(offset+8, p.Min)
+	buffer.PutInt64(offset+16, p.Max)
+	putString(buffer, offset+24, p.Name)
+	putString(buffer, offset+24+stringLength(p.Name), p.Source)
+}
+
+func (p *BoundedIncrementPayload) getBinary(buffer *atomic.Buffer, offset, length int32) error {
+	if length < 24 {
+		return ErrShortBuffer
+	}
+	limit := offset + length
+	p.Amount = buffer.GetInt64(offset)
+	p.Min = buffer.GetInt64(offset + 8)
+	p.Max = buffer.GetInt64(offset + 16)
+	name, offset, err := getString(buffer, offset+24, limit)
+	if err != nil {
+		return err
+	}
+	source, _, err := getString(buffer, offset, limit)
+	if err != nil {
+		return err
+	}
+	p.Name = name
+	p.Source = source
+	return nil
+}
+
+// NewBoundedIncrementMessage creates a message that adds amount to the named
+// counter, clamping the result to [min, max]
+func NewBoundedIncrementMessage(requestID, name string, amount, min, max int64, source string) (*Message, error) {
+	if min > max {
+		return nil, fmt.Errorf("invalid bounds: min %d is greater than max %d", min, max)
+	}
+	return &Message{
+		Type:      MessageTypeBoundedIncrement,
+		Timestamp: time.Now().UnixNano(),
+		RequestID: requestID,
+		Payload: &BoundedIncrementPayload{
+			Name:   name,
+			Amount: amount,
+			Min:    min,
+			Max:    max,
+			Source: source,
+		},
+	}, nil
+}
+
+// DecodeBoundedIncrementPayload extracts BoundedIncrementPayload from a Message
+func (m *Message) DecodeBoundedIncrementPayload() (*BoundedIncrementPayload, error) {
+	payload, ok := m.Payload.(*BoundedIncrementPayload)
+	if !ok {
+		return nil, fmt.Errorf("%w: want bounded increment, got %T", ErrPayloadType, m.Payload)
+	}
+	return payload, nil
+}
+
+// ReplyPayload reports how the subscriber handled the message whose
+// RequestID the reply carries
+type ReplyPayload struct {
+	Status  string `json:"status"`            // applied, clamped, rejected, duplicate or failed
+	Counter string `json:"counter,omitempty"` // empty when the message touched every counter
+	Value   int64  `json:"value"`             // counter value after the message
+	Error   string `json:"error,omitempty"`
+}
+
+// Binary layout:
+//
+//	0  int64  value
+//	8  string status  (uint16 length + bytes)
+//	   string counter (uint16 length + bytes)
+//	   string error   (uint16 length + bytes)
+func (p *ReplyPayload) binaryLength() int32 {
+	return 8 + stringLength(p.Status) + stringLength(p.Counter) + stringLength(p.Error)
+}
+
+func (p *ReplyPayload) putBinary(buffer *atomic.Buffer, offset int32) {
+	buffer.PutInt64(offset, p.Value)
+	offset += 8
+	putString(buffer, offset, p.Status)
+	offset += stringLength(p.Status)
+	putString(buffer, offset, p.Counter)
+	offset += stringLength(p.Counter)
+	putString(buffer, offset, p.Error)
+}
+
+func (p *ReplyPayload) getBinary(buffer *atomic.Buffer, offset, length int32) error {
+	if length < 8 {
+		return ErrShortBuffer
+	}
+	limit := offset + length
+	p.Value = buffer.GetInt64(offset)
+	status, offset, err := getString(buffer, offset+8, limit)
+	if err != nil {
+		return err
+	}
+	counter, offset, err := getString(buffer, offset, limit)
+	if err != nil {
+		return err
+	}
+	errText, _, err := getString(buffer, offset, limit)
+	if err != nil {
+		return err
+	}
+	p.Status = status
+	p.Counter = counter
+	p.Error = errText
+	return nil
+}
+
+// NewReplyMessage creates a reply to the message identified by requestID
+func NewReplyMessage(requestID string, payload *ReplyPayload) (*Message, error) {
+	return &Message{
+		Type:      MessageTypeReply,
+		Timestamp: time.Now().UnixNano(),
+		RequestID: requestID,
+		Payload:   payload,
+	}, nil
+}
+
+// DecodeReplyPayload extracts ReplyPayload from a Message
+func (m *Message) DecodeReplyPayload() (*ReplyPayload, error) {
+	payload, ok := m.Payload.(*ReplyPayload)
+	if !ok {
+		return nil, fmt.Errorf("%w: want reply, got %T", ErrPayloadType, m.Payload)
+	}
+	return payload, nil
+}
+
+// RawPayload keeps the payload of a message type this build does not
+// know, such as one added by a newer publisher, so that the message can be
+// stored and inspected instead of dropped. Data is the payload as the
+// codec wrote it: the binary payload block, or the payload JSON for the
+// JSON codec.
+type RawPayload struct {
+	Data []byte
+}
+
+func (p *RawPayload) binaryLength() int32 {
+	return int32(len(p.Data))
+}
+
+func (p *RawPayload) putBinary(buffer *atomic.Buffer, offset int32) {
+	if len(p.Data) > 0 {
+		buffer.PutBytesArray(offset, &p.Data, 0, int32(len(p.Data)))
+	}
+}
+
+func (p *RawPayload) getBinary(buffer *atomic.Buffer, offset, length int32) error {
+	p.Data = make([]byte, length)
+	if length > 0 {
+		buffer.GetBytes(offset, p.Data)
+	}
+	return nil
+}
+
+// MarshalJSON writes Data back unchanged when it is JSON, and as a
+// base64 string otherwise
+func (p *RawPayload) MarshalJSON() ([]byte, error) {
+	if json.Valid(p.Data) {
+		return p.Data, nil
+	}
+	return json.Marshal(p.Data)
+}
+
+// UnmarshalJSON keeps the payload JSON as it is
+func (p *RawPayload) UnmarshalJSON(data []byte) error {
+	p.Data = append([]byte(nil), data...)
+	return nil
 }
@@ -0,0 +1,214 @@
+// Package metrics is a small, dependency-free implementation of counters,
+// gauges and histograms exposed in the Prometheus text format.
+package metrics
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Kind is the Prometheus metric type of a family
+type Kind uint8
+
+const (
+	KindCounter Kind = iota
+	KindGauge
+	KindHistogram
+)
+
+// String returns the type name used in the # TYPE line
+func (k Kind) String() string {
+	switch k {
+	case KindCounter:
+		return "counter"
+	case KindGauge:
+		return "gauge"
+	default:
+		return "histogram"
+	}
+}
+
+// DefBuckets are latency buckets in seconds, from 100µs to 10s
+var DefBuckets = []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Sample is one labelled value of a function-backed metric
+type Sample struct {
+	Labels []string // values in the order of the family's label names
+	Value  float64
+}
+
+// Counter is a value that only goes up
+type Counter struct {
+	bits atomic.Uint64
+}
+
+// Inc adds one to the counter
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add adds v, which must not be negative, to the counter
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		return
+	}
+	addFloat(&c.bits, v)
+}
+
+// Value returns the current value
+func (c *Counter) Value() float64 {
+	return math.Float64frombits(c.bits.Load())
+}
+
+// Gauge is a value that can go up and down
+type Gauge struct {
+	bits atomic.Uint64
+}
+
+// Set replaces the gauge value
+func (g *Gauge) Set(v float64) {
+	g.bits.Store(math.Float64bits(v))
+}
+
+// Add adds v, which may be negative, to the gauge
+func (g *Gauge) Add(v float64) {
+	addFloat(&g.bits, v)
+}
+
+// Value returns the current value
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(g.bits.Load())
+}
+
+// Histogram counts observations in cumulative buckets
+type Histogram struct {
+	upperBounds []float64
+	counts      []atomic.Uint64 // per bucket, not cumulative; the last is +Inf
+	count       atomic.Uint64
+	sum         atomic.Uint64
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{
+		upperBounds: buckets,
+		counts:      make([]atomic.Uint64, len(buckets)+1),
+	}
+}
+
+// Observe records one value
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.upperBounds, v)
+	h.counts[i].Add(1)
+	h.count.Add(1)
+	addFloat(&h.sum, v)
+}
+
+// Count returns the number of observations
+func (h *Histogram) Count() uint64 {
+	return h.count.Load()
+}
+
+// Sum returns the sum of all observations
+func (h *Histogram) Sum() float64 {
+	return math.Float64frombits(h.sum.Load())
+}
+
+func addFloat(bits *atomic.Uint64, v float64) {
+	for {
+		old := bits.Load()
+		next := math.Float64bits(math.Float64frombits(old) + v)
+		if bits.CompareAndSwap(old, next) {
+			return
+		}
+	}
+}
+
+// family is every series sharing a metric name
+type family struct {
+	name    string
+	help    string
+	kind    Kind
+	labels  []string
+	buckets []float64       // histograms only
+	collect func() []Sample // function-backed families only
+	mu      sync.Mutex
+	series  map[string]*seriesEntry // keyed by joined label values
+	order   []string                // keys in creation order
+}
+
+type seriesEntry struct {
+	labels    []string
+	counter   *Counter
+	gauge     *Gauge
+	histogram *Histogram
+}
+
+// get returns the series for labelValues, creating it on first use
+func (f *family) get(labelValues []string) *seriesEntry {
+	if len(labelValues) != len(f.labels) {
+		panic("metrics: " + f.name + ": wrong number of label values")
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if s, ok := f.series[key]; ok {
+		return s
+	}
+	s := &seriesEntry{labels: append([]string(nil), labelValues...)}
+	switch f.kind {
+	case KindCounter:
+		s.counter = new(Counter)
+	case KindGauge:
+		s.gauge = new(Gauge)
+	case KindHistogram:
+		s.histogram = newHistogram(f.buckets)
+	}
+	f.series[key] = s
+	f.order = append(f.order, key)
+	return s
+}
+
+// snapshot returns the series in creation order
+func (f *family) snapshot() []*seriesEntry {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	entries := make([]*seriesEntry, len(f.order))
+	for i, key := range f.order {
+		entries[i] = f.series[key]
+	}
+	return entries
+}
+
+// CounterVec is a counter partitioned by labels
+type CounterVec struct {
+	family *family
+}
+
+// With returns the counter for the given label values, in label name order
+func (v *CounterVec) With(labelValues ...string) *Counter {
+	return v.family.get(labelValues).counter
+}
+
+// GaugeVec is a gauge partitioned by labels
+type GaugeVec struct {
+	family *family
+}
+
+// With returns the gauge for the given label values, in label name order
+func (v *GaugeVec) With(labelValues ...string) *Gauge {
+	return v.family.get(labelValues).gauge
+}
+
+// HistogramVec is a histogram partitioned by labels
+type HistogramVec struct {
+	family *family
+}
+
+// With returns the histogram for the given label values, in label name order
+func (v *HistogramVec) With(labelValues ...string) *Histogram {
+	return v.family.get(labelValues).histogram
+}
@@ -0,0 +1,197 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the Prometheus text exposition format served by Handler
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Registry holds metric families and writes them in the text format.
+// Registering the same name twice panics, as it is a programming error.
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// Counter registers a counter without labels
+func (r *Registry) Counter(name, help string) *Counter {
+	return r.CounterVec(name, help).With()
+}
+
+// CounterVec registers a counter partitioned by the given label names
+func (r *Registry) CounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{family: r.register(&family{name: name, help: help, kind: KindCounter, labels: labels})}
+}
+
+// Gauge registers a gauge without labels
+func (r *Registry) Gauge(name, help string) *Gauge {
+	return r.GaugeVec(name, help).With()
+}
+
+// GaugeVec registers a gauge partitioned by the given label names
+func (r *Registry) GaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{family: r.register(&family{name: name, help: help, kind: KindGauge, labels: labels})}
+}
+
+// Histogram registers a histogram without labels; nil buckets means DefBuckets
+func (r *Registry) Histogram(name, help string, buckets []float64) *Histogram {
+	return r.HistogramVec(name, help, buckets).With()
+}
+
+// HistogramVec registers a histogram partitioned by the given label names;
+// nil buckets means DefBuckets
+func (r *Registry) HistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &HistogramVec{family: r.register(&family{name: name, help: help, kind: KindHistogram, labels: labels, buckets: buckets})}
+}
+
+// CounterFunc registers a counter whose samples are read from collect at
+// scrape time, for values another component already counts
+func (r *Registry) CounterFunc(name, help string, labels []string, collect func() []Sample) {
+	r.register(&family{name: name, help: help, kind: KindCounter, labels: labels, collect: collect})
+}
+
+// GaugeFunc registers a gauge whose samples are read from collect at scrape time
+func (r *Registry) GaugeFunc(name, help string, labels []string, collect func() []Sample) {
+	r.register(&family{name: name, help: help, kind: KindGauge, labels: labels, collect: collect})
+}
+
+func (r *Registry) register(f *family) *family {
+	f.series = make(map[string]*seriesEntry)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.families[f.name]; ok {
+		panic("metrics: duplicate metric " + f.name)
+	}
+	r.families[f.name] = f
+	return f
+}
+
+// WriteText writes every family, sorted by name, in the text format
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	families := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.mu.Unlock()
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(bw)
+	}
+	return bw.Flush()
+}
+
+// Handler serves the registry for Prometheus to scrape
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		r.WriteText(w)
+	})
+}
+
+func (f *family) write(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+
+	if f.collect != nil {
+		for _, sample := range f.collect() {
+			writeSample(w, f.name, f.labels, sample.Labels, "", "", sample.Value)
+		}
+		return
+	}
+
+	for _, s := range f.snapshot() {
+		switch f.kind {
+		case KindCounter:
+			writeSample(w, f.name, f.labels, s.labels, "", "", s.counter.Value())
+		case KindGauge:
+			writeSample(w, f.name, f.labels, s.labels, "", "", s.gauge.Value())
+		case KindHistogram:
+			h := s.histogram
+			var cumulative uint64
+			for i, bound := range h.upperBounds {
+				cumulative += h.counts[i].Load()
+				writeSample(w, f.name+"_bucket", f.labels, s.labels, "le", formatFloat(bound), float64(cumulative))
+			}
+			cumulative += h.counts[len(h.upperBounds)].Load()
+			writeSample(w, f.name+"_bucket", f.labels, s.labels, "le", "+Inf", float64(cumulative))
+			writeSample(w, f.name+"_sum", f.labels, s.labels, "", "", h.Sum())
+			writeSample(w, f.name+"_count", f.labels, s.labels, "", "", float64(h.Count()))
+		}
+	}
+}
+
+// writeSample writes one line; extraName/extraValue add a label such as le
+func writeSample(w *bufio.Writer, name string, labels, values []string, extraName, extraValue string, v float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || extraName != "" {
+		w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			value := ""
+			if i < len(values) {
+				value = values[i]
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", label, escapeLabel(value))
+		}
+		if extraName != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", extraName, extraValue)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
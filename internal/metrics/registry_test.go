@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func scrape(t *testing.T, r *Registry) string {
+	t.Helper()
+	server := httptest.NewServer(r.Handler())
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); got != ContentType {
+		t.Errorf("Content-Type = %q, want %q", got, ContentType)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	requests := r.CounterVec("http_requests_total", "Requests by route.\nSecond line with a \\ backslash.", "route", "code")
+	requests.With("/api/counters/{name}", "200").Add(3)
+	requests.With(`say "hi"`+"\n"+`C:\tmp`, "500").Inc()
+
+	r.Gauge("aeron_images", "Connected images.").Set(2.5)
+
+	latency := r.HistogramVec("duration_seconds", "Latency.", []float64{1, 0.1, 0.5}, "route")
+	for _, v := range []float64{0.05, 0.1, 0.3, 0.7, 5, 8} {
+		latency.With("/a").Observe(v)
+	}
+
+	r.GaugeFunc("queue_length", "Queued.", []string{"queue"}, func() []Sample {
+		return []Sample{{Labels: []string{"async"}, Value: 7}}
+	})
+
+	want := strings.Join([]string{
+		`# HELP aeron_images Connected images.`,
+		`# TYPE aeron_images gauge`,
+		`aeron_images 2.5`,
+		`# HELP duration_seconds Latency.`,
+		`# TYPE duration_seconds histogram`,
+		`duration_seconds_bucket{route="/a",le="0.1"} 2`,
+		`duration_seconds_bucket{route="/a",le="0.5"} 3`,
+		`duration_seconds_bucket{route="/a",le="1"} 4`,
+		`duration_seconds_bucket{route="/a",le="+Inf"} 6`,
+		`duration_seconds_sum{route="/a"} 14.15`,
+		`duration_seconds_count{route="/a"} 6`,
+		`# HELP http_requests_total Requests by route.\nSecond line with a \\ backslash.`,
+		`# TYPE http_requests_total counter`,
+		`http_requests_total{route="/api/counters/{name}",code="200"} 3`,
+		`http_requests_total{route="say \"hi\"\nC:\\tmp",code="500"} 1`,
+		`# HELP queue_length Queued.`,
+		`# TYPE queue_length gauge`,
+		`queue_length{queue="async"} 7`,
+		``,
+	}, "\n")
+	if got := scrape(t, r); got != want {
+		t.Errorf("scraped:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestHistogramWithoutLabels(t *testing.T) {
+	r := NewRegistry()
+	h := r.Histogram("publish_seconds", "Publish latency.", []float64{0.001})
+	h.Observe(0.001) // on a bound, counted in that bucket
+	h.Observe(2)
+
+	got := scrape(t, r)
+	for _, line := range []string{
+		`publish_seconds_bucket{le="0.001"} 1`,
+		`publish_seconds_bucket{le="+Inf"} 2`,
+		`publish_seconds_count 2`,
+	} {
+		if !strings.Contains(got, line+"\n") {
+			t.Errorf("scrape is missing %q:\n%s", line, got)
+		}
+	}
+}
+
+func TestRegisterDuplicatePanics(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("events_total", "Events.")
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a duplicate name did not panic")
+		}
+	}()
+	r.Gauge("events_total", "Events.")
+}
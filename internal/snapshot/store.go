@@ -0,0 +1,139 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	ErrNotFound         = errors.New("snapshot not found")
+	ErrChecksumMismatch = errors.New("snapshot checksum mismatch")
+	ErrUnsupported      = errors.New("unsupported snapshot version")
+)
+
+// FormatVersion is written to every snapshot file
+const FormatVersion = 1
+
+const tempSuffix = ".tmp"
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// envelope is the on-disk layout: the state as raw JSON plus a CRC-32C
+// over exactly those bytes
+type envelope struct {
+	Version  int             `json:"version"`
+	Checksum uint32          `json:"checksum"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// Store writes and reads one snapshot file in a directory.
+// Writes go to a temporary file that is synced and then renamed over the
+// previous snapshot, so a crash mid-write leaves the old snapshot intact.
+type Store struct {
+	dir  string
+	name string
+}
+
+// NewStore creates the directory if needed and removes temporary files left
+// behind by a write that did not complete
+func NewStore(dir, name string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), name) && strings.HasSuffix(e.Name(), tempSuffix) {
+			if err := os.Remove(filepath.Join(dir, e.Name())); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &Store{dir: dir, name: name}, nil
+}
+
+// Path returns the snapshot file path
+func (s *Store) Path() string {
+	return filepath.Join(s.dir, s.name)
+}
+
+// Save marshals v to JSON and atomically replaces the snapshot file
+func (s *Store) Save(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	contents, err := json.Marshal(envelope{
+		Version:  FormatVersion,
+		Checksum: crc32.Checksum(data, castagnoli),
+		Data:     data,
+	})
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, s.name+".*"+tempSuffix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	if _, err := tmp.Write(contents); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.Path()); err != nil {
+		return err
+	}
+	return syncDir(s.dir)
+}
+
+// Load reads the snapshot file into v. It returns ErrNotFound when no
+// snapshot has been written yet.
+func (s *Store) Load(v any) error {
+	contents, err := os.ReadFile(s.Path())
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	var env envelope
+	if err := json.Unmarshal(contents, &env); err != nil {
+		return fmt.Errorf("%w: %v", ErrChecksumMismatch, err)
+	}
+	if env.Version != FormatVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupported, env.Version)
+	}
+	if sum := crc32.Checksum(env.Data, castagnoli); sum != env.Checksum {
+		return fmt.Errorf("%w: got %08x, want %08x", ErrChecksumMismatch, sum, env.Checksum)
+	}
+	return json.Unmarshal(env.Data, v)
+}
+
+// syncDir flushes the directory entry so the rename survives a power loss
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,181 @@
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type testState struct {
+	Value  int64            `json:"value"`
+	Counts map[string]int64 `json:"counts"`
+}
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	store, err := NewStore(t.TempDir(), "counter.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// tempFiles returns the temporary files left in the store directory
+func tempFiles(t *testing.T, s *Store) []string {
+	t.Helper()
+	matches, err := filepath.Glob(filepath.Join(s.dir, "*"+tempSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return matches
+}
+
+func loadValue(t *testing.T, s *Store) int64 {
+	t.Helper()
+	var got testState
+	if err := s.Load(&got); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	return got.Value
+}
+
+func TestStoreSaveLoad(t *testing.T) {
+	store := newTestStore(t)
+	var got testState
+	if err := store.Load(&got); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Load before Save = %v, want ErrNotFound", err)
+	}
+
+	for _, value := range []int64{1, 2, 3} {
+		if err := store.Save(testState{Value: value, Counts: map[string]int64{"a": value}}); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+		if got := loadValue(t, store); got != value {
+			t.Errorf("loaded %d, want %d", got, value)
+		}
+		if tmp := tempFiles(t, store); len(tmp) != 0 {
+			t.Errorf("Save left temporary files %v", tmp)
+		}
+	}
+}
+
+func TestStoreFailedSaveKeepsSnapshot(t *testing.T) {
+	store := newTestStore(t)
+	if err := store.Save(testState{Value: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(math.NaN()); err == nil {
+		t.Fatal("Save of an unencodable value succeeded")
+	}
+	if got := loadValue(t, store); got != 1 {
+		t.Errorf("loaded %d after a failed Save, want 1", got)
+	}
+}
+
+func TestStoreInterruptedWrite(t *testing.T) {
+	// A crash before the rename leaves the next snapshot half written in a
+	// temporary file, at any offset; the last good snapshot must still load
+	// and reopening the store must clean up
+	store := newTestStore(t)
+	if err := store.Save(testState{Value: 1, Counts: map[string]int64{"a": 1}}); err != nil {
+		t.Fatal(err)
+	}
+	good, err := os.ReadFile(store.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, n := range []int{0, 1, len(good) / 2, len(good) - 1} {
+		tmp := filepath.Join(store.dir, store.name+".12345"+tempSuffix)
+		if err := os.WriteFile(tmp, good[:n], 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if got := loadValue(t, store); got != 1 {
+			t.Errorf("loaded %d with %d bytes in a temporary file, want 1", got, n)
+		}
+
+		reopened, err := NewStore(store.dir, store.name)
+		if err != nil {
+			t.Fatalf("NewStore: %v", err)
+		}
+		if left := tempFiles(t, reopened); len(left) != 0 {
+			t.Errorf("NewStore left temporary files %v", left)
+		}
+		if got := loadValue(t, reopened); got != 1 {
+			t.Errorf("loaded %d after reopening, want 1", got)
+		}
+	}
+}
+
+func TestStoreKeepsOtherTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	other := filepath.Join(dir, "other.json.1"+tempSuffix)
+	if err := os.WriteFile(other, []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewStore(dir, "counter.json"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("temporary file of another store was removed: %v", err)
+	}
+}
+
+func TestStoreRejectsCorruption(t *testing.T) {
+	store := newTestStore(t)
+	if err := store.Save(testState{Value: 42, Counts: map[string]int64{"page-views": 42}}); err != nil {
+		t.Fatal(err)
+	}
+	good, err := os.ReadFile(store.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	corruptions := map[string][]byte{}
+	for _, n := range []int{0, 1, len(good) / 3, len(good) / 2, len(good) - 1} {
+		corruptions[fmt.Sprintf("truncated to %d", n)] = good[:n]
+	}
+	// Flip a digit inside the data, where the JSON stays valid
+	for i := len(good) - 1; i >= 0; i-- {
+		if good[i] == '4' {
+			flipped := append([]byte(nil), good...)
+			flipped[i] = '5'
+			corruptions["flipped data byte"] = flipped
+			break
+		}
+	}
+
+	for name, contents := range corruptions {
+		t.Run(name, func(t *testing.T) {
+			if err := os.WriteFile(store.Path(), contents, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			var got testState
+			if err := store.Load(&got); !errors.Is(err, ErrChecksumMismatch) {
+				t.Errorf("Load = %v (value %d), want ErrChecksumMismatch", err, got.Value)
+			}
+
+			// The next Save replaces the corrupted file
+			if err := store.Save(testState{Value: 7}); err != nil {
+				t.Fatal(err)
+			}
+			if got := loadValue(t, store); got != 7 {
+				t.Errorf("loaded %d after rewriting, want 7", got)
+			}
+		})
+	}
+}
+
+func TestStoreRejectsUnknownVersion(t *testing.T) {
+	store := newTestStore(t)
+	if err := os.WriteFile(store.Path(), []byte(`{"version":99,"checksum":0,"data":{}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var got testState
+	if err := store.Load(&got); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Load = %v, want ErrUnsupported", err)
+	}
+}
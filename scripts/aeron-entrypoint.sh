@@ -4,12 +4,34 @@ set -e
 # Aeron directory in shared memory
 AERON_DIR=/dev/shm/aeron
 
+# Set AERON_ARCHIVE_ENABLED=true to run an ArchivingMediaDriver instead
+AERON_ARCHIVE_ENABLED=${AERON_ARCHIVE_ENABLED:-false}
+AERON_ARCHIVE_DIR=${AERON_ARCHIVE_DIR:-/data/archive}
+
 # Clean up any existing Aeron directory
 rm -rf "$AERON_DIR" 2>/dev/null || true
 mkdir -p "$AERON_DIR"
 
+MAIN_CLASS=io.aeron.driver.MediaDriver
+ARCHIVE_OPTS=()
+if [ "$AERON_ARCHIVE_ENABLED" = "true" ]; then
+    # The archive directory is kept across restarts so recordings survive
+    mkdir -p "$AERON_ARCHIVE_DIR"
+    MAIN_CLASS=io.aeron.archive.ArchivingMediaDriver
+    ARCHIVE_OPTS=(
+        -Daeron.archive.dir="$AERON_ARCHIVE_DIR"
+        -Daeron.archive.control.channel="aeron:udp?endpoint=localhost:8010"
+        -Daeron.archive.control.stream.id=10
+        -Daeron.archive.replication.channel="aeron:udp?endpoint=localhost:0"
+        -Daeron.archive.recording.events.enabled=false
+    )
+fi
+
 echo "Starting Aeron Media Driver..."
 echo "AERON_DIR: $AERON_DIR"
+if [ "$AERON_ARCHIVE_ENABLED" = "true" ]; then
+    echo "AERON_ARCHIVE_DIR: $AERON_ARCHIVE_DIR"
+fi
 
 exec java \
     --add-opens java.base/sun.nio.ch=ALL-UNNAMED \
@@ -19,5 +41,6 @@ exec java \
     -Daeron.dir="$AERON_DIR" \
     -Daeron.mtu.length=1408 \
     -Daeron.threading.mode=SHARED \
+    "${ARCHIVE_OPTS[@]}" \
     -cp /opt/aeron-all.jar \
-    io.aeron.driver.MediaDriver
+    "$MAIN_CLASS"